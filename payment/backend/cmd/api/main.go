@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"payment-backend/internal/api"
 	"payment-backend/internal/api/websocket"
@@ -22,6 +26,19 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
+	// Payment tokens signed with a known secret can be forged for any session
+	tokenSecret := []byte(cfg.JWTSecret)
+	if cfg.HasInsecureJWTSecret() {
+		if !cfg.DebugMode {
+			log.Fatalf("JWT_SECRET is unset or the public sample value; set a random secret to sign payment tokens")
+		}
+		tokenSecret = make([]byte, 32)
+		if _, err := rand.Read(tokenSecret); err != nil {
+			log.Fatalf("Failed to generate payment token secret: %v", err)
+		}
+		log.Printf("Warning: JWT_SECRET is unset or the public sample value; payment tokens are signed with a random key and stop working on restart")
+	}
+
 	// Ensure data directory exists
 	dataDir := filepath.Dir(cfg.DBPath)
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
@@ -43,63 +60,103 @@ func main() {
 	// Initialize repository
 	repo := repository.NewRepository(db)
 
-	// Get network configuration from database to get WebSocket URL
-	var websocketURL *string
-	err = db.QueryRow("SELECT websocket_url FROM networks WHERE id = 'BSC' AND enabled = TRUE").Scan(&websocketURL)
+	// Start one blockchain watcher per enabled network
+	networks, err := repo.GetAllNetworks()
 	if err != nil {
-		log.Printf("Warning: failed to get WebSocket URL from database: %v", err)
+		log.Fatalf("Failed to load networks: %v", err)
 	}
-
-		// Initialize blockchain service
-	bcConfig := blockchain.Config{
-		RPCURL:          cfg.BlockchainRPC,
-		WebsocketURL:    "", // Will be set from database
-		ChainID:         56, // BSC chain ID
-		// ReceiverAddress is not used anymore as each payment uses its own address
-		ReceiverAddress: "", // Kept for backward compatibility but not used
+	for _, network := range networks {
+		// BLOCKCHAIN_RPC keeps overriding the BSC node
+		if network.ID == "BSC" && cfg.BlockchainRPC != "" {
+			network.RPCURL = cfg.BlockchainRPC
+		}
 	}
 
-	// Set WebSocket URL if available
-	if websocketURL != nil {
-		bcConfig.WebsocketURL = *websocketURL
+	chains, err := blockchain.NewRegistry(networks, blockchain.Config{
+		PollInterval:         cfg.BlockchainPollInterval,
+		TokenRefreshInterval: cfg.TokenRefreshInterval,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize blockchain services: %v", err)
 	}
+	defer chains.Close()
 
-	// Create a temporary channel for blockchain service initialization
-	tempPaymentCh := make(chan *blockchain.PaymentStatusUpdate, 100)
+	// Persist the polling scanners' cursors so an outage is rescanned after a restart
+	chains.SetCursorStore(repo)
 
-	bcService, err := blockchain.NewService(bcConfig, tempPaymentCh)
-	if err != nil {
-		log.Fatalf("Failed to initialize blockchain service: %v", err)
+	// Load supported tokens from the database; they are refreshed periodically afterwards
+	if err := chains.SetTokenStore(repo); err != nil {
+		log.Fatalf("Failed to load token registry: %v", err)
 	}
-	defer bcService.Close()
 
 	// Initialize payment service
 	paymentConfig := service.PaymentConfig{
 		// ReceiverAddress is not used anymore as each payment uses its own address
 		ReceiverAddress: "", // Kept for backward compatibility but not used
 		PaymentTimeout:  cfg.PaymentTimeout,
+		ToleranceBps:    cfg.PaymentToleranceBps,
+		UniqueAmountSlots: cfg.UniqueAmountSlots,
+		UniqueAmountStep:  cfg.UniqueAmountStep,
+		TokenSecret:       tokenSecret,
+		TokenTTL:          cfg.PaymentTokenTTL,
+		IdempotencyKeyTTL: cfg.IdempotencyKeyTTL,
+		LatePaymentGrace:  cfg.LatePaymentGrace,
 	}
 
-	paymentService := service.NewPaymentService(repo, bcService, paymentConfig)
+	// Derive a fresh receiver address per session when an extended public key is configured
+	if cfg.DepositXpub != "" {
+		depositKey, err := blockchain.ParseExtendedPublicKey(cfg.DepositXpub)
+		if err != nil {
+			log.Fatalf("Invalid DEPOSIT_XPUB: %v", err)
+		}
+		paymentConfig.DepositKey = depositKey
+		log.Printf("Deriving receiver addresses from the configured extended public key")
+	}
+
+	paymentService := service.NewPaymentService(repo, chains, paymentConfig)
 
 	// Initialize WebSocket manager
 	wsManager := websocket.NewManager(paymentService)
 
+	webhookService := service.NewWebhookService(repo, service.WebhookConfig{
+		MaxAttempts:         cfg.WebhookMaxAttempts,
+		Timeout:             cfg.WebhookTimeout,
+		AllowPrivateTargets: cfg.WebhookAllowPrivate,
+	})
+
+	merchantService := service.NewMerchantService(repo)
+
 	// Initialize handlers
-	handler := api.NewHandler(paymentService, wsManager, cfg)
+	handler := api.NewHandler(paymentService, webhookService, merchantService, wsManager, cfg)
 
-	// Update blockchain service with the real payment channel
-	bcService.SetPaymentChannel(wsManager.GetPaymentChannel())
+	// Send payment status updates to connected frontend clients
+	paymentService.SetPaymentChannel(wsManager.GetPaymentChannel())
 
 	// Initialize Gin router
 	router := gin.Default()
 
 	// Setup routes
-	setupRoutes(router, handler, wsManager)
+	setupRoutes(router, handler, wsManager, cfg.DebugMode)
 
 	// Start payment status listener
 	go wsManager.StartPaymentStatusListener()
 
+	// Resume monitoring for sessions that were open when the process last stopped
+	go func() {
+		if err := paymentService.ResumePaymentMonitoring(context.Background()); err != nil {
+			log.Printf("Failed to resume payment monitoring: %v", err)
+		}
+	}()
+
+	// Expire sessions that run past their expiry time without a payment
+	go paymentService.StartExpirySweeper(context.Background(), cfg.ExpirySweepInterval)
+
+	// Confirm refund transactions submitted by operators
+	go paymentService.StartRefundVerifier(context.Background(), cfg.RefundVerifyInterval)
+
+	// Deliver payment status events from the webhook outbox
+	go webhookService.StartWebhookWorker(context.Background(), cfg.WebhookPollInterval)
+
 	// Start server
 	addr := fmt.Sprintf(":%d", cfg.ServerPort)
 	log.Printf("Starting server on %s", addr)
@@ -109,7 +166,7 @@ func main() {
 }
 
 // setupRoutes sets up the API routes
-func setupRoutes(router *gin.Engine, handler *api.Handler, wsManager *websocket.Manager) {
+func setupRoutes(router *gin.Engine, handler *api.Handler, wsManager *websocket.Manager, debugMode bool) {
 	// Root endpoint - redirect to health check
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -127,19 +184,32 @@ func setupRoutes(router *gin.Engine, handler *api.Handler, wsManager *websocket.
 		})
 	})
 
-	// WebSocket endpoint
-	router.GET("/ws/payments/:paymentId", wsManager.HandleConnection)
+	// WebSocket endpoint; browsers pass the payment token as the token query parameter
+	router.GET("/ws/payments/:paymentId", handler.RequirePaymentAccess(), wsManager.HandleConnection)
 
-	// Debug endpoint (only available in debug mode)
-	router.POST("/debug/payments/:paymentId/simulate-success", handler.DebugSimulatePayment)
+	// Debug endpoint (only available in debug mode); it settles sessions and notifies merchants, so it is for the operator only
+	if debugMode {
+		router.POST("/debug/payments/:paymentId/simulate-success", handler.RequireAdmin(), handler.DebugSimulatePayment)
+	}
 
 	// API v1 routes
 	v1 := router.Group("/api/v1")
 	{
+		// Sessions are created with a merchant API key and read by the customer with the returned payment token
 		payments := v1.Group("/payments")
 		{
-			payments.POST("", handler.CreatePaymentSession)
-			payments.GET("/:paymentId", handler.GetPaymentSession)
+			payments.POST("", handler.RequireMerchant(), handler.CreatePaymentSession)
+			payments.GET("", handler.RequireMerchant(), handler.GetPaymentSessionByMerchantOrderID)
+			payments.GET("/:paymentId", handler.RequirePaymentAccess(), handler.GetPaymentSession)
+			payments.GET("/:paymentId/transfers", handler.RequirePaymentAccess(), handler.GetPaymentTransfers)
+			payments.GET("/:paymentId/history", handler.RequirePaymentAccess(), handler.GetPaymentStatusHistory)
+			payments.POST("/:paymentId/claim", handler.RequirePaymentAccess(), handler.ClaimPayment)
+			payments.GET("/:paymentId/qr.png", handler.RequirePaymentAccess(), handler.GetPaymentQRCodePNG)
+			payments.GET("/:paymentId/qr.svg", handler.RequirePaymentAccess(), handler.GetPaymentQRCodeSVG)
+			payments.POST("/:paymentId/cancel", handler.RequireMerchant(), handler.CancelPayment)
+			payments.POST("/:paymentId/accept", handler.RequireMerchant(), handler.AcceptLatePayment)
+			payments.POST("/:paymentId/refunds", handler.RequireMerchant(), handler.RequestRefund)
+			payments.GET("/:paymentId/refunds", handler.RequireMerchant(), handler.GetPaymentRefunds)
 		}
 
 		tokens := v1.Group("/tokens")
@@ -152,7 +222,17 @@ func setupRoutes(router *gin.Engine, handler *api.Handler, wsManager *websocket.
 			networks.GET("", handler.GetNetworks)
 		}
 
-		stats := v1.Group("/stats")
+		webhooks := v1.Group("/webhooks", handler.RequireMerchant())
+		{
+			webhooks.POST("", handler.CreateWebhookEndpoint)
+			webhooks.GET("", handler.GetWebhookEndpoints)
+			webhooks.DELETE("/:id", handler.DeleteWebhookEndpoint)
+			webhooks.GET("/:id/deliveries", handler.GetWebhookDeliveries)
+			webhooks.POST("/deliveries/:deliveryId/redeliver", handler.RedeliverWebhook)
+		}
+
+		// Stats cover every merchant and the raw WebSocket message log, so they are for the operator only
+		stats := v1.Group("/stats", handler.RequireAdmin())
 		{
 			stats.GET("/payments", handler.GetPaymentStats)
 			stats.GET("/monitoring", handler.GetMonitoringStats)
@@ -160,52 +240,386 @@ func setupRoutes(router *gin.Engine, handler *api.Handler, wsManager *websocket.
 			stats.GET("/websocket", handler.GetWebSocketStats)
 			stats.GET("/websocket/messages", handler.GetWebSocketMessages)
 		}
+
+		admin := v1.Group("/admin", handler.RequireAdmin())
+		{
+			admin.POST("/merchants", handler.CreateMerchant)
+			admin.GET("/merchants", handler.GetMerchants)
+			admin.GET("/refunds", handler.GetRefunds)
+			admin.POST("/refunds/:refundId/approve", handler.ApproveRefund)
+			admin.POST("/refunds/:refundId/reject", handler.RejectRefund)
+			admin.POST("/refunds/:refundId/transaction", handler.SubmitRefundTransaction)
+		}
 	}
 }
 
-// runMigrations runs the database migrations
-func runMigrations(db *sql.DB) error {
-	// Create tables if they don't exist
-	migrations := []string{
-		`CREATE TABLE IF NOT EXISTS payment_sessions (
+// paymentSessionsTable creates the payment_sessions table.
+// Amounts are stored as decimal strings plus integer base units so they never pass through float64.
+const paymentSessionsTable = `CREATE TABLE IF NOT EXISTS payment_sessions (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			payment_id TEXT UNIQUE NOT NULL,
+			merchant_id TEXT,
+			merchant_order_id TEXT,
 			product_id TEXT NOT NULL,
 			product_name TEXT NOT NULL,
-			amount REAL NOT NULL,
+			amount TEXT NOT NULL,
+			amount_base_units TEXT NOT NULL,
+			token_decimals INTEGER NOT NULL,
+			amount_received_base_units TEXT NOT NULL DEFAULT '0',
+			pay_amount_base_units TEXT,
 			currency TEXT NOT NULL,
 			token_symbol TEXT NOT NULL,
 			network_id TEXT NOT NULL,
 			receiver_address TEXT NOT NULL,
 			sender_address TEXT,
 			status TEXT NOT NULL,
+			status_reason TEXT NOT NULL DEFAULT '',
 			qr_code_data TEXT,
 			transaction_hash TEXT,
 			block_number INTEGER,
+			start_block INTEGER,
+			derivation_index INTEGER,
+			metadata TEXT,
+			success_url TEXT,
+			cancel_url TEXT,
 			confirmed_at DATETIME,
 			expires_at DATETIME NOT NULL,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		`CREATE INDEX IF NOT EXISTS idx_payment_sessions_payment_id ON payment_sessions(payment_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_payment_sessions_status ON payment_sessions(status)`,
-		`CREATE INDEX IF NOT EXISTS idx_payment_sessions_expires_at ON payment_sessions(expires_at)`,
-
-		`CREATE TABLE IF NOT EXISTS tokens (
+		)`
+
+// paymentSessionsIndexes creates the payment_sessions indexes
+const paymentSessionsIndexes = `
+		CREATE INDEX IF NOT EXISTS idx_payment_sessions_payment_id ON payment_sessions(payment_id);
+		CREATE INDEX IF NOT EXISTS idx_payment_sessions_status ON payment_sessions(status);
+		CREATE INDEX IF NOT EXISTS idx_payment_sessions_expires_at ON payment_sessions(expires_at);
+`
+
+// paymentSessionsMerchantIndex lets merchants list their own sessions
+const paymentSessionsMerchantIndex = `
+		CREATE INDEX IF NOT EXISTS idx_payment_sessions_merchant_id ON payment_sessions(merchant_id);
+`
+
+// paymentSessionsMerchantOrderIndex keeps merchant order IDs unique per merchant
+const paymentSessionsMerchantOrderIndex = `
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_sessions_merchant_order_id
+		ON payment_sessions(merchant_id, merchant_order_id)
+		WHERE merchant_order_id IS NOT NULL;
+`
+
+// paymentSessionsPayAmountIndex keeps offset pay amounts unique among open sessions sharing a receiver
+const paymentSessionsPayAmountIndex = `
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_sessions_open_pay_amount
+		ON payment_sessions(lower(receiver_address), token_symbol, network_id, pay_amount_base_units)
+		WHERE pay_amount_base_units IS NOT NULL AND status IN ('created', 'pending', 'confirming');
+`
+
+// tokensTable creates the tokens table; a symbol is unique per network so USDT can exist on several chains
+const tokensTable = `CREATE TABLE IF NOT EXISTS tokens (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			symbol TEXT UNIQUE NOT NULL,
+			symbol TEXT NOT NULL,
 			name TEXT NOT NULL,
 			contract_address TEXT NOT NULL,
 			decimals INTEGER NOT NULL,
 			network_id TEXT NOT NULL,
 			enabled BOOLEAN DEFAULT TRUE,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(symbol, network_id)
+		)`
+
+// tokensIndexes creates the tokens indexes
+const tokensIndexes = `
+		CREATE INDEX IF NOT EXISTS idx_tokens_symbol ON tokens(symbol);
+		CREATE INDEX IF NOT EXISTS idx_tokens_network_id ON tokens(network_id);
+`
+
+// paymentTransfersTable creates the payment_transfers table; a Transfer log credits at most one session
+const paymentTransfersTable = `CREATE TABLE IF NOT EXISTS payment_transfers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			payment_id TEXT NOT NULL,
+			transaction_hash TEXT NOT NULL,
+			log_index INTEGER NOT NULL,
+			sender_address TEXT NOT NULL,
+			receiver_address TEXT NOT NULL,
+			token_address TEXT NOT NULL,
+			amount_base_units TEXT NOT NULL,
+			block_number INTEGER NOT NULL,
+			confirmations INTEGER NOT NULL DEFAULT 0,
+			confirmed BOOLEAN NOT NULL DEFAULT FALSE,
+			removed BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(transaction_hash, log_index)
+		)`
+
+// paymentTransfersIndexes creates the payment_transfers indexes
+const paymentTransfersIndexes = `
+		CREATE INDEX IF NOT EXISTS idx_payment_transfers_payment_id ON payment_transfers(payment_id);
+`
+
+// paymentStatsHourlyTable creates the payment_stats_hourly rollup: session counts per creation hour, merchant,
+// network, token and status, with the total time from creation to confirmation of the confirmed ones
+const paymentStatsHourlyTable = `CREATE TABLE IF NOT EXISTS payment_stats_hourly (
+		period TEXT NOT NULL,
+		merchant_id TEXT NOT NULL,
+		network_id TEXT NOT NULL,
+		token_symbol TEXT NOT NULL,
+		status TEXT NOT NULL,
+		payments INTEGER NOT NULL DEFAULT 0,
+		confirmed INTEGER NOT NULL DEFAULT 0,
+		processing_seconds REAL NOT NULL DEFAULT 0,
+		PRIMARY KEY (period, merchant_id, network_id, token_symbol, status)
+	)`
+
+// paymentStatsHourlyTriggers keep payment_stats_hourly in step with every insert, update and delete of payment_sessions
+const paymentStatsHourlyTriggers = `
+		CREATE TRIGGER IF NOT EXISTS payment_stats_hourly_insert AFTER INSERT ON payment_sessions
+		BEGIN
+			INSERT INTO payment_stats_hourly (period, merchant_id, network_id, token_symbol, status, payments, confirmed, processing_seconds)
+			VALUES (strftime('%Y-%m-%dT%H:00:00Z', NEW.created_at), COALESCE(NEW.merchant_id, ''), NEW.network_id, NEW.token_symbol, NEW.status,
+				1, NEW.confirmed_at IS NOT NULL, COALESCE((julianday(NEW.confirmed_at) - julianday(NEW.created_at)) * 86400, 0))
+			ON CONFLICT (period, merchant_id, network_id, token_symbol, status) DO UPDATE SET
+				payments = payments + excluded.payments,
+				confirmed = confirmed + excluded.confirmed,
+				processing_seconds = processing_seconds + excluded.processing_seconds;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS payment_stats_hourly_update AFTER UPDATE ON payment_sessions
+		WHEN OLD.status IS NOT NEW.status OR OLD.confirmed_at IS NOT NEW.confirmed_at OR OLD.created_at IS NOT NEW.created_at
+			OR OLD.merchant_id IS NOT NEW.merchant_id OR OLD.network_id IS NOT NEW.network_id OR OLD.token_symbol IS NOT NEW.token_symbol
+		BEGIN
+			UPDATE payment_stats_hourly SET
+				payments = payments - 1,
+				confirmed = confirmed - (OLD.confirmed_at IS NOT NULL),
+				processing_seconds = processing_seconds - COALESCE((julianday(OLD.confirmed_at) - julianday(OLD.created_at)) * 86400, 0)
+			WHERE period = strftime('%Y-%m-%dT%H:00:00Z', OLD.created_at) AND merchant_id = COALESCE(OLD.merchant_id, '')
+				AND network_id = OLD.network_id AND token_symbol = OLD.token_symbol AND status = OLD.status;
+
+			INSERT INTO payment_stats_hourly (period, merchant_id, network_id, token_symbol, status, payments, confirmed, processing_seconds)
+			VALUES (strftime('%Y-%m-%dT%H:00:00Z', NEW.created_at), COALESCE(NEW.merchant_id, ''), NEW.network_id, NEW.token_symbol, NEW.status,
+				1, NEW.confirmed_at IS NOT NULL, COALESCE((julianday(NEW.confirmed_at) - julianday(NEW.created_at)) * 86400, 0))
+			ON CONFLICT (period, merchant_id, network_id, token_symbol, status) DO UPDATE SET
+				payments = payments + excluded.payments,
+				confirmed = confirmed + excluded.confirmed,
+				processing_seconds = processing_seconds + excluded.processing_seconds;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS payment_stats_hourly_delete AFTER DELETE ON payment_sessions
+		BEGIN
+			UPDATE payment_stats_hourly SET
+				payments = payments - 1,
+				confirmed = confirmed - (OLD.confirmed_at IS NOT NULL),
+				processing_seconds = processing_seconds - COALESCE((julianday(OLD.confirmed_at) - julianday(OLD.created_at)) * 86400, 0)
+			WHERE period = strftime('%Y-%m-%dT%H:00:00Z', OLD.created_at) AND merchant_id = COALESCE(OLD.merchant_id, '')
+				AND network_id = OLD.network_id AND token_symbol = OLD.token_symbol AND status = OLD.status;
+		END;
+`
+
+// paymentStatsHourlyBackfill fills payment_stats_hourly from the sessions that existed before it
+const paymentStatsHourlyBackfill = `
+		INSERT INTO payment_stats_hourly (period, merchant_id, network_id, token_symbol, status, payments, confirmed, processing_seconds)
+		SELECT strftime('%Y-%m-%dT%H:00:00Z', created_at), COALESCE(merchant_id, ''), network_id, token_symbol, status,
+			COUNT(*), COUNT(confirmed_at), COALESCE(SUM((julianday(confirmed_at) - julianday(created_at)) * 86400), 0)
+		FROM payment_sessions
+		GROUP BY 1, 2, 3, 4, 5
+`
+
+// paymentStatusReasonsHourlyTable creates the payment_status_reasons_hourly rollup: session counts per creation hour,
+// status and the reason recorded with the transition into that status
+const paymentStatusReasonsHourlyTable = `CREATE TABLE IF NOT EXISTS payment_status_reasons_hourly (
+		period TEXT NOT NULL,
+		status TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		payments INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (period, status, reason)
+	)`
+
+// paymentStatusReasonsHourlyTriggers copy the reason of each status transition to its session and keep
+// payment_status_reasons_hourly in step with every insert, update and delete of payment_sessions
+const paymentStatusReasonsHourlyTriggers = `
+		CREATE TRIGGER IF NOT EXISTS payment_status_history_reason AFTER INSERT ON payment_status_history
+		BEGIN
+			UPDATE payment_sessions SET status_reason = NEW.reason WHERE payment_id = NEW.payment_id;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS payment_status_reasons_hourly_insert AFTER INSERT ON payment_sessions
+		BEGIN
+			INSERT INTO payment_status_reasons_hourly (period, status, reason, payments)
+			VALUES (strftime('%Y-%m-%dT%H:00:00Z', NEW.created_at), NEW.status, NEW.status_reason, 1)
+			ON CONFLICT (period, status, reason) DO UPDATE SET payments = payments + 1;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS payment_status_reasons_hourly_update AFTER UPDATE ON payment_sessions
+		WHEN OLD.status IS NOT NEW.status OR OLD.status_reason IS NOT NEW.status_reason OR OLD.created_at IS NOT NEW.created_at
+		BEGIN
+			UPDATE payment_status_reasons_hourly SET payments = payments - 1
+			WHERE period = strftime('%Y-%m-%dT%H:00:00Z', OLD.created_at) AND status = OLD.status AND reason = OLD.status_reason;
+
+			INSERT INTO payment_status_reasons_hourly (period, status, reason, payments)
+			VALUES (strftime('%Y-%m-%dT%H:00:00Z', NEW.created_at), NEW.status, NEW.status_reason, 1)
+			ON CONFLICT (period, status, reason) DO UPDATE SET payments = payments + 1;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS payment_status_reasons_hourly_delete AFTER DELETE ON payment_sessions
+		BEGIN
+			UPDATE payment_status_reasons_hourly SET payments = payments - 1
+			WHERE period = strftime('%Y-%m-%dT%H:00:00Z', OLD.created_at) AND status = OLD.status AND reason = OLD.status_reason;
+		END;
+`
+
+// paymentStatusReasonsHourlyBackfill sets the status reason of the sessions that existed before it from their
+// history and fills payment_status_reasons_hourly from them
+const paymentStatusReasonsHourlyBackfill = `
+		UPDATE payment_sessions SET status_reason = COALESCE((
+			SELECT reason FROM payment_status_history h
+			WHERE h.payment_id = payment_sessions.payment_id AND h.to_status = payment_sessions.status
+			ORDER BY h.id DESC LIMIT 1
+		), '');
+
+		INSERT INTO payment_status_reasons_hourly (period, status, reason, payments)
+		SELECT strftime('%Y-%m-%dT%H:00:00Z', created_at), status, status_reason, COUNT(*)
+		FROM payment_sessions
+		GROUP BY 1, 2, 3;
+`
+
+// runMigrations runs the database migrations
+func runMigrations(db *sql.DB) error {
+	// Create tables if they don't exist
+	migrations := []string{
+		paymentSessionsTable,
+		paymentSessionsIndexes,
+
+		tokensTable,
+
+		paymentTransfersTable,
+		paymentTransfersIndexes,
+
+		`CREATE TABLE IF NOT EXISTS deposit_key_indexes (
+			xpub TEXT PRIMARY KEY,
+			next_index INTEGER NOT NULL,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 
-		`CREATE INDEX IF NOT EXISTS idx_tokens_symbol ON tokens(symbol)`,
-		`CREATE INDEX IF NOT EXISTS idx_tokens_network_id ON tokens(network_id)`,
+		`CREATE TABLE IF NOT EXISTS block_cursors (
+			network_id TEXT PRIMARY KEY,
+			last_scanned_block INTEGER NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS merchants (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			merchant_id TEXT UNIQUE NOT NULL,
+			name TEXT NOT NULL,
+			api_key_prefix TEXT NOT NULL,
+			api_key_hash TEXT UNIQUE NOT NULL,
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS idempotency_keys (
+			merchant_id TEXT NOT NULL,
+			idempotency_key TEXT NOT NULL,
+			request_hash TEXT NOT NULL,
+			payment_id TEXT,
+			response_status INTEGER,
+			response_body TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			PRIMARY KEY (merchant_id, idempotency_key)
+		)`,
+
+		`CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at)`,
+
+		`CREATE TABLE IF NOT EXISTS payment_status_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			payment_id TEXT NOT NULL,
+			from_status TEXT NOT NULL,
+			to_status TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			source TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE INDEX IF NOT EXISTS idx_payment_status_history_payment_id ON payment_status_history(payment_id)`,
+
+		`CREATE TABLE IF NOT EXISTS refunds (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			refund_id TEXT UNIQUE NOT NULL,
+			payment_id TEXT NOT NULL,
+			merchant_id TEXT,
+			amount TEXT NOT NULL,
+			amount_base_units TEXT NOT NULL,
+			token_symbol TEXT NOT NULL,
+			network_id TEXT NOT NULL,
+			recipient_address TEXT NOT NULL,
+			reason TEXT,
+			status TEXT NOT NULL,
+			transaction_hash TEXT,
+			block_number INTEGER,
+			failure_reason TEXT,
+			approved_at DATETIME,
+			confirmed_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE INDEX IF NOT EXISTS idx_refunds_payment_id ON refunds(payment_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_refunds_status ON refunds(status)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_refunds_transaction_hash ON refunds(transaction_hash) WHERE transaction_hash IS NOT NULL`,
+
+		`CREATE TABLE IF NOT EXISTS webhook_endpoints (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			merchant_id TEXT,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS webhook_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			event_id TEXT UNIQUE NOT NULL,
+			payment_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			event_id TEXT NOT NULL,
+			endpoint_id INTEGER NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at DATETIME,
+			last_status_code INTEGER,
+			last_error TEXT,
+			delivered_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(event_id, endpoint_id)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			delivery_id INTEGER NOT NULL,
+			attempt INTEGER NOT NULL,
+			status_code INTEGER,
+			error TEXT,
+			response_body TEXT,
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE INDEX IF NOT EXISTS idx_webhook_events_payment_id ON webhook_events(payment_id);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_id ON webhook_deliveries(endpoint_id);
+		CREATE INDEX IF NOT EXISTS idx_webhook_delivery_attempts_delivery_id ON webhook_delivery_attempts(delivery_id);`,
+
+		tokensIndexes,
 
 		`CREATE TABLE IF NOT EXISTS networks (
 			id TEXT PRIMARY KEY,
@@ -214,6 +628,8 @@ func runMigrations(db *sql.DB) error {
 			rpc_url TEXT NOT NULL,
 			websocket_url TEXT,
 			block_explorer TEXT,
+			required_confirmations INTEGER NOT NULL DEFAULT 12,
+			native_currency TEXT NOT NULL DEFAULT '',
 			enabled BOOLEAN DEFAULT TRUE,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
@@ -236,5 +652,339 @@ func runMigrations(db *sql.DB) error {
 		}
 	}
 
+	// Add columns introduced after the initial schema to existing databases
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"payment_sessions", "start_block", "INTEGER"},
+		{"networks", "required_confirmations", "INTEGER NOT NULL DEFAULT 12"},
+		{"payment_sessions", "amount_received_base_units", "TEXT NOT NULL DEFAULT '0'"},
+		{"payment_sessions", "derivation_index", "INTEGER"},
+		{"payment_sessions", "pay_amount_base_units", "TEXT"},
+		{"payment_sessions", "merchant_id", "TEXT"},
+		{"webhook_endpoints", "merchant_id", "TEXT"},
+		{"payment_sessions", "merchant_order_id", "TEXT"},
+		{"payment_sessions", "metadata", "TEXT"},
+		{"payment_sessions", "success_url", "TEXT"},
+		{"payment_sessions", "cancel_url", "TEXT"},
+		{"networks", "native_currency", "TEXT NOT NULL DEFAULT ''"},
+		{"payment_sessions", "status_reason", "TEXT NOT NULL DEFAULT ''"},
+	}
+
+	for _, c := range columns {
+		if err := addColumnIfMissing(db, c.table, c.column, c.definition); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", c.table, c.column, err)
+		}
+	}
+
+	// The default network pays gas in BNB
+	if _, err := db.Exec(`UPDATE networks SET native_currency = 'BNB' WHERE id = 'BSC' AND native_currency = ''`); err != nil {
+		return fmt.Errorf("failed to set default native currency: %w", err)
+	}
+
+	if err := migratePaymentSessionAmounts(db); err != nil {
+		return fmt.Errorf("failed to migrate payment session amounts: %w", err)
+	}
+
+	if err := migrateTokensUniquePerNetwork(db); err != nil {
+		return fmt.Errorf("failed to migrate tokens table: %w", err)
+	}
+
+	if err := migratePaymentTransfersUniqueLog(db); err != nil {
+		return fmt.Errorf("failed to migrate payment transfers table: %w", err)
+	}
+
+	// Created after the column migrations, which may rebuild payment_sessions
+	if _, err := db.Exec(paymentSessionsPayAmountIndex); err != nil {
+		return fmt.Errorf("failed to create pay amount index: %w", err)
+	}
+	if _, err := db.Exec(paymentSessionsMerchantIndex); err != nil {
+		return fmt.Errorf("failed to create merchant index: %w", err)
+	}
+	if _, err := db.Exec(paymentSessionsMerchantOrderIndex); err != nil {
+		return fmt.Errorf("failed to create merchant order index: %w", err)
+	}
+	if err := createPaymentStatsRollup(db); err != nil {
+		return fmt.Errorf("failed to create payment stats rollup: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_webhook_endpoints_merchant_id ON webhook_endpoints(merchant_id)`); err != nil {
+		return fmt.Errorf("failed to create webhook endpoint merchant index: %w", err)
+	}
+
 	return nil
+}
+
+// createPaymentStatsRollup creates the hourly payment stats rollups and the triggers that maintain them,
+// filling each from the existing sessions when its table is new. Payment stats read the rollups,
+// so they do not scan payment_sessions.
+func createPaymentStatsRollup(db *sql.DB) error {
+	rollups := []struct {
+		table    string
+		create   string
+		backfill string
+		triggers string
+	}{
+		{"payment_stats_hourly", paymentStatsHourlyTable, paymentStatsHourlyBackfill, paymentStatsHourlyTriggers},
+		{"payment_status_reasons_hourly", paymentStatusReasonsHourlyTable, paymentStatusReasonsHourlyBackfill, paymentStatusReasonsHourlyTriggers},
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, rollup := range rollups {
+		var exists int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, rollup.table).Scan(&exists); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(rollup.create); err != nil {
+			return err
+		}
+		if exists == 0 {
+			log.Printf("Building %s rollup from existing payment sessions", rollup.table)
+			if _, err := tx.Exec(rollup.backfill); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(rollup.triggers); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// migratePaymentSessionAmounts rebuilds a payment_sessions table that still stores amounts as REAL,
+// converting each amount to a decimal string and base units using its token's decimals
+func migratePaymentSessionAmounts(db *sql.DB) error {
+	amountType, _, err := columnType(db, "payment_sessions", "amount")
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(amountType, "REAL") {
+		return nil
+	}
+
+	log.Printf("Migrating payment session amounts to exact decimal values")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`ALTER TABLE payment_sessions RENAME TO payment_sessions_legacy`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(paymentSessionsTable); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT s.id, s.payment_id, s.product_id, s.product_name, s.amount, COALESCE(t.decimals, 18),
+		       s.currency, s.token_symbol, s.network_id, s.receiver_address, s.sender_address,
+		       s.status, s.qr_code_data, s.transaction_hash, s.block_number, s.start_block,
+		       s.confirmed_at, s.expires_at, s.created_at, s.updated_at
+		FROM payment_sessions_legacy s
+		LEFT JOIN tokens t ON t.symbol = s.token_symbol AND t.network_id = s.network_id
+	`)
+	if err != nil {
+		return err
+	}
+
+	type legacySession struct {
+		values   []interface{}
+		amount   float64
+		decimals int
+	}
+	var sessions []legacySession
+	for rows.Next() {
+		var (
+			id, blockNumber, startBlock                              sql.NullInt64
+			paymentID, productID, productName, currency, tokenSymbol string
+			networkID, receiverAddress, status                       string
+			senderAddress, qrCodeData, transactionHash               sql.NullString
+			confirmedAt, expiresAt, createdAt, updatedAt             sql.NullTime
+			amount                                                   float64
+			decimals                                                 int
+		)
+		if err := rows.Scan(&id, &paymentID, &productID, &productName, &amount, &decimals,
+			&currency, &tokenSymbol, &networkID, &receiverAddress, &senderAddress,
+			&status, &qrCodeData, &transactionHash, &blockNumber, &startBlock,
+			&confirmedAt, &expiresAt, &createdAt, &updatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		sessions = append(sessions, legacySession{
+			values: []interface{}{id, paymentID, productID, productName, currency, tokenSymbol, networkID,
+				receiverAddress, senderAddress, status, qrCodeData, transactionHash, blockNumber, startBlock,
+				confirmedAt, expiresAt, createdAt, updatedAt},
+			amount:   amount,
+			decimals: decimals,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		// Use the shortest decimal form of the float, dropping precision the token cannot represent
+		amount := strconv.FormatFloat(session.amount, 'f', -1, 64)
+		if dot := strings.IndexByte(amount, '.'); dot >= 0 && len(amount)-dot-1 > session.decimals {
+			amount = strings.TrimSuffix(amount[:dot+1+session.decimals], ".")
+		}
+		baseUnits, err := blockchain.ParseTokenAmount(amount, session.decimals)
+		if err != nil {
+			return fmt.Errorf("failed to convert amount %v of payment %v: %w", session.amount, session.values[1], err)
+		}
+
+		values := append(session.values, blockchain.FormatTokenAmount(baseUnits, session.decimals), baseUnits.String(), session.decimals)
+		if _, err := tx.Exec(`
+			INSERT INTO payment_sessions (
+				id, payment_id, product_id, product_name, currency, token_symbol, network_id,
+				receiver_address, sender_address, status, qr_code_data, transaction_hash, block_number, start_block,
+				confirmed_at, expires_at, created_at, updated_at,
+				amount, amount_base_units, token_decimals
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, values...); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DROP TABLE payment_sessions_legacy`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(paymentSessionsIndexes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Migrated %d payment session amounts", len(sessions))
+	return nil
+}
+
+// migrateTokensUniquePerNetwork rebuilds a tokens table whose symbol column is globally unique
+// so that symbols are only unique per network
+func migrateTokensUniquePerNetwork(db *sql.DB) error {
+	var tableSQL string
+	if err := db.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'tokens'`).Scan(&tableSQL); err != nil {
+		return err
+	}
+	if !strings.Contains(tableSQL, "symbol TEXT UNIQUE") {
+		return nil
+	}
+
+	log.Printf("Migrating tokens table to per-network symbols")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`ALTER TABLE tokens RENAME TO tokens_legacy`,
+		tokensTable,
+		`INSERT INTO tokens (id, symbol, name, contract_address, decimals, network_id, enabled, created_at, updated_at)
+		 SELECT id, symbol, name, contract_address, decimals, network_id, enabled, created_at, updated_at FROM tokens_legacy`,
+		`DROP TABLE tokens_legacy`,
+		tokensIndexes,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// migratePaymentTransfersUniqueLog rebuilds a payment_transfers table keyed per session,
+// adding the receiver and token contract of each transfer from its session
+func migratePaymentTransfersUniqueLog(db *sql.DB) error {
+	_, exists, err := columnType(db, "payment_transfers", "token_address")
+	if err != nil || exists {
+		return err
+	}
+
+	log.Printf("Migrating payment_transfers table to one row per transfer log")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`ALTER TABLE payment_transfers RENAME TO payment_transfers_legacy`,
+		`DROP INDEX IF EXISTS idx_payment_transfers_payment_id`,
+		paymentTransfersTable,
+		`INSERT OR IGNORE INTO payment_transfers (
+			id, payment_id, transaction_hash, log_index, sender_address, receiver_address, token_address,
+			amount_base_units, block_number, confirmations, confirmed, removed, created_at, updated_at
+		)
+		SELECT t.id, t.payment_id, t.transaction_hash, t.log_index, t.sender_address, ps.receiver_address,
+		       COALESCE(tk.contract_address, ''), t.amount_base_units, t.block_number, t.confirmations,
+		       t.confirmed, t.removed, t.created_at, t.updated_at
+		FROM payment_transfers_legacy t
+		JOIN payment_sessions ps ON ps.payment_id = t.payment_id
+		LEFT JOIN tokens tk ON tk.symbol = ps.token_symbol AND tk.network_id = ps.network_id
+		ORDER BY t.id`,
+		`DROP TABLE payment_transfers_legacy`,
+		paymentTransfersIndexes,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// addColumnIfMissing adds a column to an existing table unless it is already present
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	_, exists, err := columnType(db, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// columnType returns the declared type of a column and whether the table has that column
+func columnType(db *sql.DB, table, column string) (string, bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return "", false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			dflt       sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &dflt, &pk); err != nil {
+			return "", false, err
+		}
+		if name == column {
+			return columnType, true, nil
+		}
+	}
+	return "", false, rows.Err()
 }
\ No newline at end of file
@@ -1,12 +1,19 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
+	"regexp"
 	"sort"
 	"strconv"
 	"time"
 
+	"payment-backend/internal/blockchain"
 	"payment-backend/internal/config"
 	"payment-backend/internal/models"
 	"payment-backend/internal/service"
@@ -17,17 +24,21 @@ import (
 
 // Handler provides HTTP handlers
 type Handler struct {
-	paymentService *service.PaymentService
-	wsManager      *websocket.Manager
-	config         *config.Config
+	paymentService  *service.PaymentService
+	webhookService  *service.WebhookService
+	merchantService *service.MerchantService
+	wsManager       *websocket.Manager
+	config          *config.Config
 }
 
 // NewHandler creates a new handler
-func NewHandler(paymentService *service.PaymentService, wsManager *websocket.Manager, config *config.Config) *Handler {
+func NewHandler(paymentService *service.PaymentService, webhookService *service.WebhookService, merchantService *service.MerchantService, wsManager *websocket.Manager, config *config.Config) *Handler {
 	return &Handler{
-		paymentService: paymentService,
-		wsManager:      wsManager,
-		config:         config,
+		paymentService:  paymentService,
+		webhookService:  webhookService,
+		merchantService: merchantService,
+		wsManager:       wsManager,
+		config:          config,
 	}
 }
 
@@ -38,8 +49,11 @@ func NewHandler(paymentService *service.PaymentService, wsManager *websocket.Man
 // @Accept json
 // @Produce json
 // @Param request body CreatePaymentRequest true "Payment creation request"
+// @Param Idempotency-Key header string false "Replays the original response when the same request is retried"
 // @Success 201 {object} PaymentSessionResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/payments [post]
 func (h *Handler) CreatePaymentSession(c *gin.Context) {
@@ -53,10 +67,10 @@ func (h *Handler) CreatePaymentSession(c *gin.Context) {
 		return
 	}
 
-	// Validate required fields
-	if req.ProductID == "" || req.ProductName == "" || req.Amount <= 0 || 
+	// Validate required fields; the receiver address may be derived by the service instead
+	if req.ProductID == "" || req.ProductName == "" || req.Amount == "" || 
 	   req.Currency == "" || req.TokenSymbol == "" || req.NetworkID == "" || 
-	   req.ReceiverAddress == "" {
+	   (req.ReceiverAddress == "" && !h.paymentService.DerivesReceiverAddresses()) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Code:    http.StatusBadRequest,
 			Message: "Missing required fields",
@@ -65,16 +79,107 @@ func (h *Handler) CreatePaymentSession(c *gin.Context) {
 		return
 	}
 
+	merchantID := currentMerchant(c).MerchantID
+
+	// A retried request with the same Idempotency-Key gets the original response instead of a second session
+	idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+	created := false
+	if idempotencyKey != "" {
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid Idempotency-Key",
+				Details: fmt.Sprintf("the key must be at most %d characters", maxIdempotencyKeyLength),
+			})
+			return
+		}
+
+		record, err := h.paymentService.BeginIdempotentRequest(c.Request.Context(), merchantID, idempotencyKey, hashCreatePaymentRequest(&req))
+		if errors.Is(err, service.ErrIdempotencyKeyReused) || errors.Is(err, service.ErrIdempotencyKeyInProgress) {
+			c.JSON(http.StatusConflict, ErrorResponse{
+				Code:    http.StatusConflict,
+				Message: "Idempotency-Key conflict",
+				Details: err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Code:    http.StatusInternalServerError,
+				Message: "Failed to create payment session",
+				Details: err.Error(),
+			})
+			return
+		}
+		if record != nil {
+			c.Header(IdempotentReplayedHeader, "true")
+
+			// The stored response has no payment token; issue a fresh one as for the original request
+			var response PaymentSessionResponse
+			if err := json.Unmarshal([]byte(*record.ResponseBody), &response); err != nil || response.PaymentID == "" {
+				c.Data(*record.ResponseStatus, "application/json; charset=utf-8", []byte(*record.ResponseBody))
+				return
+			}
+			h.attachPaymentToken(&response)
+			c.JSON(*record.ResponseStatus, response)
+			return
+		}
+
+		// Free the key if no session is created, so the request can be retried
+		defer func() {
+			if !created {
+				h.paymentService.ReleaseIdempotentRequest(c.Request.Context(), merchantID, idempotencyKey)
+			}
+		}()
+	}
+
 	// Create payment session
 	session, err := h.paymentService.CreatePaymentSession(c.Request.Context(), &service.CreatePaymentRequest{
+		MerchantID:      merchantID,
 		ProductID:       req.ProductID,
 		ProductName:     req.ProductName,
-		Amount:          req.Amount,
+		Amount:          req.Amount.String(),
 		Currency:        req.Currency,
 		TokenSymbol:     req.TokenSymbol,
 		NetworkID:       req.NetworkID,
 		ReceiverAddress: req.ReceiverAddress,
+		MerchantOrderID: req.MerchantOrderID,
+		Metadata:        req.Metadata,
+		SuccessURL:      req.SuccessURL,
+		CancelURL:       req.CancelURL,
 	})
+	if errors.Is(err, service.ErrInvalidOrderDetails) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid order details",
+			Details: err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, service.ErrDuplicateMerchantOrder) {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Code:    http.StatusConflict,
+			Message: "Merchant order already has a payment session",
+			Details: err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, service.ErrUnsupportedNetwork) || errors.Is(err, service.ErrUnsupportedToken) || errors.Is(err, service.ErrInvalidAmount) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid payment amount, token or network",
+			Details: err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, service.ErrNoUniqueAmount) {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Code:    http.StatusConflict,
+			Message: "Too many open payments for this amount and receiver",
+			Details: err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Code:    http.StatusInternalServerError,
@@ -84,7 +189,33 @@ func (h *Handler) CreatePaymentSession(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, toPaymentSessionResponse(session))
+	created = true
+
+	response := toPaymentSessionResponse(session)
+
+	if idempotencyKey != "" {
+		// The response is stored without the payment token, which a replay issues again.
+		// If it cannot be stored the key stays reserved until its lease ends.
+		body, err := json.Marshal(response)
+		if err == nil {
+			err = h.paymentService.CompleteIdempotentRequest(c.Request.Context(), merchantID, idempotencyKey, session.PaymentID, http.StatusCreated, body)
+		}
+		if err != nil {
+			fmt.Printf("Warning: Failed to store idempotent response for %s: %v\n", session.PaymentID, err)
+		}
+	}
+
+	// The payment token lets the customer's browser follow this session without the API key
+	h.attachPaymentToken(&response)
+	c.JSON(http.StatusCreated, response)
+}
+
+// hashCreatePaymentRequest returns the hex SHA-256 of a parsed create request, so formatting
+// differences in a retried body do not count as a different request
+func hashCreatePaymentRequest(req *CreatePaymentRequest) string {
+	body, _ := json.Marshal(req)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
 }
 
 // GetPaymentSession retrieves a payment session and validates blockchain status if needed
@@ -93,7 +224,9 @@ func (h *Handler) CreatePaymentSession(c *gin.Context) {
 // @Tags payments
 // @Produce json
 // @Param paymentId path string true "Payment ID"
+// @Param token query string false "Payment token, unless the merchant API key is sent"
 // @Success 200 {object} PaymentSessionResponse
+// @Failure 401 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/payments/{paymentId} [get]
@@ -117,8 +250,8 @@ func (h *Handler) GetPaymentSession(c *gin.Context) {
 		return
 	}
 
-	// For created or pending payments, validate blockchain status
-	if session.Status == models.PaymentCreated || session.Status == models.PaymentPending {
+	// For created, pending or confirming payments, validate blockchain status
+	if session.Status == models.PaymentCreated || session.Status == models.PaymentPending || session.Status == models.PaymentConfirming {
 		updatedSession, err := h.paymentService.ValidatePaymentIfNeeded(c.Request.Context(), session)
 		if err != nil {
 			// Log the error but don't fail the request - return the original session
@@ -128,9 +261,406 @@ func (h *Handler) GetPaymentSession(c *gin.Context) {
 		}
 	}
 
+	// Merchants get a fresh payment token to hand to the customer
+	response := toPaymentSessionResponse(session)
+	if currentMerchant(c) != nil {
+		h.attachPaymentToken(&response)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetPaymentSessionByMerchantOrderID looks up the calling merchant's payment session for one of its orders
+// @Summary Find a payment session by merchant order ID
+// @Description Retrieve the payment session the authenticated merchant created for an order in its own system
+// @Tags payments
+// @Produce json
+// @Param merchantOrderId query string true "Merchant order ID given when the session was created"
+// @Success 200 {object} PaymentSessionResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments [get]
+func (h *Handler) GetPaymentSessionByMerchantOrderID(c *gin.Context) {
+	merchantOrderID := c.Query("merchantOrderId")
+	if merchantOrderID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "merchantOrderId is required",
+		})
+		return
+	}
+
+	session, err := h.paymentService.GetPaymentSessionByMerchantOrderID(c.Request.Context(), currentMerchant(c).MerchantID, merchantOrderID)
+	if errors.Is(err, service.ErrPaymentNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    http.StatusNotFound,
+			Message: "Payment session not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get payment session",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	response := toPaymentSessionResponse(session)
+	h.attachPaymentToken(&response)
+	c.JSON(http.StatusOK, response)
+}
+
+// AcceptLatePayment accepts a payment that arrived in the grace window after its session expired
+// @Summary Accept a late payment
+// @Description Settle a paid_late session as paid or overpaid. Merchants that do not want the funds request a refund instead.
+// @Tags payments
+// @Produce json
+// @Param paymentId path string true "Payment ID"
+// @Success 200 {object} PaymentSessionResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments/{paymentId}/accept [post]
+func (h *Handler) AcceptLatePayment(c *gin.Context) {
+	session, err := h.paymentService.AcceptLatePayment(c.Request.Context(), currentMerchant(c).MerchantID, c.Param("paymentId"))
+	if errors.Is(err, service.ErrPaymentNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    http.StatusNotFound,
+			Message: "Payment session not found",
+		})
+		return
+	}
+	if errors.Is(err, service.ErrNotLatePayment) {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Code:    http.StatusConflict,
+			Message: "Payment session was not paid late",
+			Details: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to accept late payment",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, toPaymentSessionResponse(session))
+}
+
+// CancelPayment cancels an open payment session
+// @Summary Cancel a payment session
+// @Description Cancel a created or pending payment session of the authenticated merchant. The customer's WebSocket receives a final update and is closed. Funds the session received, or that arrive after cancellation, are flagged for refund.
+// @Tags payments
+// @Produce json
+// @Param paymentId path string true "Payment ID"
+// @Success 200 {object} PaymentSessionResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments/{paymentId}/cancel [post]
+func (h *Handler) CancelPayment(c *gin.Context) {
+	session, err := h.paymentService.CancelPayment(c.Request.Context(), currentMerchant(c).MerchantID, c.Param("paymentId"))
+	if errors.Is(err, service.ErrPaymentNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    http.StatusNotFound,
+			Message: "Payment session not found",
+		})
+		return
+	}
+	if errors.Is(err, service.ErrCancelNotAllowed) {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Code:    http.StatusConflict,
+			Message: "Payment session cannot be cancelled",
+			Details: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to cancel payment session",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, toPaymentSessionResponse(session))
+}
+
+// attachPaymentToken issues a payment token for a session response
+func (h *Handler) attachPaymentToken(response *PaymentSessionResponse) {
+	token, expiresAt := h.paymentService.IssuePaymentToken(response.PaymentID)
+	response.PaymentToken = token
+	response.PaymentTokenExpiresAt = &expiresAt
+}
+
+// ClaimPayment credits a customer-submitted transaction to a payment session
+// @Summary Claim a payment with a transaction hash
+// @Description Validates a transaction the customer sent for a payment session and settles the session with it
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param paymentId path string true "Payment ID"
+// @Param request body ClaimPaymentRequest true "Payment claim request"
+// @Success 200 {object} PaymentSessionResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments/{paymentId}/claim [post]
+func (h *Handler) ClaimPayment(c *gin.Context) {
+	paymentID := c.Param("paymentId")
+	if paymentID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Payment ID is required",
+		})
+		return
+	}
+
+	var req ClaimPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request data",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	if !txHashPattern.MatchString(req.TransactionHash) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid transaction hash",
+			Details: "transactionHash must be a 0x-prefixed 32-byte hex string",
+		})
+		return
+	}
+
+	session, err := h.paymentService.ClaimPayment(c.Request.Context(), paymentID, req.TransactionHash)
+	switch {
+	case errors.Is(err, service.ErrPaymentNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    http.StatusNotFound,
+			Message: "Payment session not found",
+			Details: err.Error(),
+		})
+		return
+	case errors.Is(err, service.ErrPaymentClosed) || errors.Is(err, service.ErrTransactionAlreadyUsed):
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Code:    http.StatusConflict,
+			Message: "Payment cannot be claimed with this transaction",
+			Details: err.Error(),
+		})
+		return
+	case errors.Is(err, service.ErrClaimRejected):
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{
+			Code:    http.StatusUnprocessableEntity,
+			Message: "Transaction does not pay this session",
+			Details: err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to claim payment",
+			Details: err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, toPaymentSessionResponse(session))
 }
 
+// GetPaymentQRCodePNG renders the EIP-681 payment URI of a session as a PNG QR code
+// @Summary Get payment QR code (PNG)
+// @Description Render the session's EIP-681 payment URI as a PNG QR code that wallets scan to prefill the ERC-20 transfer
+// @Tags payments
+// @Produce png
+// @Param paymentId path string true "Payment ID"
+// @Param size query int false "Image size in pixels (128-1024, default 256)"
+// @Success 200 {file} binary
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments/{paymentId}/qr.png [get]
+func (h *Handler) GetPaymentQRCodePNG(c *gin.Context) {
+	session, ok := h.paymentSessionForQRCode(c)
+	if !ok {
+		return
+	}
+
+	size, _ := strconv.Atoi(c.Query("size"))
+	png, err := h.paymentService.RenderPaymentQRCode(c.Request.Context(), session, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to render QR code",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+// GetPaymentQRCodeSVG renders the EIP-681 payment URI of a session as an SVG QR code
+// @Summary Get payment QR code (SVG)
+// @Description Render the session's EIP-681 payment URI as an SVG QR code that wallets scan to prefill the ERC-20 transfer
+// @Tags payments
+// @Produce image/svg+xml
+// @Param paymentId path string true "Payment ID"
+// @Param size query int false "Image size in pixels (128-1024, default 256)"
+// @Success 200 {string} string
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments/{paymentId}/qr.svg [get]
+func (h *Handler) GetPaymentQRCodeSVG(c *gin.Context) {
+	session, ok := h.paymentSessionForQRCode(c)
+	if !ok {
+		return
+	}
+
+	size, _ := strconv.Atoi(c.Query("size"))
+	svg, err := h.paymentService.RenderPaymentQRCodeSVG(c.Request.Context(), session, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to render QR code",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, "image/svg+xml", []byte(svg))
+}
+
+// paymentSessionForQRCode loads the session of a QR code request, writing the error response if it fails
+func (h *Handler) paymentSessionForQRCode(c *gin.Context) (*models.PaymentSession, bool) {
+	paymentID := c.Param("paymentId")
+	if paymentID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Payment ID is required",
+		})
+		return nil, false
+	}
+
+	session, err := h.paymentService.GetPaymentSession(c.Request.Context(), paymentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    http.StatusNotFound,
+			Message: "Payment session not found",
+			Details: err.Error(),
+		})
+		return nil, false
+	}
+
+	return session, true
+}
+
+// GetPaymentTransfers retrieves the on-chain transfers recorded for a payment session
+// @Summary Get payment transfers
+// @Description Retrieve every on-chain transfer matched to a payment session, including transfers removed by a reorg
+// @Tags payments
+// @Produce json
+// @Param paymentId path string true "Payment ID"
+// @Success 200 {object} PaymentTransfersResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments/{paymentId}/transfers [get]
+func (h *Handler) GetPaymentTransfers(c *gin.Context) {
+	paymentID := c.Param("paymentId")
+	if paymentID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Payment ID is required",
+		})
+		return
+	}
+
+	session, err := h.paymentService.GetPaymentSession(c.Request.Context(), paymentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    http.StatusNotFound,
+			Message: "Payment session not found",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	transfers, err := h.paymentService.GetPaymentTransfers(c.Request.Context(), paymentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get payment transfers",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	response := PaymentTransfersResponse{
+		Transfers: make([]*PaymentTransferResponse, 0, len(transfers)),
+	}
+	for _, transfer := range transfers {
+		response.Transfers = append(response.Transfers, toPaymentTransferResponse(transfer, session.TokenDecimals))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetPaymentStatusHistory retrieves the status transitions of a payment session
+// @Summary Get payment status history
+// @Description Retrieve every status transition of a payment session with its reason and source (watcher, claim, sweeper, merchant, admin or debug)
+// @Tags payments
+// @Produce json
+// @Param paymentId path string true "Payment ID"
+// @Success 200 {object} PaymentStatusHistoryResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments/{paymentId}/history [get]
+func (h *Handler) GetPaymentStatusHistory(c *gin.Context) {
+	paymentID := c.Param("paymentId")
+	if paymentID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Payment ID is required",
+		})
+		return
+	}
+
+	if _, err := h.paymentService.GetPaymentSession(c.Request.Context(), paymentID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    http.StatusNotFound,
+			Message: "Payment session not found",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	history, err := h.paymentService.GetPaymentStatusHistory(c.Request.Context(), paymentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get payment status history",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	if history == nil {
+		history = []*models.PaymentStatusHistory{}
+	}
+	c.JSON(http.StatusOK, PaymentStatusHistoryResponse{History: history})
+}
 
 // GetTokens retrieves all supported tokens
 // @Summary Get supported tokens
@@ -182,14 +712,36 @@ func (h *Handler) GetNetworks(c *gin.Context) {
 
 // GetPaymentStats retrieves payment statistics
 // @Summary Get payment statistics
-// @Description Retrieve payment statistics and analytics
+// @Description Retrieve statistics of the payment sessions created in a time window, broken down per token, period, merchant and network
 // @Tags statistics
 // @Produce json
+// @Param from query string false "Window start, RFC 3339 (default: 24 hours before to for hourly buckets, 30 days for daily ones)"
+// @Param to query string false "Window end, RFC 3339 (default: now)"
+// @Param granularity query string false "Bucket width of payments_by_period: hour or day (default: day)"
 // @Success 200 {object} PaymentStatsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/stats/payments [get]
 func (h *Handler) GetPaymentStats(c *gin.Context) {
-	stats, err := h.paymentService.GetPaymentStats(c.Request.Context())
+	from, ok := timeQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := timeQuery(c, "to")
+	if !ok {
+		return
+	}
+
+	stats, err := h.paymentService.GetPaymentStats(c.Request.Context(), from, to, models.StatsGranularity(c.Query("granularity")))
+	if errors.Is(err, service.ErrInvalidStatsRange) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid stats range",
+			Details: err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Code:    http.StatusInternalServerError,
@@ -201,6 +753,9 @@ func (h *Handler) GetPaymentStats(c *gin.Context) {
 
 	// Convert models.PaymentStats to PaymentStatsResponse
 	response := PaymentStatsResponse{
+		From:                stats.From,
+		To:                  stats.To,
+		Granularity:         string(stats.Granularity),
 		TotalPayments:       stats.TotalPayments,
 		SuccessfulPayments:  stats.SuccessfulPayments,
 		FailedPayments:      stats.FailedPayments,
@@ -209,11 +764,31 @@ func (h *Handler) GetPaymentStats(c *gin.Context) {
 		PaymentsByPeriod:    stats.PaymentsByPeriod,
 		AverageProcessingTime: stats.AverageProcessingTime,
 		FailureReasons:      stats.FailureReasons,
+		PaymentsByMerchant:  stats.PaymentsByMerchant,
+		PaymentsByNetwork:   stats.PaymentsByNetwork,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// timeQuery parses an optional RFC 3339 query parameter, responding with 400 when it is malformed
+func timeQuery(c *gin.Context, name string) (time.Time, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return time.Time{}, true
+	}
+	parsed, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid " + name + " time",
+			Details: name + " must be an RFC 3339 time such as 2024-01-02T15:04:05Z",
+		})
+		return time.Time{}, false
+	}
+	return parsed, true
+}
+
 // GetMonitoringStats retrieves monitoring statistics
 // @Summary Get monitoring performance statistics
 // @Description Retrieve blockchain monitoring and performance statistics
@@ -359,6 +934,7 @@ func (h *Handler) GetWebSocketMessages(c *gin.Context) {
 	for _, msg := range blockchainMessages {
 		enrichedMsg := map[string]interface{}{
 			"source":    "blockchain",
+			"networkId": msg.NetworkID,
 			"type":      msg.Type,
 			"direction": msg.Direction,
 			"data":      msg.Data,
@@ -390,24 +966,56 @@ func (h *Handler) GetWebSocketMessages(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// Idempotency headers of POST /api/v1/payments
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header
+const maxIdempotencyKeyLength = 255
+
 // CreatePaymentRequest represents the request body for creating a payment session
 type CreatePaymentRequest struct {
 	ProductID       string  `json:"productId"`
 	ProductName     string  `json:"productName"`
-	Amount          float64 `json:"amount"`
+	Amount          json.Number `json:"amount"` // Decimal amount in whole tokens, as a number or string
 	Currency        string  `json:"currency"`
 	TokenSymbol     string  `json:"tokenSymbol"`
 	NetworkID       string  `json:"networkId"`
 	ReceiverAddress string  `json:"receiverAddress"`
+	MerchantOrderID string  `json:"merchantOrderId,omitempty"` // Order reference in the merchant's system, unique per merchant
+	Metadata        json.RawMessage `json:"metadata,omitempty" swaggertype:"object"` // Free-form JSON object, at most 4 KB
+	SuccessURL      string  `json:"successUrl,omitempty"`
+	CancelURL       string  `json:"cancelUrl,omitempty"`
+}
+
+
+// ClaimPaymentRequest represents the request to claim a payment with a transaction hash
+type ClaimPaymentRequest struct {
+	TransactionHash string `json:"transactionHash"`
 }
 
+// txHashPattern matches a 0x-prefixed 32-byte transaction hash
+var txHashPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
 
 // PaymentSessionResponse represents the response for a payment session
 type PaymentSessionResponse struct {
 	PaymentID       string     `json:"paymentId"`
+	MerchantOrderID *string    `json:"merchantOrderId,omitempty"`
 	ProductID       string     `json:"productId"`
 	ProductName     string     `json:"productName"`
-	Amount          float64    `json:"amount"`
+	Metadata        json.RawMessage `json:"metadata,omitempty" swaggertype:"object"`
+	SuccessURL      *string    `json:"successUrl,omitempty"`
+	CancelURL       *string    `json:"cancelUrl,omitempty"`
+	Amount          json.Number `json:"amount"`
+	AmountBaseUnits string     `json:"amountBaseUnits"`
+	TokenDecimals   int        `json:"tokenDecimals"`
+	PayAmount          json.Number `json:"payAmount"` // Exact amount to transfer, including any unique offset
+	PayAmountBaseUnits string      `json:"payAmountBaseUnits"`
+	DerivationIndex *int64     `json:"derivationIndex,omitempty"`
+	AmountReceived  json.Number `json:"amountReceived"`
+	AmountRemaining json.Number `json:"amountRemaining"`
 	Currency        string     `json:"currency"`
 	TokenSymbol     string     `json:"tokenSymbol"`
 	NetworkID       string     `json:"networkId"`
@@ -420,6 +1028,35 @@ type PaymentSessionResponse struct {
 	ConfirmedAt     *time.Time `json:"confirmedAt,omitempty"`
 	ExpiresAt       time.Time  `json:"expiresAt"`
 	CreatedAt       time.Time  `json:"createdAt"`
+	PaymentToken          string     `json:"paymentToken,omitempty"` // Grants the customer read access to this session
+	PaymentTokenExpiresAt *time.Time `json:"paymentTokenExpiresAt,omitempty"`
+}
+
+// PaymentTransferResponse represents an on-chain transfer credited to a payment session
+type PaymentTransferResponse struct {
+	TransactionHash string      `json:"transactionHash"`
+	LogIndex        uint        `json:"logIndex"`
+	SenderAddress   string      `json:"senderAddress"`
+	ReceiverAddress string      `json:"receiverAddress"`
+	TokenAddress    string      `json:"tokenAddress"`
+	Amount          json.Number `json:"amount"`
+	AmountBaseUnits string      `json:"amountBaseUnits"`
+	BlockNumber     int64       `json:"blockNumber"`
+	Confirmations   int         `json:"confirmations"`
+	Confirmed       bool        `json:"confirmed"`
+	Removed         bool        `json:"removed"`
+	CreatedAt       time.Time   `json:"createdAt"`
+	UpdatedAt       time.Time   `json:"updatedAt"`
+}
+
+// PaymentTransfersResponse represents the response for a payment session's transfers
+type PaymentTransfersResponse struct {
+	Transfers []*PaymentTransferResponse `json:"transfers"`
+}
+
+// PaymentStatusHistoryResponse represents the payment status history response
+type PaymentStatusHistoryResponse struct {
+	History []*models.PaymentStatusHistory `json:"history"`
 }
 
 // TokensResponse represents the response for tokens
@@ -444,6 +1081,9 @@ type NetworksResponse struct {
 
 // PaymentStatsResponse represents the response for payment statistics
 type PaymentStatsResponse struct {
+	From                time.Time          `json:"from"`
+	To                  time.Time          `json:"to"`
+	Granularity         string             `json:"granularity"`
 	TotalPayments       int                `json:"total_payments"`
 	SuccessfulPayments  int                `json:"successful_payments"`
 	FailedPayments      int                `json:"failed_payments"`
@@ -452,6 +1092,8 @@ type PaymentStatsResponse struct {
 	PaymentsByPeriod    map[string]int     `json:"payments_by_period"`
 	AverageProcessingTime float64          `json:"average_processing_time"`
 	FailureReasons      map[string]int     `json:"failure_reasons"`
+	PaymentsByMerchant  map[string]*models.PaymentBreakdown `json:"payments_by_merchant"`
+	PaymentsByNetwork   map[string]*models.PaymentBreakdown `json:"payments_by_network"`
 }
 
 // MonitoringStatsResponse represents the response for monitoring statistics
@@ -499,6 +1141,8 @@ type NetworkResponse struct {
 	RPCURL        string  `json:"rpcUrl"`
 	WebsocketURL  *string `json:"websocketUrl,omitempty"`
 	BlockExplorer *string `json:"blockExplorer,omitempty"`
+	RequiredConfirmations int `json:"requiredConfirmations"`
+	NativeCurrency string `json:"nativeCurrency"`
 	Enabled       bool    `json:"enabled"`
 }
 
@@ -509,13 +1153,53 @@ type ErrorResponse struct {
 	Details string `json:"details,omitempty"`
 }
 
+// toPaymentTransferResponse converts a models.PaymentTransfer to PaymentTransferResponse
+func toPaymentTransferResponse(transfer *models.PaymentTransfer, decimals int) *PaymentTransferResponse {
+	amount := transfer.AmountBaseUnits
+	if value, ok := new(big.Int).SetString(transfer.AmountBaseUnits, 10); ok {
+		amount = blockchain.FormatTokenAmount(value, decimals)
+	}
+	return &PaymentTransferResponse{
+		TransactionHash: transfer.TransactionHash,
+		LogIndex:        transfer.LogIndex,
+		SenderAddress:   transfer.SenderAddress,
+		ReceiverAddress: transfer.ReceiverAddress,
+		TokenAddress:    transfer.TokenAddress,
+		Amount:          json.Number(amount),
+		AmountBaseUnits: transfer.AmountBaseUnits,
+		BlockNumber:     transfer.BlockNumber,
+		Confirmations:   transfer.Confirmations,
+		Confirmed:       transfer.Confirmed,
+		Removed:         transfer.Removed,
+		CreatedAt:       transfer.CreatedAt,
+		UpdatedAt:       transfer.UpdatedAt,
+	}
+}
+
 // toPaymentSessionResponse converts a models.PaymentSession to PaymentSessionResponse
 func toPaymentSessionResponse(session *models.PaymentSession) PaymentSessionResponse {
+	amountReceived, amountRemaining := service.AmountReceivedAndRemaining(session)
+	payAmount, payAmountBaseUnits := service.SessionPayAmount(session)
+	var metadata json.RawMessage
+	if session.Metadata != nil {
+		metadata = json.RawMessage(*session.Metadata)
+	}
 	return PaymentSessionResponse{
 		PaymentID:       session.PaymentID,
+		MerchantOrderID: session.MerchantOrderID,
 		ProductID:       session.ProductID,
 		ProductName:     session.ProductName,
-		Amount:          session.Amount,
+		Metadata:        metadata,
+		SuccessURL:      session.SuccessURL,
+		CancelURL:       session.CancelURL,
+		Amount:          json.Number(session.Amount),
+		AmountBaseUnits: session.AmountBaseUnits,
+		TokenDecimals:   session.TokenDecimals,
+		PayAmount:          json.Number(payAmount),
+		PayAmountBaseUnits: payAmountBaseUnits,
+		DerivationIndex: session.DerivationIndex,
+		AmountReceived:  json.Number(amountReceived),
+		AmountRemaining: json.Number(amountRemaining),
 		Currency:        session.Currency,
 		TokenSymbol:     session.TokenSymbol,
 		NetworkID:       session.NetworkID,
@@ -558,6 +1242,8 @@ func toNetworksResponse(networks []*models.Network) []*NetworkResponse {
 			RPCURL:        network.RPCURL,
 			WebsocketURL:  network.WebsocketURL,
 			BlockExplorer: network.BlockExplorer,
+			RequiredConfirmations: network.RequiredConfirmations,
+			NativeCurrency: network.NativeCurrency,
 			Enabled:       network.Enabled,
 		}
 	}
@@ -566,13 +1252,15 @@ func toNetworksResponse(networks []*models.Network) []*NetworkResponse {
 
 // DebugSimulatePayment simulates a payment success for testing purposes
 // @Summary Simulate payment success
-// @Description Sends a payment success message via WebSocket for testing
+// @Description Sends a payment success message via WebSocket for testing. Registered only when DEBUG_MODE is true and requires the admin API key.
 // @Tags debug
 // @Accept json
 // @Produce json
 // @Param paymentId path string true "Payment ID"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /debug/payments/{paymentId}/simulate-success [post]
 func (h *Handler) DebugSimulatePayment(c *gin.Context) {
@@ -602,7 +1290,16 @@ func (h *Handler) DebugSimulatePayment(c *gin.Context) {
 	transactionHash := "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
 	blockNumber := int64(12345678)
 
-	err = h.paymentService.UpdatePaymentStatus(c.Request.Context(), paymentID, models.PaymentPaid, &senderAddress, &transactionHash, &blockNumber, &now)
+	change := models.StatusChange{Reason: "simulated payment", Source: models.SourceDebug}
+	err = h.paymentService.UpdatePaymentStatus(c.Request.Context(), paymentID, payment.Status, models.PaymentPaid, change, &senderAddress, &transactionHash, &blockNumber, &now)
+	if errors.Is(err, service.ErrInvalidTransition) || errors.Is(err, service.ErrStatusConflict) {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Code:    http.StatusConflict,
+			Message: "Payment status does not allow this",
+			Details: err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Code:    http.StatusInternalServerError,
@@ -619,7 +1316,7 @@ func (h *Handler) DebugSimulatePayment(c *gin.Context) {
 		transactionHash,
 		blockNumber,
 		12,
-		fmt.Sprintf("%.6f", payment.Amount),
+		payment.Amount,
 		payment.TokenSymbol,
 	)
 
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"payment-backend/internal/models"
+	"payment-backend/internal/service"
+)
+
+// CreateMerchantRequest represents the request to create a merchant
+type CreateMerchantRequest struct {
+	Name string `json:"name"`
+}
+
+// MerchantResponse represents a merchant
+type MerchantResponse struct {
+	MerchantID   string    `json:"merchantId"`
+	Name         string    `json:"name"`
+	APIKey       string    `json:"apiKey,omitempty"` // Only returned when the merchant is created
+	APIKeyPrefix string    `json:"apiKeyPrefix"`
+	Enabled      bool      `json:"enabled"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// MerchantsResponse represents the merchants response
+type MerchantsResponse struct {
+	Merchants []*MerchantResponse `json:"merchants"`
+}
+
+// CreateMerchant creates a merchant with a new API key
+// @Summary Create merchant
+// @Description Create a merchant and its API key. The key is only returned here; only its hash is stored.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body CreateMerchantRequest true "Merchant"
+// @Success 201 {object} MerchantResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/merchants [post]
+func (h *Handler) CreateMerchant(c *gin.Context) {
+	var req CreateMerchantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	merchant, apiKey, err := h.merchantService.CreateMerchant(c.Request.Context(), req.Name)
+	if errors.Is(err, service.ErrMerchantNameRequired) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Merchant name is required",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to create merchant",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	response := toMerchantResponse(merchant)
+	response.APIKey = apiKey
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetMerchants retrieves all merchants
+// @Summary Get merchants
+// @Description Retrieve all merchants without their API keys
+// @Tags admin
+// @Produce json
+// @Success 200 {object} MerchantsResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/merchants [get]
+func (h *Handler) GetMerchants(c *gin.Context) {
+	merchants, err := h.merchantService.GetMerchants(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get merchants",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	response := MerchantsResponse{
+		Merchants: make([]*MerchantResponse, 0, len(merchants)),
+	}
+	for _, merchant := range merchants {
+		response.Merchants = append(response.Merchants, toMerchantResponse(merchant))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// toMerchantResponse converts a models.Merchant to MerchantResponse without its API key
+func toMerchantResponse(merchant *models.Merchant) *MerchantResponse {
+	return &MerchantResponse{
+		MerchantID:   merchant.MerchantID,
+		Name:         merchant.Name,
+		APIKeyPrefix: merchant.APIKeyPrefix,
+		Enabled:      merchant.Enabled,
+		CreatedAt:    merchant.CreatedAt,
+	}
+}
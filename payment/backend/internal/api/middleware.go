@@ -0,0 +1,156 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"payment-backend/internal/models"
+	"payment-backend/internal/service"
+)
+
+// merchantContextKey stores the authenticated merchant in the Gin context
+const merchantContextKey = "merchant"
+
+// PaymentTokenHeader carries a payment token; browsers opening a WebSocket pass it as the token query parameter instead
+const PaymentTokenHeader = "X-Payment-Token"
+
+// RequireMerchant rejects requests without a valid merchant API key and stores the merchant in the context.
+// The key is sent as "Authorization: Bearer <key>" or in the X-API-Key header.
+func (h *Handler) RequireMerchant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := h.authenticateMerchant(c); !ok {
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin rejects requests without the operator API key configured in ADMIN_API_KEY
+func (h *Handler) RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.config.AdminAPIKey == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{
+				Code:    http.StatusForbidden,
+				Message: "Admin API is disabled",
+				Details: "set ADMIN_API_KEY to enable it",
+			})
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(apiKeyFromRequest(c)), []byte(h.config.AdminAPIKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{
+				Code:    http.StatusUnauthorized,
+				Message: "Invalid admin API key",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePaymentAccess lets customers read a payment session with its payment token, and merchants
+// with the API key of the merchant that created it. Other sessions are reported as not found.
+func (h *Handler) RequirePaymentAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		paymentID := c.Param("paymentId")
+
+		if token := paymentTokenFromRequest(c); token != "" {
+			if err := h.paymentService.VerifyPaymentToken(paymentID, token); err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{
+					Code:    http.StatusUnauthorized,
+					Message: "Invalid or expired payment token",
+				})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		merchant, ok := h.authenticateMerchant(c)
+		if !ok {
+			return
+		}
+
+		session, err := h.paymentService.GetPaymentSession(c.Request.Context(), paymentID)
+		if err != nil && !errors.Is(err, service.ErrPaymentNotFound) {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{
+				Code:    http.StatusInternalServerError,
+				Message: "Failed to get payment session",
+				Details: err.Error(),
+			})
+			return
+		}
+		if err != nil || session.MerchantID == nil || *session.MerchantID != merchant.MerchantID {
+			c.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{
+				Code:    http.StatusNotFound,
+				Message: "Payment session not found",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// authenticateMerchant resolves the request's API key to a merchant, aborting with 401 when it is missing or invalid
+func (h *Handler) authenticateMerchant(c *gin.Context) (*models.Merchant, bool) {
+	apiKey := apiKeyFromRequest(c)
+	if apiKey == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{
+			Code:    http.StatusUnauthorized,
+			Message: "API key is required",
+		})
+		return nil, false
+	}
+
+	merchant, err := h.merchantService.Authenticate(c.Request.Context(), apiKey)
+	if errors.Is(err, service.ErrInvalidAPIKey) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{
+			Code:    http.StatusUnauthorized,
+			Message: "Invalid API key",
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to authenticate",
+			Details: err.Error(),
+		})
+		return nil, false
+	}
+
+	c.Set(merchantContextKey, merchant)
+	return merchant, true
+}
+
+// currentMerchant returns the merchant authenticated for the request, or nil for customer requests
+func currentMerchant(c *gin.Context) *models.Merchant {
+	if value, ok := c.Get(merchantContextKey); ok {
+		if merchant, ok := value.(*models.Merchant); ok {
+			return merchant
+		}
+	}
+	return nil
+}
+
+// apiKeyFromRequest returns the API key from the Authorization bearer token or the X-API-Key header
+func apiKeyFromRequest(c *gin.Context) string {
+	if auth := c.GetHeader("Authorization"); auth != "" {
+		if scheme, key, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(key)
+		}
+	}
+	return c.GetHeader("X-API-Key")
+}
+
+// paymentTokenFromRequest returns the payment token from the X-Payment-Token header or the token query parameter
+func paymentTokenFromRequest(c *gin.Context) string {
+	if token := c.GetHeader(PaymentTokenHeader); token != "" {
+		return token
+	}
+	return c.Query("token")
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"payment-backend/internal/models"
+	"payment-backend/internal/service"
+)
+
+// CreateRefundRequest represents the request to refund a payment session
+type CreateRefundRequest struct {
+	Amount string `json:"amount,omitempty"` // Decimal amount in whole tokens; defaults to everything not yet refunded
+	Reason string `json:"reason,omitempty"`
+}
+
+// RejectRefundRequest represents an operator's reason for declining a refund
+type RejectRefundRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// SubmitRefundTransactionRequest represents the transaction an operator sent for an approved refund
+type SubmitRefundTransactionRequest struct {
+	TransactionHash string `json:"transactionHash"`
+}
+
+// RefundsResponse represents the refunds response
+type RefundsResponse struct {
+	Refunds []*models.Refund `json:"refunds"`
+}
+
+// RequestRefund requests a refund of a closed payment session to its payer
+// @Summary Request refund
+// @Description Request that funds received by a closed payment session are sent back to its sender address. An operator approves the refund and submits its transaction.
+// @Tags refunds
+// @Accept json
+// @Produce json
+// @Param paymentId path string true "Payment ID"
+// @Param request body CreateRefundRequest false "Refund"
+// @Success 201 {object} models.Refund
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments/{paymentId}/refunds [post]
+func (h *Handler) RequestRefund(c *gin.Context) {
+	var req CreateRefundRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid request body",
+				Details: err.Error(),
+			})
+			return
+		}
+	}
+
+	refund, err := h.paymentService.RequestRefund(c.Request.Context(), currentMerchant(c).MerchantID, c.Param("paymentId"), req.Amount, req.Reason)
+	if err != nil {
+		respondRefundError(c, err, "Failed to request refund")
+		return
+	}
+
+	c.JSON(http.StatusCreated, refund)
+}
+
+// GetPaymentRefunds retrieves the refunds of a payment session
+// @Summary Get payment refunds
+// @Description Retrieve every refund requested for one of the merchant's payment sessions
+// @Tags refunds
+// @Produce json
+// @Param paymentId path string true "Payment ID"
+// @Success 200 {object} RefundsResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments/{paymentId}/refunds [get]
+func (h *Handler) GetPaymentRefunds(c *gin.Context) {
+	refunds, err := h.paymentService.GetPaymentRefunds(c.Request.Context(), currentMerchant(c).MerchantID, c.Param("paymentId"))
+	if err != nil {
+		respondRefundError(c, err, "Failed to get refunds")
+		return
+	}
+
+	if refunds == nil {
+		refunds = []*models.Refund{}
+	}
+	c.JSON(http.StatusOK, RefundsResponse{Refunds: refunds})
+}
+
+// GetRefunds retrieves refunds for operators
+// @Summary Get refunds
+// @Description Retrieve the latest refunds of every merchant, or the oldest refunds in a status
+// @Tags admin
+// @Produce json
+// @Param status query string false "Refund status: requested, approved, broadcast, confirmed or failed"
+// @Param limit query int false "Number of refunds to retrieve (default: 50, max: 500)"
+// @Success 200 {object} RefundsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/refunds [get]
+func (h *Handler) GetRefunds(c *gin.Context) {
+	status := models.RefundStatus(c.Query("status"))
+	switch status {
+	case "", models.RefundRequested, models.RefundApproved, models.RefundBroadcast, models.RefundConfirmed, models.RefundFailed:
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid refund status",
+			Details: "status must be requested, approved, broadcast, confirmed or failed",
+		})
+		return
+	}
+
+	// Get limit parameter, default to 50, max 500
+	limit := 50
+	if limitParam := c.Query("limit"); limitParam != "" {
+		if parsedLimit, err := strconv.Atoi(limitParam); err == nil {
+			if parsedLimit > 0 && parsedLimit <= 500 {
+				limit = parsedLimit
+			}
+		}
+	}
+
+	refunds, err := h.paymentService.GetRefunds(c.Request.Context(), status, limit)
+	if err != nil {
+		respondRefundError(c, err, "Failed to get refunds")
+		return
+	}
+
+	if refunds == nil {
+		refunds = []*models.Refund{}
+	}
+	c.JSON(http.StatusOK, RefundsResponse{Refunds: refunds})
+}
+
+// ApproveRefund approves a requested refund
+// @Summary Approve refund
+// @Description Approve a requested refund so its transaction can be sent to the payer
+// @Tags admin
+// @Produce json
+// @Param refundId path string true "Refund ID"
+// @Success 200 {object} models.Refund
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/refunds/{refundId}/approve [post]
+func (h *Handler) ApproveRefund(c *gin.Context) {
+	refund, err := h.paymentService.ApproveRefund(c.Request.Context(), c.Param("refundId"))
+	if err != nil {
+		respondRefundError(c, err, "Failed to approve refund")
+		return
+	}
+
+	c.JSON(http.StatusOK, refund)
+}
+
+// RejectRefund declines a refund that has no transaction yet
+// @Summary Reject refund
+// @Description Decline a requested or approved refund, marking it failed with the given reason
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param refundId path string true "Refund ID"
+// @Param request body RejectRefundRequest false "Rejection reason"
+// @Success 200 {object} models.Refund
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/refunds/{refundId}/reject [post]
+func (h *Handler) RejectRefund(c *gin.Context) {
+	var req RejectRefundRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid request body",
+				Details: err.Error(),
+			})
+			return
+		}
+	}
+
+	refund, err := h.paymentService.RejectRefund(c.Request.Context(), c.Param("refundId"), req.Reason)
+	if err != nil {
+		respondRefundError(c, err, "Failed to reject refund")
+		return
+	}
+
+	c.JSON(http.StatusOK, refund)
+}
+
+// SubmitRefundTransaction records the transaction sent for an approved refund
+// @Summary Submit refund transaction
+// @Description Record the transaction an operator sent for an approved refund. The refund is confirmed once the transaction is verified to send the refund amount of the session's token to the payer and has the required confirmations.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param refundId path string true "Refund ID"
+// @Param request body SubmitRefundTransactionRequest true "Refund transaction"
+// @Success 200 {object} models.Refund
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/refunds/{refundId}/transaction [post]
+func (h *Handler) SubmitRefundTransaction(c *gin.Context) {
+	var req SubmitRefundTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	if !txHashPattern.MatchString(req.TransactionHash) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid transaction hash",
+			Details: "transactionHash must be a 0x-prefixed 32-byte hex string",
+		})
+		return
+	}
+
+	refund, err := h.paymentService.SubmitRefundTransaction(c.Request.Context(), c.Param("refundId"), req.TransactionHash)
+	if err != nil {
+		respondRefundError(c, err, "Failed to submit refund transaction")
+		return
+	}
+
+	c.JSON(http.StatusOK, refund)
+}
+
+// respondRefundError maps refund service errors to error responses
+func respondRefundError(c *gin.Context, err error, failureMessage string) {
+	status := http.StatusInternalServerError
+	message := failureMessage
+	switch {
+	case errors.Is(err, service.ErrPaymentNotFound):
+		status, message = http.StatusNotFound, "Payment session not found"
+	case errors.Is(err, service.ErrRefundNotFound):
+		status, message = http.StatusNotFound, "Refund not found"
+	case errors.Is(err, service.ErrInvalidRefundAmount):
+		status, message = http.StatusBadRequest, "Invalid refund amount"
+	case errors.Is(err, service.ErrRefundNotAllowed):
+		status, message = http.StatusConflict, "Payment session cannot be refunded"
+	case errors.Is(err, service.ErrRefundStatus):
+		status, message = http.StatusConflict, "Refund status does not allow this"
+	case errors.Is(err, service.ErrRefundTransactionUsed):
+		status, message = http.StatusConflict, "Transaction already used by another refund"
+	}
+	c.JSON(status, ErrorResponse{
+		Code:    status,
+		Message: message,
+		Details: err.Error(),
+	})
+}
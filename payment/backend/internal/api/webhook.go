@@ -0,0 +1,265 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"payment-backend/internal/models"
+	"payment-backend/internal/service"
+)
+
+// CreateWebhookEndpointRequest represents the request to register a webhook endpoint
+type CreateWebhookEndpointRequest struct {
+	URL string `json:"url"`
+}
+
+// WebhookEndpointResponse represents a webhook endpoint
+type WebhookEndpointResponse struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // Only returned when the endpoint is created
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// WebhookEndpointsResponse represents the webhook endpoints response
+type WebhookEndpointsResponse struct {
+	Endpoints []*WebhookEndpointResponse `json:"endpoints"`
+}
+
+// WebhookDeliveryResponse represents a webhook delivery and its attempts
+type WebhookDeliveryResponse struct {
+	*models.WebhookDelivery
+	AttemptLog []*models.WebhookDeliveryAttempt `json:"attemptLog"`
+}
+
+// WebhookDeliveriesResponse represents the webhook delivery log response
+type WebhookDeliveriesResponse struct {
+	Deliveries []*WebhookDeliveryResponse `json:"deliveries"`
+}
+
+// CreateWebhookEndpoint registers a webhook endpoint
+// @Summary Create webhook endpoint
+// @Description Register a URL notified of payment status changes. The signing secret is only returned here.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param request body CreateWebhookEndpointRequest true "Webhook endpoint"
+// @Success 201 {object} WebhookEndpointResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/webhooks [post]
+func (h *Handler) CreateWebhookEndpoint(c *gin.Context) {
+	var req CreateWebhookEndpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	endpoint, err := h.webhookService.CreateEndpoint(c.Request.Context(), currentMerchant(c).MerchantID, req.URL)
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := "Failed to create webhook endpoint"
+		if errors.Is(err, service.ErrInvalidWebhookURL) {
+			status = http.StatusBadRequest
+			message = "URL must be an absolute http or https URL of a public host"
+		}
+		c.JSON(status, ErrorResponse{
+			Code:    status,
+			Message: message,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	response := toWebhookEndpointResponse(endpoint)
+	response.Secret = endpoint.Secret
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetWebhookEndpoints retrieves all webhook endpoints
+// @Summary Get webhook endpoints
+// @Description Retrieve all registered webhook endpoints
+// @Tags webhooks
+// @Produce json
+// @Success 200 {object} WebhookEndpointsResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/webhooks [get]
+func (h *Handler) GetWebhookEndpoints(c *gin.Context) {
+	endpoints, err := h.webhookService.GetEndpoints(c.Request.Context(), currentMerchant(c).MerchantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get webhook endpoints",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	response := WebhookEndpointsResponse{
+		Endpoints: make([]*WebhookEndpointResponse, 0, len(endpoints)),
+	}
+	for _, endpoint := range endpoints {
+		response.Endpoints = append(response.Endpoints, toWebhookEndpointResponse(endpoint))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteWebhookEndpoint disables a webhook endpoint
+// @Summary Delete webhook endpoint
+// @Description Disable a webhook endpoint so no new events are queued for it
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook endpoint ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/webhooks/{id} [delete]
+func (h *Handler) DeleteWebhookEndpoint(c *gin.Context) {
+	id, ok := parseIDParam(c, "id", "Webhook endpoint ID")
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.DeleteEndpoint(c.Request.Context(), currentMerchant(c).MerchantID, id); err != nil {
+		respondWebhookError(c, err, "Webhook endpoint not found", "Failed to delete webhook endpoint")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries retrieves the delivery log of a webhook endpoint
+// @Summary Get webhook deliveries
+// @Description Retrieve the most recent deliveries of a webhook endpoint with every attempt made
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook endpoint ID"
+// @Param limit query int false "Number of deliveries to retrieve (default: 50, max: 500)"
+// @Success 200 {object} WebhookDeliveriesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/webhooks/{id}/deliveries [get]
+func (h *Handler) GetWebhookDeliveries(c *gin.Context) {
+	id, ok := parseIDParam(c, "id", "Webhook endpoint ID")
+	if !ok {
+		return
+	}
+
+	// Get limit parameter, default to 50, max 500
+	limit := 50
+	if limitParam := c.Query("limit"); limitParam != "" {
+		if parsedLimit, err := strconv.Atoi(limitParam); err == nil {
+			if parsedLimit > 0 && parsedLimit <= 500 {
+				limit = parsedLimit
+			}
+		}
+	}
+
+	deliveries, attempts, err := h.webhookService.GetDeliveries(c.Request.Context(), currentMerchant(c).MerchantID, id, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get webhook deliveries",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	response := WebhookDeliveriesResponse{
+		Deliveries: make([]*WebhookDeliveryResponse, 0, len(deliveries)),
+	}
+	for _, delivery := range deliveries {
+		deliveryAttempts := attempts[delivery.ID]
+		if deliveryAttempts == nil {
+			deliveryAttempts = []*models.WebhookDeliveryAttempt{}
+		}
+		response.Deliveries = append(response.Deliveries, &WebhookDeliveryResponse{
+			WebhookDelivery: delivery,
+			AttemptLog:      deliveryAttempts,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RedeliverWebhook queues a webhook delivery for a new round of attempts
+// @Summary Redeliver webhook
+// @Description Reset a delivery's attempts and send it again on the worker's next poll, whatever its status
+// @Tags webhooks
+// @Produce json
+// @Param deliveryId path int true "Webhook delivery ID"
+// @Success 202 {object} models.WebhookDelivery
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/webhooks/deliveries/{deliveryId}/redeliver [post]
+func (h *Handler) RedeliverWebhook(c *gin.Context) {
+	id, ok := parseIDParam(c, "deliveryId", "Webhook delivery ID")
+	if !ok {
+		return
+	}
+
+	delivery, err := h.webhookService.Redeliver(c.Request.Context(), currentMerchant(c).MerchantID, id)
+	if err != nil {
+		respondWebhookError(c, err, "Webhook delivery not found", "Failed to redeliver webhook")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// parseIDParam reads a positive integer path parameter, responding with 400 when it is invalid
+func parseIDParam(c *gin.Context, name, label string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: label + " must be a positive integer",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondWebhookError maps webhook service errors to 404 or 500 responses
+func respondWebhookError(c *gin.Context, err error, notFoundMessage, failureMessage string) {
+	status := http.StatusInternalServerError
+	message := failureMessage
+	if errors.Is(err, service.ErrWebhookNotFound) {
+		status = http.StatusNotFound
+		message = notFoundMessage
+	}
+	c.JSON(status, ErrorResponse{
+		Code:    status,
+		Message: message,
+		Details: err.Error(),
+	})
+}
+
+// toWebhookEndpointResponse converts a models.WebhookEndpoint to WebhookEndpointResponse without its secret
+func toWebhookEndpointResponse(endpoint *models.WebhookEndpoint) *WebhookEndpointResponse {
+	return &WebhookEndpointResponse{
+		ID:        endpoint.ID,
+		URL:       endpoint.URL,
+		Enabled:   endpoint.Enabled,
+		CreatedAt: endpoint.CreatedAt,
+		UpdatedAt: endpoint.UpdatedAt,
+	}
+}
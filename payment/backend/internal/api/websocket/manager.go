@@ -21,6 +21,7 @@ type MessageType string
 const (
 	ConnectionAckMsg     MessageType = "connection_ack"
 	PaymentStatusUpdateMsg MessageType = "payment_status_update"
+	LatePaymentMsg       MessageType = "late_payment_detected" // Status update of a session paid after it expired
 	ErrorMsg             MessageType = "error"
 	PingMsg              MessageType = "ping"
 	PongMsg              MessageType = "pong"
@@ -48,6 +49,8 @@ type PaymentStatusUpdateData struct {
 	Confirmations   int    `json:"confirmations,omitempty"`
 	Amount          string `json:"amount,omitempty"`
 	Token           string `json:"token,omitempty"`
+	AmountReceived  string `json:"amountReceived,omitempty"`  // Total credited so far
+	AmountRemaining string `json:"amountRemaining,omitempty"` // Amount still due
 }
 
 // ErrorMessageData represents error message data
@@ -132,15 +135,16 @@ func (m *Manager) paymentStatusListener() {
 		select {
 		case update := <-m.paymentCh:
 			// Push the payment status update to the connected client
-			m.PushPaymentStatusUpdate(
-				update.PaymentID,
-				update.Status,
-				update.TransactionHash,
-				update.BlockNumber,
-				update.Confirmations,
-				update.Amount,
-				update.Token,
-			)
+			m.pushPaymentStatus(update.PaymentID, PaymentStatusUpdateData{
+				Status:          update.Status,
+				TransactionHash: update.TransactionHash,
+				BlockNumber:     update.BlockNumber,
+				Confirmations:   update.Confirmations,
+				Amount:          update.Amount,
+				Token:           update.Token,
+				AmountReceived:  update.AmountReceived,
+				AmountRemaining: update.AmountRemaining,
+			})
 		case <-m.stopCh:
 			log.Println("Payment status listener stopped")
 			return
@@ -366,6 +370,15 @@ func (m *Manager) closeConnection(conn *Connection) {
 	})
 }
 
+// finishConnection closes a connection whose payment has ended, telling the client not to reconnect
+func (m *Manager) finishConnection(conn *Connection, reason string) {
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason)
+	if err := conn.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second)); err != nil {
+		log.Printf("[Frontend WebSocket] Failed to send close message for payment %s: %v", conn.paymentID, err)
+	}
+	m.closeConnection(conn)
+}
+
 // heartbeat sends periodic ping messages to keep connection alive
 func (m *Manager) heartbeat(conn *Connection) {
 	ticker := time.NewTicker(25 * time.Second) // Ping every 25 seconds
@@ -3,10 +3,25 @@ package websocket
 import (
 	"log"
 	"time"
+
+	"payment-backend/internal/models"
 )
 
 // PushPaymentStatusUpdate sends a payment status update to the client
 func (m *Manager) PushPaymentStatusUpdate(paymentID string, status string, transactionHash string, blockNumber int64, confirmations int, amount string, token string) {
+	m.pushPaymentStatus(paymentID, PaymentStatusUpdateData{
+		Status:          status,
+		TransactionHash: transactionHash,
+		BlockNumber:     blockNumber,
+		Confirmations:   confirmations,
+		Amount:          amount,
+		Token:           token,
+	})
+}
+
+// pushPaymentStatus sends a payment status update message to the client watching a payment.
+// Payments that arrived after the session expired are sent as a late payment message.
+func (m *Manager) pushPaymentStatus(paymentID string, data PaymentStatusUpdateData) {
 	m.mu.RLock()
 	conn, exists := m.connections[paymentID]
 	m.mu.RUnlock()
@@ -17,17 +32,14 @@ func (m *Manager) PushPaymentStatusUpdate(paymentID string, status string, trans
 	}
 
 	// Create payment status update message
+	msgType := PaymentStatusUpdateMsg
+	if data.Status == string(models.PaymentPaidLate) {
+		msgType = LatePaymentMsg
+	}
 	updateMsg := &WebSocketMessage{
-		Type:      PaymentStatusUpdateMsg,
+		Type:      msgType,
 		PaymentID: paymentID,
-		Data: PaymentStatusUpdateData{
-			Status:          status,
-			TransactionHash: transactionHash,
-			BlockNumber:     blockNumber,
-			Confirmations:   confirmations,
-			Amount:          amount,
-			Token:           token,
-		},
+		Data:      data,
 		Timestamp: time.Now(),
 	}
 
@@ -35,6 +47,12 @@ func (m *Manager) PushPaymentStatusUpdate(paymentID string, status string, trans
 	if err := m.sendMessage(conn, updateMsg); err != nil {
 		log.Printf("[Frontend WebSocket] Failed to send payment status update: %v", err)
 		m.closeConnection(conn)
+		return
+	}
+
+	// A cancelled session takes no more payments, so its page has nothing left to wait for
+	if data.Status == string(models.PaymentCancelled) {
+		m.finishConnection(conn, "payment cancelled")
 	}
 }
 
@@ -0,0 +1,54 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// tokenAmountPattern matches a plain decimal amount: digits with an optional fraction, no sign, exponent or base prefix
+var tokenAmountPattern = regexp.MustCompile(`^\d+(\.\d+)?$`)
+
+// ParseTokenAmount converts a decimal token amount such as "12.5" into integer base units
+// using the token's decimals. Amounts with more precision than the token supports are rejected.
+func ParseTokenAmount(amount string, decimals int) (*big.Int, error) {
+	if decimals < 0 {
+		return nil, fmt.Errorf("invalid token decimals: %d", decimals)
+	}
+
+	amount = strings.TrimSpace(amount)
+	if !tokenAmountPattern.MatchString(amount) {
+		return nil, fmt.Errorf("invalid amount: %q", amount)
+	}
+	value, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount: %q", amount)
+	}
+
+	value.Mul(value, new(big.Rat).SetInt(tokenUnit(decimals)))
+	if !value.IsInt() {
+		return nil, fmt.Errorf("amount %s has more than %d decimal places", amount, decimals)
+	}
+
+	return new(big.Int).Set(value.Num()), nil
+}
+
+// FormatTokenAmount converts integer base units into a decimal token amount without trailing zeros
+func FormatTokenAmount(value *big.Int, decimals int) string {
+	if value == nil {
+		return "0"
+	}
+	if decimals <= 0 {
+		return value.String()
+	}
+
+	amount := new(big.Rat).SetFrac(value, tokenUnit(decimals)).FloatString(decimals)
+	amount = strings.TrimRight(amount, "0")
+	return strings.TrimSuffix(amount, ".")
+}
+
+// tokenUnit returns 10^decimals, the number of base units in one whole token
+func tokenUnit(decimals int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+}
@@ -0,0 +1,60 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestParseTokenAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   string
+		decimals int
+		want     string
+		wantErr  bool
+	}{
+		{"6 decimals whole", "12", 6, "12000000", false},
+		{"6 decimals fraction", "12.5", 6, "12500000", false},
+		{"6 decimals full precision", "0.000001", 6, "1", false},
+		{"6 decimals trailing zeros", "1.500000000", 6, "1500000", false},
+		{"6 decimals precision overflow", "0.0000001", 6, "", true},
+		{"6 decimals overflow past whole part", "1.1234567", 6, "", true},
+		{"18 decimals whole", "1", 18, "1000000000000000000", false},
+		{"18 decimals full precision", "0.000000000000000001", 18, "1", false},
+		{"18 decimals large", "123456789.123456789123456789", 18, "123456789123456789123456789", false},
+		{"18 decimals precision overflow", "0.0000000000000000001", 18, "", true},
+		{"zero", "0", 18, "0", false},
+		{"surrounding space", " 2.5 ", 6, "2500000", false},
+		{"hex", "0x10", 6, "", true},
+		{"exponent", "1e3", 6, "", true},
+		{"negative", "-1", 6, "", true},
+		{"explicit sign", "+1", 6, "", true},
+		{"fraction", "1/2", 6, "", true},
+		{"leading dot", ".5", 6, "", true},
+		{"trailing dot", "5.", 6, "", true},
+		{"empty", "", 6, "", true},
+		{"separator", "1,000", 6, "", true},
+		{"non ascii digits", "١٢", 6, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTokenAmount(tt.amount, tt.decimals)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseTokenAmount(%q, %d) = %s, want an error", tt.amount, tt.decimals, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTokenAmount(%q, %d) error = %v", tt.amount, tt.decimals, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("ParseTokenAmount(%q, %d) = %s, want %s", tt.amount, tt.decimals, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseTokenAmount("1", -1); err == nil {
+		t.Error("ParseTokenAmount accepted negative decimals")
+	}
+}
@@ -0,0 +1,290 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// newHeadsSubscriptionKey marks the eth_subscribe("newHeads") subscription in wsSubscriptions
+const newHeadsSubscriptionKey = "newHeads"
+
+// RequiredConfirmations returns the block depth at which a transfer counts as paid on this network
+func (s *Service) RequiredConfirmations() int {
+	if s.config.RequiredConfirmations > 0 {
+		return s.config.RequiredConfirmations
+	}
+	return 1
+}
+
+// ChainID returns the chain ID of the network this service watches
+func (s *Service) ChainID() int64 {
+	return s.config.ChainID
+}
+
+// confirmationsAt returns the confirmations of a block given the latest known head
+func (s *Service) confirmationsAt(blockNumber uint64) int {
+	s.headMu.Lock()
+	head := s.lastHead
+	s.headMu.Unlock()
+
+	if head < blockNumber {
+		return 1
+	}
+	return int(head-blockNumber) + 1
+}
+
+// receiptConfirmations returns the confirmations of a mined transaction, asking the node for the head
+// and falling back to the last head seen by the follower
+func (s *Service) receiptConfirmations(ctx context.Context, receipt *types.Receipt) int {
+	if head, err := s.client.BlockNumber(ctx); err == nil {
+		s.notifyNewHead(head)
+		if head >= receipt.BlockNumber.Uint64() {
+			return int(head-receipt.BlockNumber.Uint64()) + 1
+		}
+		return 1
+	}
+	return s.confirmationsAt(receipt.BlockNumber.Uint64())
+}
+
+// notifyNewHead hands a block number to the header follower without blocking
+func (s *Service) notifyNewHead(blockNumber uint64) {
+	select {
+	case s.headCh <- blockNumber:
+	default:
+		// The follower is busy; it re-reads the head on its next pass
+	}
+}
+
+// isNewHeadsSubscription reports whether a subscription ID belongs to the newHeads subscription
+func (s *Service) isNewHeadsSubscription(subscriptionID string) bool {
+	s.subscriptionMu.RLock()
+	defer s.subscriptionMu.RUnlock()
+	return subscriptionID != "" && s.wsSubscriptions[subscriptionID] == newHeadsSubscriptionKey
+}
+
+// handleNewHeadEvent processes a newHeads notification
+func (s *Service) handleNewHeadEvent(header map[string]interface{}) {
+	numberStr, ok := header["number"].(string)
+	if !ok {
+		return
+	}
+
+	blockNumber, err := strconv.ParseUint(strings.TrimPrefix(numberStr, "0x"), 16, 64)
+	if err != nil {
+		return
+	}
+
+	s.markSubscriptionCoverage(blockNumber)
+	s.notifyNewHead(blockNumber)
+}
+
+// followChainHead re-checks every confirming transfer whenever a new block arrives
+func (s *Service) followChainHead() {
+	for {
+		select {
+		case head := <-s.headCh:
+			s.headMu.Lock()
+			if head <= s.lastHead {
+				s.headMu.Unlock()
+				continue
+			}
+			s.lastHead = head
+			s.headMu.Unlock()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			s.checkConfirmations(ctx, head)
+			cancel()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// pendingConfirmation is a credited transfer that has not reached the required depth yet
+type pendingConfirmation struct {
+	paymentID string
+	transfer  TokenTransfer
+}
+
+// checkConfirmations re-reads the receipt of every confirming transfer and reports its new depth,
+// rolling the transfer back if the transaction left the canonical chain
+func (s *Service) checkConfirmations(ctx context.Context, head uint64) {
+	s.activePaymentsMu.RLock()
+	confirming := make([]pendingConfirmation, 0)
+	for paymentID, payment := range s.activePayments {
+		for _, transfer := range payment.transfers {
+			if !transfer.Confirmed {
+				confirming = append(confirming, pendingConfirmation{paymentID: paymentID, transfer: *transfer})
+			}
+		}
+	}
+	s.activePaymentsMu.RUnlock()
+
+	for _, pending := range confirming {
+		paymentID, transfer := pending.paymentID, pending.transfer
+		receipt, err := s.client.TransactionReceipt(ctx, transfer.TxHash)
+		if errors.Is(err, ethereum.NotFound) {
+			s.rollbackTransfer(paymentID, transfer.TxHash, transfer.LogIndex, "transaction is no longer in the canonical chain")
+			continue
+		}
+		if err != nil {
+			fmt.Printf("[Blockchain Confirmations] Failed to get receipt for %s: %v\n", transfer.TxHash.Hex(), err)
+			continue
+		}
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			s.rollbackTransfer(paymentID, transfer.TxHash, transfer.LogIndex, "transaction reverted")
+			continue
+		}
+
+		// The transaction may have been re-included in a different block after a reorg. A log that moved to
+		// another index is a different log: the old one is rolled back and the receipt's Transfer logs are
+		// handled like newly seen ones, which credits the re-included transfer under its new index.
+		if receipt.BlockHash != transfer.BlockHash {
+			if _, found := findTransferLog(receipt, &transfer); !found {
+				s.rollbackTransfer(paymentID, transfer.TxHash, transfer.LogIndex, "transfer missing after re-inclusion")
+				for _, log := range receipt.Logs {
+					s.handleTransferLog(*log)
+				}
+				continue
+			}
+		}
+
+		blockNumber := receipt.BlockNumber.Uint64()
+		confirmations := 1
+		if head >= blockNumber {
+			confirmations = int(head-blockNumber) + 1
+		}
+
+		s.activePaymentsMu.Lock()
+		payment, exists := s.activePayments[paymentID]
+		if !exists {
+			s.activePaymentsMu.Unlock()
+			continue
+		}
+		tracked := payment.trackedTransfer(transfer.TxHash, transfer.LogIndex)
+		if tracked == nil || tracked.Confirmations == confirmations && tracked.BlockHash == receipt.BlockHash {
+			s.activePaymentsMu.Unlock()
+			continue
+		}
+		tracked.BlockHash = receipt.BlockHash
+		tracked.BlockNumber = receipt.BlockNumber
+		tracked.Confirmations = confirmations
+		tracked.Confirmed = confirmations >= s.RequiredConfirmations()
+		update := *tracked
+		s.activePaymentsMu.Unlock()
+
+		s.reportTransfer(paymentID, update)
+	}
+}
+
+// handleRemovedTransfer rolls back a credited transfer that was removed by a reorg
+func (s *Service) handleRemovedTransfer(txHash common.Hash, logIndex uint) {
+	s.activePaymentsMu.RLock()
+	paymentID, _ := s.trackedTransferLocked(txHash, logIndex)
+	s.activePaymentsMu.RUnlock()
+
+	if paymentID != "" {
+		s.rollbackTransfer(paymentID, txHash, logIndex, "log removed by chain reorganization")
+	}
+}
+
+// rollbackTransfer drops a credited transfer from its payment so the payment waits for the balance again
+func (s *Service) rollbackTransfer(paymentID string, txHash common.Hash, logIndex uint, reason string) {
+	s.activePaymentsMu.Lock()
+	payment, exists := s.activePayments[paymentID]
+	if !exists {
+		s.activePaymentsMu.Unlock()
+		return
+	}
+	var removed TokenTransfer
+	found := false
+	for i, transfer := range payment.transfers {
+		if sameTransfer(transfer, txHash, logIndex) {
+			removed = *transfer
+			payment.transfers = append(payment.transfers[:i], payment.transfers[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		s.activePaymentsMu.Unlock()
+		return
+	}
+	removed.Confirmations = 0
+	removed.Confirmed = false
+	removed.Removed = true
+
+	// The monitoring window may have closed while the transfer was confirming
+	expired := payment.timeout > 0 && time.Since(payment.startTime) > payment.timeout && !payment.hasUnconfirmed()
+	if expired {
+		s.removeActivePaymentLocked(paymentID)
+	}
+	s.activePaymentsMu.Unlock()
+
+	fmt.Printf("[Blockchain Confirmations] Payment %s rolled back: %s (%s)\n", paymentID, reason, txHash.Hex())
+	s.logMessage("transfer_removed", "in", map[string]interface{}{
+		"paymentId":       paymentID,
+		"transactionHash": txHash.Hex(),
+		"reason":          reason,
+	})
+
+	if payment.callback == nil {
+		return
+	}
+	payment.callback(&removed, nil)
+	if expired {
+		payment.callback(nil, fmt.Errorf("%w for %s", ErrPaymentTimeout, paymentID))
+	}
+}
+
+// reportTransfer passes a credited transfer's confirmation state to the payment's callback
+func (s *Service) reportTransfer(paymentID string, transfer TokenTransfer) {
+	s.activePaymentsMu.RLock()
+	payment := s.activePayments[paymentID]
+	s.activePaymentsMu.RUnlock()
+	if payment == nil {
+		return
+	}
+
+	fmt.Printf("[Blockchain Confirmations] Payment %s transfer %s has %d/%d confirmations\n",
+		paymentID, transfer.TxHash.Hex(), transfer.Confirmations, s.RequiredConfirmations())
+
+	if payment.callback != nil {
+		payment.callback(&transfer, nil)
+	}
+}
+
+// sameTransfer reports whether a tracked transfer is the log identified by txHash and logIndex
+func sameTransfer(transfer *TokenTransfer, txHash common.Hash, logIndex uint) bool {
+	return transfer != nil && transfer.TxHash == txHash && transfer.LogIndex == logIndex
+}
+
+// findTransferLog finds the log of a transfer in a receipt: the Transfer log of the same token contract at the same
+// log index, moving the same amount between the same addresses
+func findTransferLog(receipt *types.Receipt, transfer *TokenTransfer) (*types.Log, bool) {
+	for _, log := range receipt.Logs {
+		if log.Address != transfer.Token || log.Index != transfer.LogIndex {
+			continue
+		}
+		if len(log.Topics) < 3 || log.Topics[0] != common.HexToHash(transferEventSignature) {
+			continue
+		}
+		if common.BytesToAddress(log.Topics[1].Bytes()) != transfer.From ||
+			common.BytesToAddress(log.Topics[2].Bytes()) != transfer.To {
+			continue
+		}
+		if new(big.Int).SetBytes(log.Data).Cmp(transfer.Value) == 0 {
+			return log, true
+		}
+	}
+	return nil, false
+}
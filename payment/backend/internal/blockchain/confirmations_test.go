@@ -0,0 +1,50 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestFindTransferLog(t *testing.T) {
+	token := common.HexToAddress("0x55d398326f99059fF775485246999027B3197955")
+	otherToken := common.HexToAddress("0x8AC76a51cc950d9822D68b83fE1Ad97B32Cd580d")
+	payer := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	receiver := common.HexToAddress("0xe27577B0e3920cE35f100f66430de0108cb78a04")
+
+	transferLog := func(contract common.Address, index uint) *types.Log {
+		return &types.Log{
+			Address: contract,
+			Topics:  []common.Hash{common.HexToHash(transferEventSignature), common.BytesToHash(payer.Bytes()), common.BytesToHash(receiver.Bytes())},
+			Data:    common.BigToHash(big.NewInt(100)).Bytes(),
+			Index:   index,
+		}
+	}
+	transfer := &TokenTransfer{From: payer, To: receiver, Value: big.NewInt(100), Token: token, LogIndex: 3}
+
+	tests := []struct {
+		name      string
+		logs      []*types.Log
+		wantFound bool
+	}{
+		{"same token and index", []*types.Log{transferLog(token, 3)}, true},
+		{"identical transfer at the index", []*types.Log{transferLog(token, 2), transferLog(token, 3)}, true},
+		{"other token at the index", []*types.Log{transferLog(otherToken, 3)}, false},
+		{"same token at another index", []*types.Log{transferLog(token, 4)}, false},
+		{"empty topics at the index", []*types.Log{{Address: token, Topics: []common.Hash{}, Index: 3}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, found := findTransferLog(&types.Receipt{Logs: tt.logs}, transfer)
+			if found != tt.wantFound {
+				t.Fatalf("findTransferLog() found = %v, want %v", found, tt.wantFound)
+			}
+			if found && (log.Address != token || log.Index != transfer.LogIndex) {
+				t.Errorf("findTransferLog() = log %d of %s", log.Index, log.Address.Hex())
+			}
+		})
+	}
+}
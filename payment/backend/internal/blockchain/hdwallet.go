@@ -0,0 +1,136 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// BIP-32 serialization version bytes
+const (
+	xpubVersion uint32 = 0x0488B21E // mainnet public
+	xprvVersion uint32 = 0x0488ADE4 // mainnet private
+	tpubVersion uint32 = 0x043587CF // testnet public
+	tprvVersion uint32 = 0x04358394 // testnet private
+)
+
+// hardenedKeyStart is the first child index that requires the parent private key
+const hardenedKeyStart = 1 << 31
+
+// ErrInvalidChildIndex is returned when an index does not produce a valid child key; use the next index
+var ErrInvalidChildIndex = errors.New("index does not produce a valid child key")
+
+// ExtendedPublicKey is a BIP-32 extended public key. Only non-hardened children can be derived from it,
+// so the service can hand out deposit addresses without holding any private key.
+type ExtendedPublicKey struct {
+	encoded   string
+	key       []byte // Compressed public key
+	chainCode []byte
+}
+
+// ParseExtendedPublicKey decodes a base58check xpub or tpub, rejecting extended private keys
+func ParseExtendedPublicKey(encoded string) (*ExtendedPublicKey, error) {
+	data, err := base58Decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 82 {
+		return nil, fmt.Errorf("invalid extended key length %d", len(data))
+	}
+
+	payload, checksum := data[:78], data[78:]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], checksum) {
+		return nil, errors.New("invalid extended key checksum")
+	}
+
+	switch binary.BigEndian.Uint32(payload[:4]) {
+	case xpubVersion, tpubVersion:
+	case xprvVersion, tprvVersion:
+		return nil, errors.New("extended private keys are not accepted, configure the xpub instead")
+	default:
+		return nil, errors.New("unknown extended key version")
+	}
+
+	key := payload[45:78]
+	if _, err := crypto.DecompressPubkey(key); err != nil {
+		return nil, fmt.Errorf("invalid extended public key: %w", err)
+	}
+
+	return &ExtendedPublicKey{
+		encoded:   encoded,
+		key:       key,
+		chainCode: payload[13:45],
+	}, nil
+}
+
+// String returns the base58check encoding of the key
+func (k *ExtendedPublicKey) String() string {
+	return k.encoded
+}
+
+// DeriveAddress returns the address of the non-hardened child key at index
+func (k *ExtendedPublicKey) DeriveAddress(index uint32) (common.Address, error) {
+	if index >= hardenedKeyStart {
+		return common.Address{}, fmt.Errorf("cannot derive hardened index %d from a public key", index)
+	}
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(k.key)
+	binary.Write(mac, binary.BigEndian, index)
+	sum := mac.Sum(nil)
+
+	curve := crypto.S256()
+	tweak := sum[:32]
+	if new(big.Int).SetBytes(tweak).Cmp(curve.Params().N) >= 0 {
+		return common.Address{}, ErrInvalidChildIndex
+	}
+
+	parent, err := crypto.DecompressPubkey(k.key)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	// Child public key = tweak*G + parent public key
+	tx, ty := curve.ScalarBaseMult(tweak)
+	x, y := curve.Add(tx, ty, parent.X, parent.Y)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return common.Address{}, ErrInvalidChildIndex
+	}
+
+	return crypto.PubkeyToAddress(ecdsa.PublicKey{Curve: curve, X: x, Y: y}), nil
+}
+
+// base58Alphabet is the Bitcoin base58 alphabet used by BIP-32 key serialization
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58Decode decodes a Bitcoin base58 string
+func base58Decode(encoded string) ([]byte, error) {
+	value := new(big.Int)
+	radix := big.NewInt(58)
+	for _, r := range encoded {
+		digit := bytes.IndexRune([]byte(base58Alphabet), r)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", r)
+		}
+		value.Mul(value, radix)
+		value.Add(value, big.NewInt(int64(digit)))
+	}
+
+	// Each leading '1' encodes a leading zero byte
+	zeros := 0
+	for zeros < len(encoded) && encoded[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), value.Bytes()...), nil
+}
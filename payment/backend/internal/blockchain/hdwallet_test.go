@@ -0,0 +1,120 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// BIP-32 test vector 2: the master extended public key and that of its child m/0
+const (
+	vector2Master = "xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB"
+	vector2Child0 = "xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH"
+)
+
+// base58CheckEncode serializes a 78-byte extended key payload with its checksum
+func base58CheckEncode(payload []byte) string {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return base58Encode(append(append([]byte{}, payload...), second[:4]...))
+}
+
+// base58Encode encodes bytes in Bitcoin base58, the inverse of base58Decode
+func base58Encode(data []byte) string {
+	var out []byte
+	value := new(big.Int).SetBytes(data)
+	radix, digit := big.NewInt(58), new(big.Int)
+	for value.Sign() > 0 {
+		value.QuoRem(value, radix, digit)
+		out = append(out, base58Alphabet[digit.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func TestDeriveAddressVector2(t *testing.T) {
+	master, err := ParseExtendedPublicKey(vector2Master)
+	if err != nil {
+		t.Fatalf("parse master: %v", err)
+	}
+	child, err := ParseExtendedPublicKey(vector2Child0)
+	if err != nil {
+		t.Fatalf("parse m/0: %v", err)
+	}
+
+	childKey, err := crypto.DecompressPubkey(child.key)
+	if err != nil {
+		t.Fatalf("decompress m/0 key: %v", err)
+	}
+	want := crypto.PubkeyToAddress(*childKey)
+
+	got, err := master.DeriveAddress(0)
+	if err != nil {
+		t.Fatalf("DeriveAddress(0): %v", err)
+	}
+	if got != want {
+		t.Errorf("DeriveAddress(0) = %s, want %s", got.Hex(), want.Hex())
+	}
+
+	if _, err := master.DeriveAddress(hardenedKeyStart); err == nil {
+		t.Error("DeriveAddress accepted a hardened index")
+	}
+}
+
+func TestParseExtendedPublicKeyRejects(t *testing.T) {
+	data, err := base58Decode(vector2Master)
+	if err != nil {
+		t.Fatalf("decode master: %v", err)
+	}
+	payload := data[:78]
+	if got := base58CheckEncode(payload); got != vector2Master {
+		t.Fatalf("base58CheckEncode round trip = %s", got)
+	}
+
+	withVersion := func(version uint32) string {
+		p := append([]byte{}, payload...)
+		binary.BigEndian.PutUint32(p[:4], version)
+		return base58CheckEncode(p)
+	}
+
+	badChecksum := append([]byte{}, data...)
+	badChecksum[81] ^= 0x01
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr string
+	}{
+		{"xprv", withVersion(xprvVersion), "extended private keys are not accepted"},
+		{"tprv", withVersion(tprvVersion), "extended private keys are not accepted"},
+		{"unknown version", withVersion(0x01020304), "unknown extended key version"},
+		{"bad checksum", base58Encode(badChecksum), "invalid extended key checksum"},
+		{"truncated", vector2Master[:len(vector2Master)-4], "invalid extended key length"},
+		{"invalid character", "0" + vector2Master[1:], "invalid base58 character"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseExtendedPublicKey(tt.encoded)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseExtendedPublicKey error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := ParseExtendedPublicKey(withVersion(tpubVersion)); err != nil {
+		t.Errorf("tpub rejected: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"payment-backend/internal/models"
+)
+
+// Registry holds one blockchain service per enabled network
+type Registry struct {
+	services   map[string]*Service
+	networkIDs []string
+}
+
+// NewRegistry creates a blockchain service for every enabled network, each with its own RPC,
+// WebSocket URL, chain ID and confirmation depth. defaults supplies the settings that are not
+// stored per network, such as polling and token refresh intervals.
+func NewRegistry(networks []*models.Network, defaults Config) (*Registry, error) {
+	registry := &Registry{
+		services: make(map[string]*Service),
+	}
+
+	for _, network := range networks {
+		if !network.Enabled {
+			continue
+		}
+
+		config := defaults
+		config.NetworkID = network.ID
+		config.RPCURL = network.RPCURL
+		config.ChainID = network.ChainID
+		config.RequiredConfirmations = network.RequiredConfirmations
+		config.NativeCurrency = network.NativeCurrency
+		config.WebsocketURL = ""
+		if network.WebsocketURL != nil {
+			config.WebsocketURL = *network.WebsocketURL
+		}
+
+		service, err := NewService(config)
+		if err != nil {
+			registry.Close()
+			return nil, fmt.Errorf("failed to initialize blockchain service for %s: %w", network.ID, err)
+		}
+
+		fmt.Printf("[Blockchain Registry] Watching %s (chain ID %d) via %s\n", network.ID, network.ChainID, network.RPCURL)
+		registry.services[network.ID] = service
+		registry.networkIDs = append(registry.networkIDs, network.ID)
+	}
+
+	return registry, nil
+}
+
+// Get returns the service watching a network
+func (r *Registry) Get(networkID string) (*Service, bool) {
+	service, ok := r.services[networkID]
+	return service, ok
+}
+
+// NetworkIDs returns the IDs of the watched networks
+func (r *Registry) NetworkIDs() []string {
+	return append([]string(nil), r.networkIDs...)
+}
+
+// SetCursorStore sets the scan cursor store of every service
+func (r *Registry) SetCursorStore(store BlockCursorStore) {
+	for _, service := range r.services {
+		service.SetCursorStore(store)
+	}
+}
+
+// SetTokenStore sets the token store of every service and loads their token registries
+func (r *Registry) SetTokenStore(store TokenStore) error {
+	for _, networkID := range r.networkIDs {
+		if err := r.services[networkID].SetTokenStore(store); err != nil {
+			return fmt.Errorf("failed to load tokens for %s: %w", networkID, err)
+		}
+	}
+	return nil
+}
+
+// Close closes every service
+func (r *Registry) Close() {
+	for _, service := range r.services {
+		service.Close()
+	}
+}
@@ -0,0 +1,358 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// defaultPollInterval is used when Config.PollInterval is not set
+	defaultPollInterval = 5 * time.Second
+	// maxScanBlockRange caps the block range of a single eth_getLogs call; public RPC nodes reject larger ranges
+	maxScanBlockRange = 1000
+)
+
+// BlockCursorStore persists the last block scanned by the polling fallback
+type BlockCursorStore interface {
+	GetLastScannedBlock(networkID string) (uint64, bool, error)
+	SetLastScannedBlock(networkID string, blockNumber uint64) error
+}
+
+// SetCursorStore sets the store used to persist the polling scanner's cursor
+func (s *Service) SetCursorStore(store BlockCursorStore) {
+	s.scanMu.Lock()
+	defer s.scanMu.Unlock()
+	s.cursorStore = store
+	s.cursorLoaded = false
+}
+
+// pollInterval returns the configured polling interval
+func (s *Service) pollInterval() time.Duration {
+	if s.config.PollInterval > 0 {
+		return s.config.PollInterval
+	}
+	return defaultPollInterval
+}
+
+// startPollingScanner periodically scans new blocks for Transfer logs the WebSocket subscriptions do not cover
+func (s *Service) startPollingScanner() {
+	ticker := time.NewTicker(s.pollInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := s.pollTransfers(ctx); err != nil {
+				fmt.Printf("[Blockchain Polling] Scan failed: %v\n", err)
+			}
+			cancel()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// pollTransfers scans the blocks since the last cursor for Transfer logs to active receiver addresses.
+// Once the WebSocket subscriptions are live the cursor just follows the chain head, but only from the first
+// block they cover; the blocks before it, e.g. those mined during an outage, are scanned first.
+func (s *Service) pollTransfers(ctx context.Context) error {
+	s.scanMu.Lock()
+	defer s.scanMu.Unlock()
+
+	head, err := s.client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	// Also drives the confirmation tracker while no newHeads subscription is available
+	s.notifyNewHead(head)
+
+	if !s.cursorLoaded {
+		s.loadScanCursor(head)
+	}
+
+	if s.lastScannedBlock >= head {
+		return nil
+	}
+
+	contracts, receivers := s.activeTransferFilters()
+	if len(receivers) == 0 {
+		s.saveScanCursor(head)
+		return nil
+	}
+
+	scanTo := head
+	if coveredFrom, covered := s.subscriptionCoverage(); covered {
+		if coveredFrom <= s.lastScannedBlock+1 {
+			s.saveScanCursor(head)
+			return nil
+		}
+		if coveredFrom-1 < scanTo {
+			scanTo = coveredFrom - 1
+		}
+	}
+
+	fmt.Printf("[Blockchain Polling] Scanning blocks %d-%d not covered by the WebSocket for %d receivers\n",
+		s.lastScannedBlock+1, scanTo, len(receivers))
+
+	return s.scanTransferLogs(ctx, s.lastScannedBlock+1, scanTo, contracts, receivers, func(logs []types.Log, chunkEnd uint64) error {
+		for _, log := range logs {
+			s.handleTransferLog(log)
+		}
+		s.saveScanCursor(chunkEnd)
+		return nil
+	})
+}
+
+// loadScanCursor reads the persisted cursor, starting at the current head if none exists. The caller must hold scanMu.
+func (s *Service) loadScanCursor(head uint64) {
+	s.cursorLoaded = true
+	s.lastScannedBlock = head
+
+	if s.cursorStore == nil {
+		return
+	}
+
+	blockNumber, found, err := s.cursorStore.GetLastScannedBlock(s.config.NetworkID)
+	if err != nil {
+		fmt.Printf("[Blockchain Polling] Failed to load scan cursor: %v\n", err)
+		return
+	}
+	if found && blockNumber <= head {
+		s.lastScannedBlock = blockNumber
+		fmt.Printf("[Blockchain Polling] Resuming scan after block %d\n", blockNumber)
+		return
+	}
+
+	s.saveScanCursor(head)
+}
+
+// saveScanCursor advances the cursor and persists it. The caller must hold scanMu.
+func (s *Service) saveScanCursor(blockNumber uint64) {
+	s.lastScannedBlock = blockNumber
+
+	if s.cursorStore == nil {
+		return
+	}
+	if err := s.cursorStore.SetLastScannedBlock(s.config.NetworkID, blockNumber); err != nil {
+		fmt.Printf("[Blockchain Polling] Failed to persist scan cursor: %v\n", err)
+	}
+}
+
+// activeTransferFilters returns the token contracts and receiver addresses of all active payments
+func (s *Service) activeTransferFilters() ([]common.Address, []common.Address) {
+	s.activePaymentsMu.RLock()
+	defer s.activePaymentsMu.RUnlock()
+
+	contractSet := make(map[common.Address]bool)
+	receiverSet := make(map[common.Address]bool)
+	contracts := make([]common.Address, 0)
+	receivers := make([]common.Address, 0)
+
+	for _, payment := range s.activePayments {
+		if !contractSet[payment.tokenAddress] {
+			contractSet[payment.tokenAddress] = true
+			contracts = append(contracts, payment.tokenAddress)
+		}
+		if !receiverSet[payment.receiverAddress] {
+			receiverSet[payment.receiverAddress] = true
+			receivers = append(receivers, payment.receiverAddress)
+		}
+	}
+
+	return contracts, receivers
+}
+
+// scanTransferLogs walks [from, to] in chunks of at most maxScanBlockRange blocks and passes each chunk's
+// Transfer logs to handle. A nil receivers slice matches transfers to any address.
+func (s *Service) scanTransferLogs(ctx context.Context, from, to uint64, contracts, receivers []common.Address, handle func(logs []types.Log, chunkEnd uint64) error) error {
+	var receiverTopics []common.Hash
+	for _, receiver := range receivers {
+		receiverTopics = append(receiverTopics, common.BytesToHash(receiver.Bytes()))
+	}
+
+	for start := from; start <= to; start += maxScanBlockRange {
+		end := start + maxScanBlockRange - 1
+		if end > to {
+			end = to
+		}
+
+		query := ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(start),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Addresses: contracts,
+			Topics: [][]common.Hash{
+				{common.HexToHash(transferEventSignature)},
+				nil,
+				receiverTopics,
+			},
+		}
+
+		logs, err := s.client.FilterLogs(ctx, query)
+		if err != nil {
+			return fmt.Errorf("failed to filter logs for blocks %d-%d: %w", start, end, err)
+		}
+
+		s.logMessage("poll_logs", "in", map[string]interface{}{
+			"fromBlock": start,
+			"toBlock":   end,
+			"logs":      len(logs),
+		})
+
+		if err := handle(logs, end); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transferFromLog decodes an ERC-20 Transfer log
+func (s *Service) transferFromLog(log types.Log) (*TokenTransfer, bool) {
+	if len(log.Topics) < 3 || log.Topics[0] != common.HexToHash(transferEventSignature) {
+		return nil, false
+	}
+
+	return &TokenTransfer{
+		From:        common.BytesToAddress(log.Topics[1].Bytes()),
+		To:          common.BytesToAddress(log.Topics[2].Bytes()),
+		Value:       new(big.Int).SetBytes(log.Data),
+		TxHash:      log.TxHash,
+		BlockNumber: new(big.Int).SetUint64(log.BlockNumber),
+		TokenSymbol: s.tokenSymbolForContract(log.Address),
+		Token:       log.Address,
+		LogIndex:    log.Index,
+		BlockHash:   log.BlockHash,
+		Removed:     log.Removed,
+	}, true
+}
+
+// tokenSymbolForContract resolves a token contract to its symbol using the active payments first
+func (s *Service) tokenSymbolForContract(contract common.Address) string {
+	s.activePaymentsMu.RLock()
+	for _, payment := range s.activePayments {
+		if payment.tokenAddress == contract {
+			s.activePaymentsMu.RUnlock()
+			return payment.tokenSymbol
+		}
+	}
+	s.activePaymentsMu.RUnlock()
+
+	return s.getTokenSymbolFromAddress(contract.Hex())
+}
+
+// handleTransferLog feeds a polled Transfer log into the same detection path as WebSocket events
+func (s *Service) handleTransferLog(log types.Log) {
+	transfer, ok := s.transferFromLog(log)
+	if !ok {
+		return
+	}
+
+	if transfer.Removed {
+		s.handleRemovedTransfer(transfer.TxHash, transfer.LogIndex)
+		return
+	}
+
+	fmt.Printf("[Blockchain Polling] Transfer detected: %s -> %s, Amount: %s, TX: %s, Token: %s\n",
+		transfer.From.Hex(), transfer.To.Hex(), transfer.Value.String(), transfer.TxHash.Hex(), transfer.TokenSymbol)
+
+	s.triggerPaymentDetected(transfer)
+}
+
+// BackfillPayment scans from fromBlock to the current head for transfers matching an active payment,
+// e.g. ones that landed while the process was down
+func (s *Service) BackfillPayment(ctx context.Context, paymentID string, fromBlock uint64) error {
+	s.activePaymentsMu.RLock()
+	payment, exists := s.activePayments[paymentID]
+	s.activePaymentsMu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("payment %s is not being monitored", paymentID)
+	}
+
+	head, err := s.client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get latest block: %w", err)
+	}
+	if fromBlock > head {
+		return nil
+	}
+
+	fmt.Printf("[Blockchain Polling] Backfilling payment %s from block %d to %d\n", paymentID, fromBlock, head)
+
+	return s.scanTransferLogs(ctx, fromBlock, head, []common.Address{payment.tokenAddress}, []common.Address{payment.receiverAddress}, func(logs []types.Log, chunkEnd uint64) error {
+		for _, log := range logs {
+			s.handleTransferLog(log)
+		}
+		return nil
+	})
+}
+
+// MonitorTokenTransfers polls for Transfer events of a token from the current block onwards.
+// If expectedAmount is not nil, only transfers of exactly that amount are emitted.
+// The returned channel is closed when ctx is cancelled.
+func (s *Service) MonitorTokenTransfers(ctx context.Context, tokenAddress common.Address, expectedAmount *big.Int) (<-chan *TokenTransfer, error) {
+	head, err := s.client.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	transferCh := make(chan *TokenTransfer, 100)
+
+	go func() {
+		defer close(transferCh)
+
+		nextBlock := head + 1
+		ticker := time.NewTicker(s.pollInterval())
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			latest, err := s.client.BlockNumber(ctx)
+			if err != nil {
+				fmt.Printf("[Blockchain Polling] Failed to get latest block: %v\n", err)
+				continue
+			}
+			if latest < nextBlock {
+				continue
+			}
+
+			err = s.scanTransferLogs(ctx, nextBlock, latest, []common.Address{tokenAddress}, nil, func(logs []types.Log, chunkEnd uint64) error {
+				for _, log := range logs {
+					transfer, ok := s.transferFromLog(log)
+					if !ok {
+						continue
+					}
+					if expectedAmount != nil && transfer.Value.Cmp(expectedAmount) != 0 {
+						continue
+					}
+
+					select {
+					case transferCh <- transfer:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}
+				nextBlock = chunkEnd + 1
+				return nil
+			})
+			if err != nil {
+				fmt.Printf("[Blockchain Polling] Failed to scan %s transfers: %v\n", tokenAddress.Hex(), err)
+			}
+		}
+	}()
+
+	return transferCh, nil
+}
@@ -0,0 +1,144 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// sendNewHead pushes a newHeads notification for a block on a subscription of the fake node
+func (n *fakeNode) sendNewHead(t *testing.T, subscriptionID string, blockNumber uint64) {
+	n.write(t, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscription",
+		"params": map[string]interface{}{
+			"subscription": subscriptionID,
+			"result":       map[string]interface{}{"number": fmt.Sprintf("0x%x", blockNumber)},
+		},
+	})
+}
+
+// waitForCoverage waits until the service knows its subscriptions cover blocks from want onwards
+func waitForCoverage(t *testing.T, s *Service, want uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if from, covered := s.subscriptionCoverage(); covered && from == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			from, covered := s.subscriptionCoverage()
+			t.Fatalf("subscription coverage = %d (%v), want %d", from, covered, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPollTransfersScansBlocksMissedDuringWebSocketOutage(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.server.Close()
+	node.setHead(100)
+
+	token := common.HexToAddress("0x55d398326f99059fF775485246999027B3197955")
+	receiver := common.HexToAddress("0xe27577B0e3920cE35f100f66430de0108cb78a04")
+	payer := common.HexToAddress("0x1111111111111111111111111111111111111111")
+
+	s, err := NewService(Config{
+		RPCURL:                node.server.URL,
+		ChainID:               1337,
+		NetworkID:             "TEST",
+		PollInterval:          time.Hour, // the test drives pollTransfers itself
+		RequiredConfirmations: 3,
+		WebsocketEndpoints:    []WebSocketEndpoint{{URL: node.wsURL(), Timeout: 1000, Name: "fake node"}},
+	})
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer s.Close()
+	if err := s.SetTokenStore(fakeTokens{{Symbol: "USDT", ContractAddress: token.Hex(), Decimals: 18, NetworkID: "TEST", Enabled: true}}); err != nil {
+		t.Fatalf("SetTokenStore() error = %v", err)
+	}
+
+	transfers := make(chan TokenTransfer, 10)
+	node.expect(t, "eth_subscribe")
+	err = s.StartPaymentMonitoringWithCallback("pay_1", "USDT", receiver.Hex(), big.NewInt(100), 0, func(transfer *TokenTransfer, err error) {
+		if transfer != nil {
+			transfers <- *transfer
+		}
+	})
+	if err != nil {
+		t.Fatalf("StartPaymentMonitoringWithCallback() error = %v", err)
+	}
+	node.expect(t, "eth_subscribe")
+	waitForSubscription(t, s, "0x1")
+	waitForSubscription(t, s, "0x2")
+
+	ctx := context.Background()
+	poll := func(wantQueries [][2]uint64, wantCursor uint64) {
+		t.Helper()
+		if err := s.pollTransfers(ctx); err != nil {
+			t.Fatalf("pollTransfers() error = %v", err)
+		}
+		if queries := node.takeLogQueries(); !reflect.DeepEqual(queries, wantQueries) {
+			t.Fatalf("eth_getLogs ranges = %v, want %v", queries, wantQueries)
+		}
+		if s.lastScannedBlock != wantCursor {
+			t.Fatalf("cursor = %d, want %d", s.lastScannedBlock, wantCursor)
+		}
+	}
+
+	// While the subscriptions are live the cursor follows the head without scanning
+	node.sendNewHead(t, "0x1", 100)
+	waitForCoverage(t, s, 100)
+	poll(nil, 100)
+	node.setHead(105)
+	poll(nil, 105)
+
+	// The WebSocket drops and blocks 106-119 are mined, one of them paying the session, before the
+	// scanner runs again. The connection comes back and its subscriptions see block 120 first.
+	node.mu.Lock()
+	node.logs = []types.Log{{
+		Address:     token,
+		Topics:      []common.Hash{common.HexToHash(transferEventSignature), common.BytesToHash(payer.Bytes()), common.BytesToHash(receiver.Bytes())},
+		Data:        common.BigToHash(big.NewInt(100)).Bytes(),
+		BlockNumber: 110,
+		TxHash:      common.HexToHash("0xabc"),
+		BlockHash:   common.HexToHash("0xb110"),
+	}}
+	node.mu.Unlock()
+	node.setHead(120)
+	node.drop()
+	node.expect(t, "eth_subscribe")
+	node.expect(t, "eth_subscribe")
+	waitForSubscription(t, s, "0x3")
+	waitForSubscription(t, s, "0x4")
+
+	// Connected but not yet known to be covered: nothing may be skipped
+	if _, covered := s.subscriptionCoverage(); covered {
+		t.Fatal("subscriptions of the new connection counted as covering blocks before any head")
+	}
+
+	node.sendNewHead(t, "0x3", 120)
+	waitForCoverage(t, s, 120)
+
+	// The gap is scanned up to the first covered block, and the transfer in it is reported
+	poll([][2]uint64{{106, 119}}, 119)
+	select {
+	case transfer := <-transfers:
+		if transfer.TxHash != common.HexToHash("0xabc") || transfer.From != payer || transfer.Value.Cmp(big.NewInt(100)) != 0 {
+			t.Fatalf("transfer = %+v", transfer)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("transfer mined during the outage was not reported")
+	}
+
+	// From there the cursor follows the head again
+	node.setHead(125)
+	poll(nil, 125)
+}
@@ -3,12 +3,15 @@ package blockchain
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"math/big"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
@@ -27,6 +30,14 @@ type TokenTransfer struct {
 	TxHash      common.Hash    `json:"txHash"`
 	BlockNumber *big.Int       `json:"blockNumber"`
 	TokenSymbol string         `json:"tokenSymbol"`
+	Token       common.Address `json:"token"` // Token contract that emitted the Transfer log
+	LogIndex    uint           `json:"logIndex"`
+	BlockHash   common.Hash    `json:"blockHash"`
+
+	// Confirmation tracking, updated by the block-header follower
+	Confirmations int  `json:"confirmations"`
+	Confirmed     bool `json:"confirmed"` // Confirmations reached the network's required depth
+	Removed       bool `json:"removed"`   // The transfer's block was reorged out
 }
 
 // Config represents blockchain configuration
@@ -35,6 +46,20 @@ type Config struct {
 	WebsocketURL   string `json:"websocketUrl"`
 	ChainID        int64  `json:"chainId"`
 	ReceiverAddress string `json:"receiverAddress"` // Deprecated: Not used anymore as each payment uses its own address
+
+	// WebsocketEndpoints overrides the default failover endpoint list (e.g. a local node or a fake server in tests)
+	WebsocketEndpoints []WebSocketEndpoint `json:"websocketEndpoints,omitempty"`
+
+	// NetworkID identifies the network row this service watches; it keys the persisted scan cursor
+	NetworkID string `json:"networkId"`
+	// PollInterval is how often the eth_getLogs fallback scanner checks for new blocks
+	PollInterval time.Duration `json:"pollInterval"`
+	// RequiredConfirmations is the block depth at which a detected transfer counts as paid
+	RequiredConfirmations int `json:"requiredConfirmations"`
+	// NativeCurrency is the symbol of the chain's native coin; only sessions in it are validated against the transaction value
+	NativeCurrency string `json:"nativeCurrency"`
+	// TokenRefreshInterval is how often the token registry is reloaded from the token store
+	TokenRefreshInterval time.Duration `json:"tokenRefreshInterval"`
 }
 
 // WebSocketEndpoint represents a WebSocket endpoint configuration
@@ -46,7 +71,10 @@ type WebSocketEndpoint struct {
 	RequiresAPIKey bool `json:"requiresApiKey,omitempty"`
 }
 
-// PaymentCallback defines the callback function for payment events
+// PaymentCallback defines the callback function for payment events.
+// It is called for every transfer credited to the payment, on detection and again whenever its
+// confirmation count changes, it becomes Confirmed, or it is Removed by a reorg; err is set on timeout.
+// Monitoring continues until StopPaymentMonitoring is called or the timeout passes.
 type PaymentCallback func(*TokenTransfer, error)
 
 // PaymentStatusUpdate represents a payment status update for WebSocket notifications
@@ -58,11 +86,14 @@ type PaymentStatusUpdate struct {
 	Confirmations   int    `json:"confirmations,omitempty"`
 	Amount          string `json:"amount,omitempty"`
 	Token           string `json:"token,omitempty"`
+	AmountReceived  string `json:"amountReceived,omitempty"`
+	AmountRemaining string `json:"amountRemaining,omitempty"`
 }
 
 // WebSocketMessageLog represents a logged WebSocket message
 type WebSocketMessageLog struct {
 	Type      string      `json:"type"`
+	NetworkID string      `json:"networkId,omitempty"`
 	Direction string      `json:"direction"` // "in" or "out"
 	Data      interface{} `json:"data,omitempty"`
 	Timestamp time.Time   `json:"timestamp"`
@@ -78,10 +109,20 @@ type Service struct {
 	// WebSocket support
 	wsConn         *websocket.Conn
 	wsMu           sync.Mutex
-	wsSubscriptions map[string]string // subscriptionId -> tokenSymbol
+	wsSubscriptions map[string]string // subscriptionId -> log filter key
 	isConnected    bool
+	wsCoveredFrom  uint64 // First block the current connection's subscriptions are known to cover; 0 until then
 	subscriptionMu sync.RWMutex
 
+	// Payments being monitored on this network, keyed by payment ID
+	activePayments   map[string]*activePayment
+	activePaymentsMu sync.RWMutex
+
+	// Log subscriptions wanted by active payments, re-sent after every reconnect
+	logFilters        map[string]*logFilter // log filter key -> filter
+	pendingSubscribes map[int64]string      // JSON-RPC request id -> log filter key
+	nextRequestID     int64
+
 	// Multi-endpoint WebSocket support
 	wsEndpoints    []WebSocketEndpoint
 	currentEndpointIndex int
@@ -93,11 +134,25 @@ type Service struct {
 	lastConnectionTime     time.Time
 	lastDisconnectionTime  time.Time
 	connectionErrors       int64
-	activeSubscriptions    int64
 
-	// Payment status channel for WebSocket notifications
-	paymentCh chan<- *PaymentStatusUpdate
-	mu        sync.Mutex // For protecting paymentCh
+	// Token registry loaded from the token store, keyed by network and checksummed address or symbol
+	tokenStore      TokenStore
+	tokensByAddress map[string]tokenInfo
+	tokensBySymbol  map[string]tokenInfo
+	tokensMu        sync.RWMutex
+
+	// Block-header follower driving confirmation counts
+	headCh   chan uint64
+	lastHead uint64
+	headMu   sync.Mutex
+
+	// HTTP polling fallback used while the WebSocket is down
+	cursorStore      BlockCursorStore
+	lastScannedBlock uint64
+	cursorLoaded     bool
+	scanMu           sync.Mutex
+	stopCh           chan struct{}
+	closeOnce        sync.Once
 
 	// Message logging
 	messageLog []WebSocketMessageLog
@@ -106,7 +161,7 @@ type Service struct {
 }
 
 // NewService creates a new blockchain service
-func NewService(config Config, paymentCh chan<- *PaymentStatusUpdate) (*Service, error) {
+func NewService(config Config) (*Service, error) {
 	// Connect to RPC endpoint
 	client, err := ethclient.Dial(config.RPCURL)
 	if err != nil {
@@ -129,33 +184,46 @@ func NewService(config Config, paymentCh chan<- *PaymentStatusUpdate) (*Service,
 		return nil, fmt.Errorf("failed to parse ERC20 ABI: %w", err)
 	}
 
-	// Define WebSocket endpoints (similar to frontend implementation)
-	wsEndpoints := []WebSocketEndpoint{
-		{
-			URL:        "wss://bsc-ws-node.nariox.org/",
-			Priority:   1,
-			Timeout:    5000,
-			Name:       "Nariox BSC Node",
-		},
-		{
-			URL:        "wss://bsc.publicnode.com/",
-			Priority:   2,
-			Timeout:    5000,
-			Name:       "Public Node BSC",
-		},
-		{
-			URL:        "wss://bsc-mainnet.nodereal.io/ws/v1/YOUR_API_KEY",
-			Priority:   3,
-			Timeout:    8000,
-			Name:       "NodeReal BSC (API Key required)",
-			RequiresAPIKey: true,
-		},
-		{
-			URL:        "wss://bsc-dataseed1.binance.org/ws/",
-			Priority:   4,
-			Timeout:    10000,
-			Name:       "Binance BSC DataSeed",
-		},
+	// Define WebSocket endpoints (similar to frontend implementation):
+	// the network's own URL first, then the public BSC nodes when watching BSC
+	wsEndpoints := config.WebsocketEndpoints
+	if len(wsEndpoints) == 0 && config.WebsocketURL != "" {
+		wsEndpoints = append(wsEndpoints, WebSocketEndpoint{
+			URL:            config.WebsocketURL,
+			Priority:       0,
+			Timeout:        5000,
+			Name:           config.NetworkID + " configured node",
+			RequiresAPIKey: strings.Contains(config.WebsocketURL, "YOUR_API_KEY"),
+		})
+	}
+	if len(config.WebsocketEndpoints) == 0 && config.ChainID == bscChainID {
+		wsEndpoints = append(wsEndpoints, []WebSocketEndpoint{
+			{
+				URL:        "wss://bsc-ws-node.nariox.org/",
+				Priority:   1,
+				Timeout:    5000,
+				Name:       "Nariox BSC Node",
+			},
+			{
+				URL:        "wss://bsc.publicnode.com/",
+				Priority:   2,
+				Timeout:    5000,
+				Name:       "Public Node BSC",
+			},
+			{
+				URL:        "wss://bsc-mainnet.nodereal.io/ws/v1/YOUR_API_KEY",
+				Priority:   3,
+				Timeout:    8000,
+				Name:       "NodeReal BSC (API Key required)",
+				RequiresAPIKey: true,
+			},
+			{
+				URL:        "wss://bsc-dataseed1.binance.org/ws/",
+				Priority:   4,
+				Timeout:    10000,
+				Name:       "Binance BSC DataSeed",
+			},
+		}...)
 	}
 
 	service := &Service{
@@ -164,6 +232,11 @@ func NewService(config Config, paymentCh chan<- *PaymentStatusUpdate) (*Service,
 		config:         config,
 		erc20ABI:       erc20ABI,
 		wsSubscriptions: make(map[string]string),
+		activePayments: make(map[string]*activePayment),
+		logFilters:     make(map[string]*logFilter),
+		pendingSubscribes: make(map[int64]string),
+		tokensByAddress: make(map[string]tokenInfo),
+		tokensBySymbol: make(map[string]tokenInfo),
 		isConnected:    false,
 		wsEndpoints:    wsEndpoints,
 		currentEndpointIndex: 0,
@@ -173,15 +246,23 @@ func NewService(config Config, paymentCh chan<- *PaymentStatusUpdate) (*Service,
 		lastConnectionTime: time.Time{},
 		lastDisconnectionTime: time.Time{},
 		connectionErrors: 0,
-		activeSubscriptions: 0,
-		paymentCh:      paymentCh,
-		mu:             sync.Mutex{},
+		headCh:         make(chan uint64, 1),
 		messageLog:     make([]WebSocketMessageLog, 0),
 		maxLogSize:     1000, // Keep last 1000 messages
+		stopCh:         make(chan struct{}),
 	}
 
+	// Poll for Transfer logs over HTTP whenever the WebSocket is unavailable
+	go service.startPollingScanner()
+
+	// Follow new block headers to track confirmations of detected transfers
+	go service.followChainHead()
+
+	// Keep the token registry in sync with the token store
+	go service.startTokenRefresher()
+
 	// Connect to WebSocket if URL is provided
-	if config.WebsocketURL != "" {
+	if config.WebsocketURL != "" || len(config.WebsocketEndpoints) > 0 {
 		go service.connectWebSocketWithFailover()
 
 		// Start periodic health check
@@ -198,6 +279,8 @@ func (s *Service) startHealthCheck() {
 
 	for {
 		select {
+		case <-s.stopCh:
+			return
 		case <-ticker.C:
 			// Check if we're still connected
 			if !s.IsWebSocketConnected() {
@@ -213,6 +296,10 @@ func (s *Service) startHealthCheck() {
 
 // connectWebSocketWithFailover establishes a WebSocket connection with failover support
 func (s *Service) connectWebSocketWithFailover() {
+	if s.closed() {
+		return
+	}
+
 	fmt.Println("🔌 [WebSocket] Starting WebSocket connection with failover support...")
 
 	// Reset reconnect attempts when starting fresh
@@ -225,7 +312,7 @@ func (s *Service) connectWebSocketWithFailover() {
 		return
 	}
 
-	fmt.Println("❌ [WebSocket] All endpoints failed, will retry...")
+	fmt.Println("❌ [WebSocket] All endpoints failed, will retry (HTTP polling covers new blocks meanwhile)...")
 
 	// If all endpoints fail, retry with exponential backoff
 	go s.retryConnectionWithBackoff()
@@ -257,6 +344,7 @@ func (s *Service) connectWebSocket() {
 	s.wsMu.Lock()
 	s.wsConn = conn
 	s.isConnected = true
+	s.wsCoveredFrom = 0
 	s.wsMu.Unlock()
 
 	fmt.Println("WebSocket connected successfully")
@@ -307,6 +395,9 @@ func (s *Service) tryConnectToEndpoints() bool {
 			// Start listening for messages
 			go s.listenWebSocket()
 
+			// Restore log subscriptions for payments that are still being monitored
+			s.subscribeToAllTransferEvents()
+
 			// Send a ping to test connection
 			s.sendPing()
 
@@ -339,6 +430,7 @@ func (s *Service) connectToEndpoint(endpoint WebSocketEndpoint) bool {
 	s.wsMu.Lock()
 	s.wsConn = conn
 	s.isConnected = true
+	s.wsCoveredFrom = 0
 	s.lastConnectionTime = time.Now()
 	s.wsMu.Unlock()
 
@@ -417,6 +509,9 @@ func (s *Service) listenWebSocket() {
 		// Read message
 		_, message, err := conn.ReadMessage()
 		if err != nil {
+			if s.closed() {
+				return
+			}
 			fmt.Printf("[Blockchain WebSocket] WebSocket read error: %v\n", err)
 			s.wsMu.Lock()
 			s.isConnected = false
@@ -428,8 +523,9 @@ func (s *Service) listenWebSocket() {
 			return
 		}
 
-		// Process message
-		go s.processWebSocketMessage(message)
+		// Process messages in the order the node sent them, so a removed: true log or a new head
+		// is never handled before the notification it follows
+		s.processWebSocketMessage(message)
 	}
 }
 
@@ -451,16 +547,9 @@ func (s *Service) processWebSocketMessage(message []byte) {
 	// Handle subscription responses
 	if id, ok := msg["id"].(float64); ok {
 		if result, ok := msg["result"].(string); ok {
-			// This is a subscription confirmation
-			fmt.Printf("[Blockchain WebSocket] Subscription confirmed: %s (id: %.0f)\n", result, id)
-			s.logMessage("subscription_confirmed", "in", map[string]interface{}{
-				"subscriptionId": result,
-				"requestId":      id,
-			})
-			// Store subscription ID for later reference
-			s.subscriptionMu.Lock()
-			s.wsSubscriptions[result] = fmt.Sprintf("subscription-%.0f", id)
-			s.subscriptionMu.Unlock()
+			s.handleSubscriptionConfirmed(int64(id), result)
+		} else if rpcErr, ok := msg["error"]; ok {
+			s.handleSubscriptionError(int64(id), rpcErr)
 		}
 	}
 
@@ -468,8 +557,13 @@ func (s *Service) processWebSocketMessage(message []byte) {
 	if method, ok := msg["method"].(string); ok && method == "eth_subscription" {
 		if params, ok := msg["params"].(map[string]interface{}); ok {
 			if result, ok := params["result"].(map[string]interface{}); ok {
-				s.logMessage("transfer_event", "in", result)
-				s.handleTransferEvent(result)
+				subscriptionID, _ := params["subscription"].(string)
+				if s.isNewHeadsSubscription(subscriptionID) {
+					s.handleNewHeadEvent(result)
+				} else {
+					s.logMessage("transfer_event", "in", result)
+					s.handleTransferEvent(subscriptionID, result)
+				}
 			}
 		}
 	}
@@ -485,7 +579,7 @@ func (s *Service) processWebSocketMessage(message []byte) {
 }
 
 // handleTransferEvent processes Transfer events
-func (s *Service) handleTransferEvent(event map[string]interface{}) {
+func (s *Service) handleTransferEvent(subscriptionID string, event map[string]interface{}) {
 	// Extract event data
 	topics, ok := event["topics"].([]interface{})
 	if !ok || len(topics) < 3 {
@@ -530,304 +624,593 @@ func (s *Service) handleTransferEvent(event map[string]interface{}) {
 	blockNumber := new(big.Int)
 	blockNumber.SetString(strings.TrimPrefix(blockNumberStr, "0x"), 16)
 
-	// Try to determine token symbol from address
-	tokenSymbol := s.getTokenSymbolFromAddress(event["address"].(string))
+	// Extract log position; the block hash tells a reorged block apart from its replacement
+	var logIndex uint64
+	if logIndexStr, ok := event["logIndex"].(string); ok {
+		logIndex, _ = strconv.ParseUint(strings.TrimPrefix(logIndexStr, "0x"), 16, 64)
+	}
+	blockHashStr, _ := event["blockHash"].(string)
+
+	// A log re-sent with removed: true means its block was reorged out
+	if removed, _ := event["removed"].(bool); removed {
+		fmt.Printf("[Blockchain WebSocket] Transfer %s was removed by a chain reorganization\n", txHash.Hex())
+		s.handleRemovedTransfer(txHash, uint(logIndex))
+		return
+	}
+
+	// Determine the token symbol from the subscription's filter, falling back to the contract address
+	contractAddress, _ := event["address"].(string)
+	tokenSymbol := s.getTokenSymbolFromSubscription(subscriptionID)
+	if tokenSymbol == "" {
+		tokenSymbol = s.getTokenSymbolFromAddress(contractAddress)
+	}
 
 	fmt.Printf("[Blockchain WebSocket] Transfer detected: %s -> %s, Amount: %s, TX: %s, Token: %s\n",
 		fromAddr.Hex(), toAddr.Hex(), amount.String(), txHash.Hex(), tokenSymbol)
 
 	// Check if this transfer matches any active payments
 	// Instead of checking against a single global receiver address, we check against all active payment addresses
-	activePaymentsMu.RLock()
-	hasActivePayments := len(activePayments) > 0
-	activePaymentsMu.RUnlock()
+	s.activePaymentsMu.RLock()
+	hasActivePayments := len(s.activePayments) > 0
+	s.activePaymentsMu.RUnlock()
 
 	if hasActivePayments {
 		// Trigger payment detection event
-		s.triggerPaymentDetected(fromAddr, toAddr, amount, txHash, blockNumber, tokenSymbol)
+		s.triggerPaymentDetected(&TokenTransfer{
+			From:        fromAddr,
+			To:          toAddr,
+			Value:       amount,
+			TxHash:      txHash,
+			BlockNumber: blockNumber,
+			TokenSymbol: tokenSymbol,
+			Token:       common.HexToAddress(contractAddress),
+			LogIndex:    uint(logIndex),
+			BlockHash:   common.HexToHash(blockHashStr),
+		})
 	} else {
 		fmt.Printf("[Blockchain WebSocket] No active payments monitoring, ignoring transfer\n")
 	}
 }
 
+// getTokenSymbolFromSubscription returns the token symbol of the log filter behind a subscription ID
+func (s *Service) getTokenSymbolFromSubscription(subscriptionID string) string {
+	s.subscriptionMu.RLock()
+	defer s.subscriptionMu.RUnlock()
+
+	if filter, ok := s.logFilters[s.wsSubscriptions[subscriptionID]]; ok {
+		return filter.tokenSymbol
+	}
+	return ""
+}
+
 // getTokenSymbolFromAddress determines token symbol from contract address
 func (s *Service) getTokenSymbolFromAddress(address string) string {
-	// Supported token addresses on BSC
-	tokenAddresses := map[string]string{
-		"0x55d398326f99059fF775485246999027B3197955": "USDT",
-		"0x8AC76a51cc950d9822D68b83fE1Ad97B32Cd580d": "USDC",
-		"0xe9e7CEA3DedcA5984780Bafc599bD69ADd087D56": "BUSD",
+	if !common.IsHexAddress(address) {
+		return "UNKNOWN"
 	}
 
-	if symbol, exists := tokenAddresses[strings.ToLower(address)]; exists {
-		return symbol
+	if token, exists := s.tokenByAddress(common.HexToAddress(address)); exists {
+		return token.symbol
 	}
 
 	return "UNKNOWN"
 }
 
-// triggerPaymentDetected handles detected payments
-func (s *Service) triggerPaymentDetected(from, to common.Address, amount *big.Int, txHash common.Hash, blockNumber *big.Int, tokenSymbol string) {
-	// Create a TokenTransfer object
-	transfer := &TokenTransfer{
-		From:        from,
-		To:          to,
-		Value:       amount,
-		TxHash:      txHash,
-		BlockNumber: blockNumber,
-		TokenSymbol: tokenSymbol,
-	}
-
+// triggerPaymentDetected credits a transfer to the active payment it belongs to and starts tracking its confirmations
+func (s *Service) triggerPaymentDetected(transfer *TokenTransfer) {
 	// Log the detected payment
 	fmt.Printf("[Blockchain WebSocket] Payment detected: %s %s from %s to %s in transaction %s at block %s\n",
-		amount.String(), tokenSymbol, from.Hex(), to.Hex(), txHash.Hex(), blockNumber.String())
+		transfer.Value.String(), transfer.TokenSymbol, transfer.From.Hex(), transfer.To.Hex(), transfer.TxHash.Hex(), transfer.BlockNumber.String())
 
-	// Check if this payment matches any active monitoring
-	activePaymentsMu.RLock()
-	defer activePaymentsMu.RUnlock()
+	confirmations := s.confirmationsAt(transfer.BlockNumber.Uint64())
 
-	// Create a list of matching payments to avoid concurrent map access issues
-	matchingPayments := make([]*activePayment, 0)
-	paymentIDs := make([]string, 0)
-	receiverAddresses := make([]common.Address, 0)
+	s.activePaymentsMu.Lock()
+	// The same log can arrive from the WebSocket, the poller and a backfill
+	if paymentID, _ := s.trackedTransferLocked(transfer.TxHash, transfer.LogIndex); paymentID != "" {
+		s.activePaymentsMu.Unlock()
+		return
+	}
+
+	paymentID, payment := s.matchPaymentLocked(transfer)
+	if payment == nil {
+		s.activePaymentsMu.Unlock()
+		fmt.Printf("[Blockchain WebSocket] No active payment for %s transfer to %s\n", transfer.TokenSymbol, transfer.To.Hex())
+		return
+	}
+
+	fmt.Printf("[Blockchain WebSocket] Payment %s matches receiver address %s\n", paymentID, payment.receiverAddress.Hex())
+
+	tracked := *transfer
+	tracked.Confirmations = confirmations
+	tracked.Confirmed = confirmations >= s.RequiredConfirmations()
+	payment.transfers = append(payment.transfers, &tracked)
+	update := tracked
+	s.activePaymentsMu.Unlock()
+
+	// Report the detection; the header follower reports further confirmations
+	s.reportTransfer(paymentID, update)
+}
 
-	for paymentID, payment := range activePayments {
-		// Check if the token symbol matches
-		if payment.tokenSymbol != tokenSymbol {
+// matchPaymentLocked picks the active payment a transfer is credited to. Among payments for the same
+// token and receiver it prefers one whose outstanding balance equals the transfer, then one still owed
+// money, then any. Within the same rank open payments come before those watched past their expiry for
+// late transfers, and older payments before newer ones. The caller holds activePaymentsMu.
+func (s *Service) matchPaymentLocked(transfer *TokenTransfer) (string, *activePayment) {
+	var (
+		bestID   string
+		best     *activePayment
+		bestRank int
+	)
+	for paymentID, payment := range s.activePayments {
+		if payment.tokenSymbol != transfer.TokenSymbol || payment.receiverAddress != transfer.To {
 			continue
 		}
 
-		// Check if the amount matches (with some tolerance for rounding errors)
-		// In a real implementation, you might want to use a more sophisticated comparison
-		if amount.Cmp(payment.expectedAmount) == 0 {
-			matchingPayments = append(matchingPayments, payment)
-			paymentIDs = append(paymentIDs, paymentID)
-			receiverAddresses = append(receiverAddresses, payment.receiverAddress)
+		remaining := new(big.Int).Sub(payment.expectedAmount, payment.received())
+		rank := 2
+		if remaining.Cmp(transfer.Value) == 0 {
+			rank = 6
+		} else if remaining.Sign() > 0 {
+			rank = 4
+		}
+		// Only a tiebreak, so an exact late match still beats an open payment it would overpay
+		if !payment.late {
+			rank++
 		}
-	}
-
-	// Filter matching payments by receiver address
-	actualMatchingPayments := make([]*activePayment, 0)
-	actualPaymentIDs := make([]string, 0)
 
-	for i, payment := range matchingPayments {
-		paymentID := paymentIDs[i]
-		expectedReceiver := receiverAddresses[i]
+		if rank > bestRank || (rank == bestRank && payment.startTime.Before(best.startTime)) {
+			bestID, best, bestRank = paymentID, payment, rank
+		}
+	}
+	return bestID, best
+}
 
-		// Check if the receiver address matches
-		if to == expectedReceiver {
-			actualMatchingPayments = append(actualMatchingPayments, payment)
-			actualPaymentIDs = append(actualPaymentIDs, paymentID)
-			fmt.Printf("[Blockchain WebSocket] Payment %s matches receiver address %s\n", paymentID, expectedReceiver.Hex())
-		} else {
-			fmt.Printf("[Blockchain WebSocket] Payment %s does not match receiver address %s (expected) vs %s (actual)\n",
-				paymentID, expectedReceiver.Hex(), to.Hex())
+// trackedTransferLocked finds the payment a transfer was already credited to. The caller holds activePaymentsMu.
+func (s *Service) trackedTransferLocked(txHash common.Hash, logIndex uint) (string, *TokenTransfer) {
+	for paymentID, payment := range s.activePayments {
+		if transfer := payment.trackedTransfer(txHash, logIndex); transfer != nil {
+			return paymentID, transfer
 		}
 	}
+	return "", nil
+}
 
-	// Trigger callbacks for matching payments and send WebSocket notifications
-	for i, payment := range actualMatchingPayments {
-		paymentID := actualPaymentIDs[i]
-		// Remove the payment from active monitoring
-		activePaymentsMu.RUnlock()
-		activePaymentsMu.Lock()
-		delete(activePayments, paymentID)
-		activePaymentsMu.Unlock()
-		activePaymentsMu.RLock()
+// bscChainID is the chain ID of BNB Smart Chain mainnet, which has public WebSocket fallbacks
+const bscChainID = 56
 
-		// Trigger the callback
-		if payment.callback != nil {
-			payment.callback(transfer, nil)
-		}
+// transferEventSignature is keccak256("Transfer(address,address,uint256)")
+const transferEventSignature = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
 
-		// Send payment status update to WebSocket manager if channel is available
-		if s.paymentCh != nil {
-			// Convert amount to string with proper decimal places
-			amountStr := new(big.Float).Quo(new(big.Float).SetInt(amount), big.NewFloat(1e18)).Text('f', 6)
-
-			// Create payment status update
-			update := &PaymentStatusUpdate{
-				PaymentID:       paymentID,
-				Status:          "paid",
-				TransactionHash: txHash.Hex(),
-				BlockNumber:     blockNumber.Int64(),
-				Confirmations:   1, // This would need to be updated as more blocks are mined
-				Amount:          amountStr,
-				Token:           tokenSymbol,
-			}
+// logFilter describes an eth_subscribe("logs") filter for Transfer events of one token to one receiver
+type logFilter struct {
+	tokenAddress common.Address
+	tokenSymbol  string
+	receiver     common.Address
+}
 
-			// Try to send the update, but don't block
-			select {
-			case s.paymentCh <- update:
-				fmt.Printf("[Blockchain WebSocket] Sent payment status update for payment %s to WebSocket manager\n", paymentID)
-			default:
-				fmt.Printf("[Blockchain WebSocket] Failed to send payment status update for payment %s - channel full\n", paymentID)
-			}
-		}
+// transferFilterKey returns the key under which a token/receiver log filter is tracked
+func transferFilterKey(tokenAddress, receiver common.Address) string {
+	return tokenAddress.Hex() + ":" + receiver.Hex()
+}
+
+// params returns the eth_subscribe filter object: the token contract, the Transfer topic and the receiver as topic[2]
+func (f *logFilter) params() map[string]interface{} {
+	return map[string]interface{}{
+		"address": f.tokenAddress.Hex(),
+		"topics": []interface{}{
+			transferEventSignature,
+			nil,
+			common.BytesToHash(f.receiver.Bytes()).Hex(),
+		},
 	}
 }
 
-// subscribeToTransferEvents subscribes to Transfer events for a specific token
-// Note: This method is deprecated and should not be used. For payment-specific monitoring,
-// StartPaymentMonitoringWithCallback should be used instead.
-func (s *Service) subscribeToTransferEvents(tokenAddress common.Address, tokenSymbol string) error {
+// sendRPCRequest writes a JSON-RPC request to the WebSocket connection and returns its request id
+func (s *Service) sendRPCRequest(method string, params []interface{}) (int64, error) {
 	s.wsMu.Lock()
 	defer s.wsMu.Unlock()
 
 	if s.wsConn == nil || !s.isConnected {
-		return fmt.Errorf("WebSocket not connected")
+		return 0, fmt.Errorf("WebSocket not connected")
 	}
 
-	// This method is deprecated as we no longer use a global receiver address.
-	// Payments should use StartPaymentMonitoringWithCallback with their specific address.
-	// We're keeping this method for backward compatibility but it won't actually subscribe to anything.
-	fmt.Printf("[Blockchain WebSocket] WARNING: subscribeToTransferEvents is deprecated and does nothing\n")
-	fmt.Printf("[Blockchain WebSocket] Use StartPaymentMonitoringWithCallback for payment-specific monitoring\n")
+	id := atomic.AddInt64(&s.nextRequestID, 1)
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+		"id":      id,
+	}
 
-	// Log the deprecated call
-	s.logMessage("subscribe_transfer_deprecated", "out", map[string]interface{}{
-		"tokenSymbol": tokenSymbol,
-		"tokenAddress": tokenAddress.Hex(),
-		"warning": "This method is deprecated and does nothing",
-	})
+	// Log the outgoing message
+	s.logMessage(method, "out", request)
+
+	if err := s.wsConn.WriteJSON(request); err != nil {
+		s.isConnected = false
+		return 0, fmt.Errorf("failed to send %s: %w", method, err)
+	}
+
+	return id, nil
+}
+
+// subscribeToTransferEvents subscribes to Transfer events of a token sent to a specific receiver address.
+// The filter is remembered even if the WebSocket is down so it can be sent once the connection is back.
+func (s *Service) subscribeToTransferEvents(tokenAddress common.Address, tokenSymbol string, receiver common.Address) error {
+	key := transferFilterKey(tokenAddress, receiver)
+
+	s.subscriptionMu.Lock()
+	defer s.subscriptionMu.Unlock()
+
+	// Another payment to the same receiver already owns this subscription
+	if _, exists := s.logFilters[key]; exists {
+		return nil
+	}
+
+	filter := &logFilter{
+		tokenAddress: tokenAddress,
+		tokenSymbol:  tokenSymbol,
+		receiver:     receiver,
+	}
+	s.logFilters[key] = filter
+
+	if err := s.sendSubscribeRequest(key, filter); err != nil {
+		fmt.Printf("[Blockchain WebSocket] Deferring %s subscription for %s until reconnect: %v\n", tokenSymbol, receiver.Hex(), err)
+	}
 
-	// Return success but don't actually subscribe
 	return nil
 }
 
-// subscribeToAllTransferEvents subscribes to Transfer events for all supported tokens
-// Note: This method is deprecated as subscribeToTransferEvents is now a no-op
+// sendSubscribeRequest sends eth_subscribe for a log filter. The caller must hold subscriptionMu.
+func (s *Service) sendSubscribeRequest(key string, filter *logFilter) error {
+	id, err := s.sendRPCRequest("eth_subscribe", []interface{}{"logs", filter.params()})
+	if err != nil {
+		return err
+	}
+
+	s.pendingSubscribes[id] = key
+	fmt.Printf("[Blockchain WebSocket] Subscribing to %s transfers to %s (id: %d)\n", filter.tokenSymbol, filter.receiver.Hex(), id)
+	return nil
+}
+
+// subscribeToAllTransferEvents (re)sends eth_subscribe for every log filter wanted by active payments.
+// It is called after each successful connection, since subscription IDs do not survive a reconnect.
 func (s *Service) subscribeToAllTransferEvents() {
-	// This method is deprecated as subscribeToTransferEvents is now a no-op
-	// Payments should use StartPaymentMonitoringWithCallback with their specific address
-	fmt.Printf("[Blockchain WebSocket] WARNING: subscribeToAllTransferEvents is deprecated and does nothing\n")
-	fmt.Printf("[Blockchain WebSocket] Use StartPaymentMonitoringWithCallback for payment-specific monitoring\n")
-
-	// Log the deprecated call
-	s.logMessage("subscribe_all_transfer_deprecated", "out", map[string]interface{}{
-		"warning": "This method is deprecated and does nothing",
+	s.subscriptionMu.Lock()
+	defer s.subscriptionMu.Unlock()
+
+	// Subscription IDs belong to the previous connection
+	s.wsSubscriptions = make(map[string]string)
+	s.pendingSubscribes = make(map[int64]string)
+
+	// New block headers drive confirmation tracking
+	if id, err := s.sendRPCRequest("eth_subscribe", []interface{}{"newHeads"}); err != nil {
+		fmt.Printf("[Blockchain WebSocket] Failed to subscribe to new heads: %v\n", err)
+	} else {
+		s.pendingSubscribes[id] = newHeadsSubscriptionKey
+	}
+
+	if len(s.logFilters) == 0 {
+		return
+	}
+
+	fmt.Printf("[Blockchain WebSocket] Restoring %d log subscriptions\n", len(s.logFilters))
+	s.logMessage("resubscribe", "out", map[string]interface{}{
+		"filters": len(s.logFilters),
+	})
+
+	for key, filter := range s.logFilters {
+		if err := s.sendSubscribeRequest(key, filter); err != nil {
+			fmt.Printf("[Blockchain WebSocket] Failed to restore subscription %s: %v\n", key, err)
+			return
+		}
+	}
+}
+
+// unsubscribeFromTransferEvents drops a log filter and sends eth_unsubscribe for its subscription IDs
+func (s *Service) unsubscribeFromTransferEvents(key string) {
+	s.subscriptionMu.Lock()
+	defer s.subscriptionMu.Unlock()
+
+	delete(s.logFilters, key)
+
+	for subscriptionID, filterKey := range s.wsSubscriptions {
+		if filterKey != key {
+			continue
+		}
+		delete(s.wsSubscriptions, subscriptionID)
+
+		if _, err := s.sendRPCRequest("eth_unsubscribe", []interface{}{subscriptionID}); err != nil {
+			fmt.Printf("[Blockchain WebSocket] Failed to unsubscribe %s: %v\n", subscriptionID, err)
+		} else {
+			fmt.Printf("[Blockchain WebSocket] Unsubscribed %s (%s)\n", subscriptionID, key)
+		}
+	}
+}
+
+// handleSubscriptionConfirmed records the subscription ID returned for an eth_subscribe request
+func (s *Service) handleSubscriptionConfirmed(requestID int64, subscriptionID string) {
+	s.subscriptionMu.Lock()
+	defer s.subscriptionMu.Unlock()
+
+	key, ok := s.pendingSubscribes[requestID]
+	if !ok {
+		// Not a subscription request (e.g. a net_version ping)
+		return
+	}
+	delete(s.pendingSubscribes, requestID)
+
+	fmt.Printf("[Blockchain WebSocket] Subscription confirmed: %s (id: %d)\n", subscriptionID, requestID)
+	s.logMessage("subscription_confirmed", "in", map[string]interface{}{
+		"subscriptionId": subscriptionID,
+		"requestId":      requestID,
+		"filter":         key,
 	})
+
+	// The payments that needed this filter finished before the node confirmed it
+	if _, wanted := s.logFilters[key]; !wanted && key != newHeadsSubscriptionKey {
+		if _, err := s.sendRPCRequest("eth_unsubscribe", []interface{}{subscriptionID}); err != nil {
+			fmt.Printf("[Blockchain WebSocket] Failed to unsubscribe %s: %v\n", subscriptionID, err)
+		}
+		return
+	}
+
+	s.wsSubscriptions[subscriptionID] = key
+}
+
+// subscriptionsConfirmed reports whether the newHeads subscription and every wanted log filter
+// have a confirmed subscription on the current connection
+func (s *Service) subscriptionsConfirmed() bool {
+	s.subscriptionMu.RLock()
+	defer s.subscriptionMu.RUnlock()
+
+	confirmed := make(map[string]bool, len(s.wsSubscriptions))
+	for _, key := range s.wsSubscriptions {
+		confirmed[key] = true
+	}
+	if !confirmed[newHeadsSubscriptionKey] {
+		return false
+	}
+	for key := range s.logFilters {
+		if !confirmed[key] {
+			return false
+		}
+	}
+	return true
 }
 
+// markSubscriptionCoverage records the first new head announced once all subscriptions of the connection
+// are confirmed. The node delivers the Transfer logs of that block and every later one, so the polling
+// scanner only needs to cover the blocks before it.
+func (s *Service) markSubscriptionCoverage(blockNumber uint64) {
+	s.wsMu.Lock()
+	known := s.wsCoveredFrom != 0
+	s.wsMu.Unlock()
+	if known || !s.subscriptionsConfirmed() {
+		return
+	}
 
+	s.wsMu.Lock()
+	if s.isConnected && s.wsCoveredFrom == 0 {
+		s.wsCoveredFrom = blockNumber
+		fmt.Printf("[Blockchain WebSocket] Subscriptions cover blocks from %d\n", blockNumber)
+	}
+	s.wsMu.Unlock()
+}
 
-// activePayments stores information about active payment monitoring
+// subscriptionCoverage returns the first block covered by the WebSocket subscriptions, and false
+// while the WebSocket is down or its subscriptions are not yet known to be live
+func (s *Service) subscriptionCoverage() (uint64, bool) {
+	s.wsMu.Lock()
+	defer s.wsMu.Unlock()
+	return s.wsCoveredFrom, s.isConnected && s.wsCoveredFrom > 0
+}
+
+// handleSubscriptionError logs a rejected eth_subscribe request; the filter is retried on the next reconnect
+func (s *Service) handleSubscriptionError(requestID int64, rpcErr interface{}) {
+	s.subscriptionMu.Lock()
+	defer s.subscriptionMu.Unlock()
+
+	key, ok := s.pendingSubscribes[requestID]
+	if !ok {
+		return
+	}
+	delete(s.pendingSubscribes, requestID)
+
+	fmt.Printf("[Blockchain WebSocket] Subscription %s rejected: %v\n", key, rpcErr)
+	s.logMessage("subscription_error", "in", map[string]interface{}{
+		"requestId": requestID,
+		"filter":    key,
+		"error":     rpcErr,
+	})
+}
+
+// activePayment stores information about active payment monitoring
 type activePayment struct {
 	tokenSymbol     string
+	tokenAddress    common.Address
 	expectedAmount  *big.Int
 	receiverAddress common.Address
 	callback        PaymentCallback
 	startTime       time.Time
 	timeout         time.Duration
+	late            bool // Expired, but still watched for late payments
+
+	// transfers are the matched transfers credited to this payment; removed transfers are dropped
+	transfers []*TokenTransfer
+}
+
+// received returns the total value of the payment's credited transfers
+func (p *activePayment) received() *big.Int {
+	total := new(big.Int)
+	for _, transfer := range p.transfers {
+		total.Add(total, transfer.Value)
+	}
+	return total
+}
+
+// hasUnconfirmed reports whether any credited transfer is still waiting for confirmations
+func (p *activePayment) hasUnconfirmed() bool {
+	for _, transfer := range p.transfers {
+		if !transfer.Confirmed {
+			return true
+		}
+	}
+	return false
 }
 
-// activePaymentsMap stores all active payments
-var activePayments = make(map[string]*activePayment)
-var activePaymentsMu sync.RWMutex
+// trackedTransfer returns the credited transfer identified by txHash and logIndex, if any
+func (p *activePayment) trackedTransfer(txHash common.Hash, logIndex uint) *TokenTransfer {
+	for _, transfer := range p.transfers {
+		if sameTransfer(transfer, txHash, logIndex) {
+			return transfer
+		}
+	}
+	return nil
+}
+
+// ErrPaymentTimeout is passed to a payment's callback when its monitoring window closes without a transfer
+var ErrPaymentTimeout = errors.New("payment monitoring timeout")
+
 
 // StartPaymentMonitoringWithCallback starts monitoring for a specific payment with a callback
 func (s *Service) StartPaymentMonitoringWithCallback(paymentID, tokenSymbol, receiverAddress string, expectedAmount *big.Int, timeout time.Duration, callback PaymentCallback) error {
+	// Resolve the token contract to subscribe to
+	token, exists := s.tokenBySymbol(tokenSymbol)
+	if !exists {
+		return fmt.Errorf("unsupported token symbol: %s", tokenSymbol)
+	}
+
+	tokenAddress := token.address
+
 	// Convert receiver address to common.Address
 	receiverAddr := common.HexToAddress(receiverAddress)
 
-	// Store payment information
-	activePaymentsMu.Lock()
-	activePayments[paymentID] = &activePayment{
+	// Store payment information and subscribe to Transfer events to this receiver
+	s.activePaymentsMu.Lock()
+	s.activePayments[paymentID] = &activePayment{
 		tokenSymbol:     tokenSymbol,
+		tokenAddress:    tokenAddress,
 		expectedAmount:  expectedAmount,
 		receiverAddress: receiverAddr,
 		callback:        callback,
 		startTime:       time.Now(),
 		timeout:         timeout,
 	}
-	activePaymentsMu.Unlock()
+	err := s.subscribeToTransferEvents(tokenAddress, tokenSymbol, receiverAddr)
+	s.activePaymentsMu.Unlock()
 
 	fmt.Printf("[Blockchain WebSocket] Started monitoring for payment %s to address %s\n", paymentID, receiverAddr.Hex())
 
 	// Set up a timeout timer
 	if timeout > 0 {
 		time.AfterFunc(timeout, func() {
-			activePaymentsMu.Lock()
-			_, exists := activePayments[paymentID]
-			if exists {
-				delete(activePayments, paymentID)
-				activePaymentsMu.Unlock()
-				callback(nil, fmt.Errorf("payment monitoring timeout for %s", paymentID))
-				return
-			}
-			activePaymentsMu.Unlock()
+			s.timeoutActivePayment(paymentID)
 		})
 	}
 
-	// Subscribe to Transfer events for this token if not already subscribed
-	tokenAddresses := map[string]string{
-		"USDT": "0x55d398326f99059fF775485246999027B3197955",
-		"USDC": "0x8AC76a51cc950d9822D68b83fE1Ad97B32Cd580d",
-		"BUSD": "0xe9e7CEA3DedcA5984780Bafc599bD69ADd087D56",
+	return err
+}
+
+// timeoutActivePayment stops monitoring a payment that saw no transfer in time.
+// A payment with a confirming transfer is left to its confirmations; it times out if that transfer is reorged out.
+func (s *Service) timeoutActivePayment(paymentID string) {
+	s.activePaymentsMu.Lock()
+	payment, exists := s.activePayments[paymentID]
+	// Transfers that are still confirming keep the payment open past its window
+	if !exists || payment.hasUnconfirmed() {
+		s.activePaymentsMu.Unlock()
+		return
+	}
+	s.removeActivePaymentLocked(paymentID)
+	s.activePaymentsMu.Unlock()
+
+	if payment.callback != nil {
+		payment.callback(nil, fmt.Errorf("%w for %s", ErrPaymentTimeout, paymentID))
 	}
+}
+
+// StopPaymentMonitoring stops watching for a payment without invoking its callback
+func (s *Service) StopPaymentMonitoring(paymentID string) {
+	if _, removed := s.removeActivePayment(paymentID); removed {
+		fmt.Printf("[Blockchain WebSocket] Stopped monitoring for payment %s\n", paymentID)
+	}
+}
+
+// MarkPaymentLate keeps watching a payment whose session expired, so transfers in its grace window
+// are still reported. Open payments for the same receiver are matched first.
+func (s *Service) MarkPaymentLate(paymentID string) {
+	s.activePaymentsMu.Lock()
+	defer s.activePaymentsMu.Unlock()
 
-	addressStr, exists := tokenAddresses[tokenSymbol]
+	if payment, exists := s.activePayments[paymentID]; exists {
+		payment.late = true
+	}
+}
+
+// TrackTransfer credits a transfer found outside the live watcher, such as a customer claim, to an active payment
+// so its confirmations are followed like a detected transfer. It reports whether the transfer was added.
+func (s *Service) TrackTransfer(paymentID string, transfer *TokenTransfer) bool {
+	s.activePaymentsMu.Lock()
+	defer s.activePaymentsMu.Unlock()
+
+	payment, exists := s.activePayments[paymentID]
 	if !exists {
-		return fmt.Errorf("unsupported token symbol: %s", tokenSymbol)
+		return false
+	}
+	if paymentID, _ := s.trackedTransferLocked(transfer.TxHash, transfer.LogIndex); paymentID != "" {
+		return false
 	}
 
-	tokenAddress := common.HexToAddress(addressStr)
+	tracked := *transfer
+	payment.transfers = append(payment.transfers, &tracked)
+	return true
+}
+
+// removeActivePayment stops monitoring a payment and unsubscribes its log filter once no other payment needs it
+func (s *Service) removeActivePayment(paymentID string) (*activePayment, bool) {
+	s.activePaymentsMu.Lock()
+	defer s.activePaymentsMu.Unlock()
 
-	// Subscribe to Transfer events for this token
-	return s.subscribeToTransferEvents(tokenAddress, tokenSymbol)
+	return s.removeActivePaymentLocked(paymentID)
 }
 
-// MonitorTokenTransfers monitors token transfers to the receiver address
-func (s *Service) MonitorTokenTransfers(ctx context.Context, tokenAddress common.Address, expectedAmount *big.Int) (<-chan *TokenTransfer, error) {
-	transferCh := make(chan *TokenTransfer, 100)
-
-	// Subscribe to Transfer events if WebSocket is available
-	if s.config.WebsocketURL != "" && s.isConnected {
-		// In a real implementation, you would set up event subscriptions here
-		// For now, we'll simulate transfers for testing
-		go func() {
-			defer close(transferCh)
-
-			// Simulate monitoring
-			ticker := time.NewTicker(5 * time.Second)
-			defer ticker.Stop()
-
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-ticker.C:
-					// This is just for demonstration - in reality you would listen for actual events
-					continue
-				}
-			}
-		}()
-	} else {
-		// Fallback to polling if WebSocket is not available
-		go func() {
-			defer close(transferCh)
-
-			// Simulate monitoring
-			ticker := time.NewTicker(5 * time.Second)
-			defer ticker.Stop()
-
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-ticker.C:
-					// This is just for demonstration - in reality you would listen for actual events
-					continue
-				}
-			}
-		}()
+// removeActivePaymentLocked is removeActivePayment for callers holding activePaymentsMu
+func (s *Service) removeActivePaymentLocked(paymentID string) (*activePayment, bool) {
+	payment, exists := s.activePayments[paymentID]
+	if !exists {
+		return nil, false
 	}
+	delete(s.activePayments, paymentID)
 
-	return transferCh, nil
+	key := transferFilterKey(payment.tokenAddress, payment.receiverAddress)
+	for _, other := range s.activePayments {
+		if transferFilterKey(other.tokenAddress, other.receiverAddress) == key {
+			return payment, true
+		}
+	}
+
+	s.unsubscribeFromTransferEvents(key)
+	return payment, true
 }
 
-// ValidatePayment validates a payment by checking the transaction
+// Rejection reasons reported in PaymentValidationResult.Reason
+const (
+	ValidationReverted      = "reverted"       // The transaction failed on chain
+	ValidationWrongToken    = "wrong_token"    // No Transfer from the session token's contract
+	ValidationWrongReceiver = "wrong_receiver" // The token was transferred to another address
+	ValidationWrongAmount   = "wrong_amount"   // The receiver got a different amount than expected
+	ValidationWrongSender   = "wrong_sender"   // The token was transferred from another address than expected
+)
+
+// ValidatePayment validates a payment by checking the transaction. A nil expectedAmount accepts any amount
+// of the token paid to the receiver, leaving the caller to settle the amount reported in the result.
 func (s *Service) ValidatePayment(ctx context.Context, txHash common.Hash, expectedAmount *big.Int, tokenSymbol, expectedReceiverAddress string) (*PaymentValidationResult, error) {
+	return s.ValidateTransfer(ctx, txHash, expectedAmount, tokenSymbol, "", expectedReceiverAddress)
+}
+
+// ValidateTransfer validates a transaction like ValidatePayment, additionally requiring the transfer to come
+// from expectedSenderAddress when it is set, such as a refund sent from a session's receiver address
+func (s *Service) ValidateTransfer(ctx context.Context, txHash common.Hash, expectedAmount *big.Int, tokenSymbol, expectedSenderAddress, expectedReceiverAddress string) (*PaymentValidationResult, error) {
 	// Get transaction receipt
 	receipt, err := s.client.TransactionReceipt(ctx, txHash)
 	if err != nil {
@@ -838,7 +1221,7 @@ func (s *Service) ValidatePayment(ctx context.Context, txHash common.Hash, expec
 	if receipt.Status != types.ReceiptStatusSuccessful {
 		return &PaymentValidationResult{
 			Valid:   false,
-			Reason:  "Transaction failed",
+			Reason:  ValidationReverted,
 			Receipt: receipt,
 		}, nil
 	}
@@ -849,81 +1232,137 @@ func (s *Service) ValidatePayment(ctx context.Context, txHash common.Hash, expec
 		return nil, fmt.Errorf("failed to get transaction: %w", err)
 	}
 
+	// Recover who signed the transaction; a failure is not fatal for token transfers, whose payer is in the log
+	txSender, err := s.TxFrom(ctx, tx)
+	if err != nil {
+		fmt.Printf("[Blockchain Validation] %s: %v\n", txHash.Hex(), err)
+	}
+
 	// For token transfers, we need to parse the logs
 	expectedTo := common.HexToAddress(expectedReceiverAddress)
+	var expectedFrom *common.Address
+	if expectedSenderAddress != "" {
+		from := common.HexToAddress(expectedSenderAddress)
+		expectedFrom = &from
+	}
 
-	// Check if this is a direct ETH transfer or token transfer
-	if tx.To() != nil && *tx.To() == expectedTo {
-		// Direct ETH transfer
-		if tx.Value().Cmp(expectedAmount) == 0 {
+	// Tokens registered for this network are validated against their contract's Transfer logs
+	token, isToken := s.tokenBySymbol(tokenSymbol)
+	if !isToken {
+		// A token missing from the registry (disabled, or not reloaded yet) must not be matched against the
+		// transaction value, or a transfer of a few wei would pay a session of the same number of base units
+		if s.config.NativeCurrency == "" || !strings.EqualFold(tokenSymbol, s.config.NativeCurrency) {
 			return &PaymentValidationResult{
-				Valid:   true,
-				Reason:  "Valid ETH transfer",
+				Valid:   false,
+				Reason:  ValidationWrongToken,
 				Receipt: receipt,
-				From:    s.TxFrom(ctx, tx),
-				To:      *tx.To(),
-				Amount:  tx.Value(),
+				TxSender: txSender,
 			}, nil
-		} else {
+		}
+		if tx.To() == nil || *tx.To() != expectedTo {
 			return &PaymentValidationResult{
 				Valid:   false,
-				Reason:  "ETH amount mismatch",
+				Reason:  ValidationWrongReceiver,
 				Receipt: receipt,
-				From:    s.TxFrom(ctx, tx),
-				To:      *tx.To(),
-				Amount:  tx.Value(),
+				TxSender: txSender,
 			}, nil
 		}
-	} else {
-		// Token transfer - check logs for Transfer events
-		valid, from, amount, err := s.validateTokenTransfer(ctx, receipt, expectedTo, expectedAmount, tokenSymbol)
-		if err != nil {
-			return nil, fmt.Errorf("failed to validate token transfer: %w", err)
-		}
 
-		if valid {
+		if expectedFrom != nil && txSender != *expectedFrom {
 			return &PaymentValidationResult{
-				Valid:   true,
-				Reason:  "Valid token transfer",
+				Valid:   false,
+				Reason:  ValidationWrongSender,
 				Receipt: receipt,
-				From:    from,
-				To:      expectedTo,
-				Amount:  amount,
+				TxSender: txSender,
 			}, nil
-		} else {
+		}
+
+		// Direct ETH transfer
+		if expectedAmount == nil || tx.Value().Cmp(expectedAmount) == 0 {
 			return &PaymentValidationResult{
-				Valid:   false,
-				Reason:  "Invalid token transfer",
+				Valid:   true,
+				Reason:  "Valid ETH transfer",
 				Receipt: receipt,
+				From:    txSender,
+				TxSender: txSender,
+				To:      *tx.To(),
+				Amount:  tx.Value(),
+				Confirmations: s.receiptConfirmations(ctx, receipt),
 			}, nil
 		}
+		return &PaymentValidationResult{
+			Valid:   false,
+			Reason:  ValidationWrongAmount,
+			Receipt: receipt,
+			From:    txSender,
+			TxSender: txSender,
+			To:      *tx.To(),
+			Amount:  tx.Value(),
+		}, nil
 	}
+
+	// Token transfer - check logs for Transfer events
+	log, reason := validateTokenTransfer(receipt, token.address, expectedFrom, expectedTo, expectedAmount)
+	if reason != "" {
+		return &PaymentValidationResult{
+			Valid:   false,
+			Reason:  reason,
+			Receipt: receipt,
+			TxSender: txSender,
+		}, nil
+	}
+
+	return &PaymentValidationResult{
+		Valid:   true,
+		Reason:  "Valid token transfer",
+		Receipt: receipt,
+		From:    common.BytesToAddress(log.Topics[1].Bytes()),
+		TxSender: txSender,
+		To:      expectedTo,
+		Amount:  new(big.Int).SetBytes(log.Data),
+		Token:   token.address,
+		LogIndex: log.Index,
+		Confirmations: s.receiptConfirmations(ctx, receipt),
+	}, nil
 }
 
-// validateTokenTransfer validates a token transfer by parsing logs
-func (s *Service) validateTokenTransfer(ctx context.Context, receipt *types.Receipt, expectedTo common.Address, expectedAmount *big.Int, tokenSymbol string) (bool, common.Address, *big.Int, error) {
-	// Look for Transfer events in the logs
+// validateTokenTransfer looks for a Transfer log from the token contract paying the expected amount to the receiver,
+// or any amount when expectedAmount is nil, from expectedFrom when it is set. When there is none it returns the
+// rejection reason of the closest log.
+func validateTokenTransfer(receipt *types.Receipt, tokenAddress common.Address, expectedFrom *common.Address, expectedTo common.Address, expectedAmount *big.Int) (*types.Log, string) {
+	reason := ValidationWrongToken
 	for _, log := range receipt.Logs {
-		// Check if this is a Transfer event (keccak256("Transfer(address,address,uint256)"))
-		if log.Topics[0].Hex() == "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef" {
-			// Parse the event data
-			if len(log.Topics) >= 3 && log.Data != nil {
-				// Extract from and to addresses from topics
-				from := common.BytesToAddress(log.Topics[1].Bytes())
-				to := common.BytesToAddress(log.Topics[2].Bytes())
-				
-				// Extract amount from data
-				amount := new(big.Int).SetBytes(log.Data)
-				
-				// Check if this is the expected transfer
-				if to == expectedTo && amount.Cmp(expectedAmount) == 0 {
-					return true, from, amount, nil
-				}
+		// Transfer(address indexed from, address indexed to, uint256 value) has three topics and a 32-byte value
+		if log == nil || len(log.Topics) < 3 || log.Topics[0] != common.HexToHash(transferEventSignature) || len(log.Data) != 32 {
+			continue
+		}
+		if log.Address != tokenAddress {
+			continue
+		}
+
+		to := common.BytesToAddress(log.Topics[2].Bytes())
+		amount := new(big.Int).SetBytes(log.Data)
+
+		if to != expectedTo {
+			if reason == ValidationWrongToken {
+				reason = ValidationWrongReceiver
+			}
+			continue
+		}
+		if expectedFrom != nil && common.BytesToAddress(log.Topics[1].Bytes()) != *expectedFrom {
+			if reason != ValidationWrongAmount {
+				reason = ValidationWrongSender
 			}
+			continue
+		}
+		if expectedAmount != nil && amount.Cmp(expectedAmount) != 0 {
+			reason = ValidationWrongAmount
+			continue
 		}
+		return log, ""
 	}
-	
-	return false, common.Address{}, nil, nil
+
+	return nil, reason
 }
 
 // GetTokenBalance gets the token balance of an address
@@ -979,6 +1418,10 @@ func (s *Service) IsWebSocketConnected() bool {
 
 // GetConnectionStats returns blockchain WebSocket connection statistics
 func (s *Service) GetConnectionStats() map[string]interface{} {
+	s.subscriptionMu.RLock()
+	activeSubscriptions := len(s.wsSubscriptions)
+	s.subscriptionMu.RUnlock()
+
 	s.wsMu.Lock()
 	defer s.wsMu.Unlock()
 
@@ -987,7 +1430,7 @@ func (s *Service) GetConnectionStats() map[string]interface{} {
 	stats["totalConnectionAttempts"] = s.totalConnectionAttempts
 	stats["reconnectAttempts"] = s.reconnectAttempts
 	stats["connectionErrors"] = s.connectionErrors
-	stats["activeSubscriptions"] = s.activeSubscriptions
+	stats["activeSubscriptions"] = activeSubscriptions
 	stats["lastConnectionTime"] = s.lastConnectionTime
 	stats["lastDisconnectionTime"] = s.lastDisconnectionTime
 	stats["currentEndpointIndex"] = s.currentEndpointIndex
@@ -1001,13 +1444,6 @@ func (s *Service) GetConnectionStats() map[string]interface{} {
 	return stats
 }
 
-// SetPaymentChannel sets the payment status update channel
-func (s *Service) SetPaymentChannel(paymentCh chan<- *PaymentStatusUpdate) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.paymentCh = paymentCh
-}
-
 // logMessage adds a message to the message log
 func (s *Service) logMessage(msgType, direction string, data interface{}) {
 	s.logMu.Lock()
@@ -1015,6 +1451,7 @@ func (s *Service) logMessage(msgType, direction string, data interface{}) {
 
 	logEntry := WebSocketMessageLog{
 		Type:      msgType,
+		NetworkID: s.config.NetworkID,
 		Direction: direction,
 		Data:      data,
 		Timestamp: time.Now(),
@@ -1051,8 +1488,22 @@ func (s *Service) GetMessageLog(limit int) []WebSocketMessageLog {
 	return result
 }
 
+// closed reports whether the service was closed
+func (s *Service) closed() bool {
+	select {
+	case <-s.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
 // Close closes the blockchain connections
 func (s *Service) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stopCh)
+	})
+
 	if s.client != nil {
 		s.client.Close()
 	}
@@ -1070,11 +1521,25 @@ func (s *Service) Close() {
 	s.wsMu.Unlock()
 }
 
-// TxFrom extracts the sender address from a transaction
-func (s *Service) TxFrom(ctx context.Context, tx *types.Transaction) common.Address {
-	// This would normally use types.Sender() with a signer
-	// For now, returning zero address
-	return common.Address{}
+// TxFrom recovers the sender address of a transaction from its signature using the network's chain ID.
+// Legacy, EIP-155, EIP-2930 and EIP-1559 transactions are supported.
+func (s *Service) TxFrom(ctx context.Context, tx *types.Transaction) (common.Address, error) {
+	if tx.Protected() && s.config.ChainID > 0 && tx.ChainId().Cmp(big.NewInt(s.config.ChainID)) != 0 {
+		return common.Address{}, fmt.Errorf("transaction chain ID %s does not match network chain ID %d", tx.ChainId(), s.config.ChainID)
+	}
+
+	var chainID *big.Int
+	if s.config.ChainID > 0 {
+		chainID = big.NewInt(s.config.ChainID)
+	} else if tx.Protected() {
+		chainID = tx.ChainId()
+	}
+
+	from, err := types.Sender(types.LatestSignerForChainID(chainID), tx)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to recover transaction sender: %w", err)
+	}
+	return from, nil
 }
 
 // PaymentValidationResult represents the result of payment validation
@@ -1083,8 +1548,12 @@ type PaymentValidationResult struct {
 	Reason  string           `json:"reason"`
 	Receipt *types.Receipt   `json:"receipt"`
 	From    common.Address   `json:"from"`
+	TxSender common.Address  `json:"txSender"` // Signer of the transaction, which may differ from a token transfer's From
 	To      common.Address   `json:"to"`
 	Amount  *big.Int         `json:"amount"`
+	Token    common.Address  `json:"token"`    // Token contract of a valid token transfer
+	LogIndex uint            `json:"logIndex"` // Position of the matching Transfer log in its block
+	Confirmations int        `json:"confirmations"`
 }
 
 // ERC20 ABI JSON for parsing contract events
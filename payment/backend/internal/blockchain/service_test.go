@@ -0,0 +1,590 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gorilla/websocket"
+
+	"payment-backend/internal/models"
+)
+
+func TestTxFrom(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xe27577B0e3920cE35f100f66430de0108cb78a04")
+
+	const networkChainID = 56
+
+	tests := []struct {
+		name    string
+		signer  types.Signer
+		tx      types.TxData
+		wantErr bool
+	}{
+		{
+			name:   "legacy unprotected",
+			signer: types.HomesteadSigner{},
+			tx:     &types.LegacyTx{Nonce: 1, GasPrice: big.NewInt(1e9), Gas: 21000, To: &to, Value: big.NewInt(1)},
+		},
+		{
+			name:   "legacy EIP-155",
+			signer: types.NewEIP155Signer(big.NewInt(networkChainID)),
+			tx:     &types.LegacyTx{Nonce: 2, GasPrice: big.NewInt(1e9), Gas: 21000, To: &to, Value: big.NewInt(1)},
+		},
+		{
+			name:   "EIP-2930 access list",
+			signer: types.NewEIP2930Signer(big.NewInt(networkChainID)),
+			tx: &types.AccessListTx{ChainID: big.NewInt(networkChainID), Nonce: 3, GasPrice: big.NewInt(1e9), Gas: 21000, To: &to, Value: big.NewInt(1),
+				AccessList: types.AccessList{{Address: to, StorageKeys: []common.Hash{{1}}}}},
+		},
+		{
+			name:   "EIP-1559 dynamic fee",
+			signer: types.NewLondonSigner(big.NewInt(networkChainID)),
+			tx:     &types.DynamicFeeTx{ChainID: big.NewInt(networkChainID), Nonce: 4, GasTipCap: big.NewInt(1e9), GasFeeCap: big.NewInt(2e9), Gas: 21000, To: &to, Value: big.NewInt(1)},
+		},
+		{
+			name:    "EIP-155 signed for another chain",
+			signer:  types.NewEIP155Signer(big.NewInt(1)),
+			tx:      &types.LegacyTx{Nonce: 5, GasPrice: big.NewInt(1e9), Gas: 21000, To: &to, Value: big.NewInt(1)},
+			wantErr: true,
+		},
+		{
+			name:    "EIP-1559 signed for another chain",
+			signer:  types.NewLondonSigner(big.NewInt(1)),
+			tx:      &types.DynamicFeeTx{ChainID: big.NewInt(1), Nonce: 6, GasTipCap: big.NewInt(1e9), GasFeeCap: big.NewInt(2e9), Gas: 21000, To: &to, Value: big.NewInt(1)},
+			wantErr: true,
+		},
+	}
+
+	s := &Service{config: Config{ChainID: networkChainID}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := types.SignNewTx(key, tt.signer, tt.tx)
+			if err != nil {
+				t.Fatalf("failed to sign transaction: %v", err)
+			}
+
+			from, err := s.TxFrom(context.Background(), tx)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("TxFrom() = %s, want an error", from.Hex())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("TxFrom() error = %v", err)
+			}
+			if from != sender {
+				t.Errorf("TxFrom() = %s, want %s", from.Hex(), sender.Hex())
+			}
+		})
+	}
+}
+
+func TestMatchPaymentLocked(t *testing.T) {
+	receiver := common.HexToAddress("0xe27577B0e3920cE35f100f66430de0108cb78a04")
+	now := time.Now()
+	payment := func(expected int64, late bool, age time.Duration) *activePayment {
+		return &activePayment{
+			tokenSymbol:     "USDT",
+			expectedAmount:  big.NewInt(expected),
+			receiverAddress: receiver,
+			startTime:       now.Add(-age),
+			late:            late,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		payments map[string]*activePayment
+		value    int64
+		want     string
+	}{
+		{
+			name: "exact late match beats an open payment it would overpay",
+			payments: map[string]*activePayment{
+				"open": payment(5, false, time.Minute),
+				"late": payment(10, true, time.Hour),
+			},
+			value: 10,
+			want:  "late",
+		},
+		{
+			name: "open payment wins a tie with a late one",
+			payments: map[string]*activePayment{
+				"open": payment(10, false, time.Minute),
+				"late": payment(10, true, time.Hour),
+			},
+			value: 10,
+			want:  "open",
+		},
+		{
+			name: "oldest open payment wins a tie",
+			payments: map[string]*activePayment{
+				"newer": payment(20, false, time.Minute),
+				"older": payment(30, false, time.Hour),
+			},
+			value: 10,
+			want:  "older",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{activePayments: tt.payments}
+			got, _ := s.matchPaymentLocked(&TokenTransfer{To: receiver, TokenSymbol: "USDT", Value: big.NewInt(tt.value)})
+			if got != tt.want {
+				t.Errorf("matchPaymentLocked() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// rpcRequest is a JSON-RPC request received by the fake node
+type rpcRequest struct {
+	ID     int64             `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// fakeNode serves JSON-RPC over HTTP and WebSocket like an Ethereum node. It answers eth_subscribe with
+// numbered subscription IDs, reports every WebSocket request on requests and lets the test push notifications.
+// Over HTTP it reports head as the latest block, answers eth_getLogs from logs, recording each queried range,
+// and serves the transactions and receipts stored with addTransaction.
+type fakeNode struct {
+	server   *httptest.Server
+	requests chan rpcRequest
+
+	mu            sync.Mutex
+	conn          *websocket.Conn
+	subscriptions int
+	head          uint64
+	logs          []types.Log
+	logQueries    [][2]uint64
+	transactions  map[common.Hash]*types.Transaction
+	receipts      map[common.Hash]*types.Receipt
+}
+
+func newFakeNode(t *testing.T) *fakeNode {
+	node := &fakeNode{
+		requests:     make(chan rpcRequest, 100),
+		head:         1,
+		transactions: make(map[common.Hash]*types.Transaction),
+		receipts:     make(map[common.Hash]*types.Receipt),
+	}
+	upgrader := websocket.Upgrader{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		node.mu.Lock()
+		node.conn = conn
+		node.mu.Unlock()
+
+		for {
+			var req rpcRequest
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+
+			var result interface{} = true
+			switch req.Method {
+			case "eth_subscribe":
+				node.mu.Lock()
+				node.subscriptions++
+				result = fmt.Sprintf("0x%x", node.subscriptions)
+				node.mu.Unlock()
+			case "net_version":
+				result = "1337"
+			}
+			node.write(t, map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+			node.requests <- req
+		}
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		var req rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var result interface{}
+		node.mu.Lock()
+		switch req.Method {
+		case "eth_blockNumber":
+			result = fmt.Sprintf("0x%x", node.head)
+		case "eth_getLogs":
+			var query struct {
+				FromBlock string `json:"fromBlock"`
+				ToBlock   string `json:"toBlock"`
+			}
+			json.Unmarshal(req.Params[0], &query)
+			from, _ := strconv.ParseUint(strings.TrimPrefix(query.FromBlock, "0x"), 16, 64)
+			to, _ := strconv.ParseUint(strings.TrimPrefix(query.ToBlock, "0x"), 16, 64)
+			node.logQueries = append(node.logQueries, [2]uint64{from, to})
+
+			logs := []types.Log{}
+			for _, log := range node.logs {
+				if log.BlockNumber >= from && log.BlockNumber <= to {
+					logs = append(logs, log)
+				}
+			}
+			result = logs
+		case "eth_getTransactionByHash", "eth_getTransactionReceipt":
+			var hash common.Hash
+			json.Unmarshal(req.Params[0], &hash)
+			if req.Method == "eth_getTransactionByHash" {
+				if tx, ok := node.transactions[hash]; ok {
+					result = tx
+				}
+			} else if receipt, ok := node.receipts[hash]; ok {
+				result = receipt
+			}
+		}
+		node.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	})
+
+	node.server = httptest.NewServer(mux)
+	return node
+}
+
+// setHead sets the block number reported by eth_blockNumber
+func (n *fakeNode) setHead(head uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.head = head
+}
+
+// addTransaction stores a transaction and its receipt, which is completed with the transaction hash
+func (n *fakeNode) addTransaction(tx *types.Transaction, receipt *types.Receipt) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	receipt.TxHash = tx.Hash()
+	n.transactions[tx.Hash()] = tx
+	n.receipts[tx.Hash()] = receipt
+}
+
+// takeLogQueries returns the block ranges queried with eth_getLogs since the last call
+func (n *fakeNode) takeLogQueries() [][2]uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	queries := n.logQueries
+	n.logQueries = nil
+	return queries
+}
+
+// waitForSubscription waits until a subscription ID is confirmed on the service
+func waitForSubscription(t *testing.T, s *Service, subscriptionID string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.subscriptionMu.RLock()
+		_, confirmed := s.wsSubscriptions[subscriptionID]
+		s.subscriptionMu.RUnlock()
+		if confirmed {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("subscription %s was not confirmed", subscriptionID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// wsURL returns the WebSocket endpoint of the fake node
+func (n *fakeNode) wsURL() string {
+	return "ws" + strings.TrimPrefix(n.server.URL, "http") + "/ws"
+}
+
+// write sends a frame on the current WebSocket connection
+func (n *fakeNode) write(t *testing.T, msg interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.conn.WriteJSON(msg); err != nil {
+		t.Errorf("fake node write failed: %v", err)
+	}
+}
+
+// drop closes the current WebSocket connection
+func (n *fakeNode) drop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.conn.Close()
+}
+
+// expect waits for the next WebSocket request with the given method, skipping pings
+func (n *fakeNode) expect(t *testing.T, method string) rpcRequest {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case req := <-n.requests:
+			if req.Method == "net_version" {
+				continue
+			}
+			if req.Method != method {
+				t.Fatalf("fake node got %s, want %s", req.Method, method)
+			}
+			return req
+		case <-timeout:
+			t.Fatalf("fake node did not receive %s", method)
+		}
+	}
+}
+
+// fakeTokens is a token store with a fixed token list
+type fakeTokens []*models.Token
+
+func (f fakeTokens) GetAllTokens() ([]*models.Token, error) {
+	return f, nil
+}
+
+func TestWebSocketTransferSubscription(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.server.Close()
+
+	token := common.HexToAddress("0x55d398326f99059fF775485246999027B3197955")
+	receiver := common.HexToAddress("0xe27577B0e3920cE35f100f66430de0108cb78a04")
+	payer := common.HexToAddress("0x1111111111111111111111111111111111111111")
+
+	s, err := NewService(Config{
+		RPCURL:                node.server.URL,
+		ChainID:               1337,
+		NetworkID:             "TEST",
+		PollInterval:          time.Hour,
+		RequiredConfirmations: 3,
+		WebsocketEndpoints:    []WebSocketEndpoint{{URL: node.wsURL(), Timeout: 1000, Name: "fake node"}},
+	})
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer s.Close()
+	if err := s.SetTokenStore(fakeTokens{{Symbol: "USDT", ContractAddress: token.Hex(), Decimals: 18, NetworkID: "TEST", Enabled: true}}); err != nil {
+		t.Fatalf("SetTokenStore() error = %v", err)
+	}
+
+	// The header follower subscribes as soon as the connection is up
+	if req := node.expect(t, "eth_subscribe"); string(req.Params[0]) != `"newHeads"` {
+		t.Fatalf("first subscription = %s, want newHeads", req.Params[0])
+	}
+
+	transfers := make(chan TokenTransfer, 100)
+	err = s.StartPaymentMonitoringWithCallback("pay_1", "USDT", receiver.Hex(), big.NewInt(100), 0, func(transfer *TokenTransfer, err error) {
+		if transfer != nil {
+			transfers <- *transfer
+		}
+	})
+	if err != nil {
+		t.Fatalf("StartPaymentMonitoringWithCallback() error = %v", err)
+	}
+
+	// The log filter names the token contract, the Transfer topic and the receiver as topic[2]
+	req := node.expect(t, "eth_subscribe")
+	var filter struct {
+		Address string    `json:"address"`
+		Topics  []*string `json:"topics"`
+	}
+	if string(req.Params[0]) != `"logs"` || json.Unmarshal(req.Params[1], &filter) != nil {
+		t.Fatalf("log subscription params = %s", req.Params)
+	}
+	if common.HexToAddress(filter.Address) != token || len(filter.Topics) != 3 ||
+		filter.Topics[0] == nil || *filter.Topics[0] != transferEventSignature || filter.Topics[1] != nil ||
+		filter.Topics[2] == nil || common.HexToAddress(*filter.Topics[2]) != receiver {
+		t.Fatalf("log filter = %+v", filter)
+	}
+	subscriptionID := "0x2"
+
+	// Each log is followed immediately by its removal; handling them out of order would lose the removal
+	const logs = 20
+	for i := 0; i < logs; i++ {
+		for _, removed := range []bool{false, true} {
+			node.write(t, map[string]interface{}{
+				"jsonrpc": "2.0",
+				"method":  "eth_subscription",
+				"params": map[string]interface{}{
+					"subscription": subscriptionID,
+					"result": map[string]interface{}{
+						"address":         token.Hex(),
+						"topics":          []string{transferEventSignature, common.BytesToHash(payer.Bytes()).Hex(), common.BytesToHash(receiver.Bytes()).Hex()},
+						"data":            common.BytesToHash(big.NewInt(100).Bytes()).Hex(),
+						"blockNumber":     "0x10",
+						"blockHash":       common.BigToHash(big.NewInt(int64(i + 1))).Hex(),
+						"transactionHash": common.BigToHash(big.NewInt(int64(1000 + i))).Hex(),
+						"logIndex":        "0x0",
+						"removed":         removed,
+					},
+				},
+			})
+		}
+	}
+	for i := 0; i < logs; i++ {
+		wantHash := common.BigToHash(big.NewInt(int64(1000 + i)))
+		for _, wantRemoved := range []bool{false, true} {
+			select {
+			case transfer := <-transfers:
+				if transfer.TxHash != wantHash || transfer.Removed != wantRemoved {
+					t.Fatalf("transfer %d = %s removed=%v, want %s removed=%v", i, transfer.TxHash.Hex(), transfer.Removed, wantHash.Hex(), wantRemoved)
+				}
+				if !wantRemoved && (transfer.Value.Cmp(big.NewInt(100)) != 0 || transfer.From != payer || transfer.TokenSymbol != "USDT") {
+					t.Fatalf("transfer %d = %+v", i, transfer)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("transfer %d removed=%v was not reported", i, wantRemoved)
+			}
+		}
+	}
+
+	// After a reconnect both subscriptions are restored
+	node.drop()
+	if req := node.expect(t, "eth_subscribe"); string(req.Params[0]) != `"newHeads"` {
+		t.Fatalf("resubscription = %s, want newHeads", req.Params[0])
+	}
+	if req := node.expect(t, "eth_subscribe"); string(req.Params[0]) != `"logs"` {
+		t.Fatalf("resubscription = %s, want logs", req.Params[0])
+	}
+
+	// Stopping the last payment for the receiver unsubscribes the restored log subscription
+	waitForSubscription(t, s, "0x4")
+	s.StopPaymentMonitoring("pay_1")
+	if req := node.expect(t, "eth_unsubscribe"); string(req.Params[0]) != `"0x4"` {
+		t.Fatalf("eth_unsubscribe params = %s, want 0x4", req.Params[0])
+	}
+}
+
+func TestValidateTokenTransferReasons(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.server.Close()
+	node.setHead(10)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	payer := crypto.PubkeyToAddress(key.PublicKey)
+	token := common.HexToAddress("0x55d398326f99059fF775485246999027B3197955")
+	otherToken := common.HexToAddress("0x8AC76a51cc950d9822D68b83fE1Ad97B32Cd580d")
+	receiver := common.HexToAddress("0xe27577B0e3920cE35f100f66430de0108cb78a04")
+	otherReceiver := common.HexToAddress("0x2222222222222222222222222222222222222222")
+
+	s, err := NewService(Config{
+		RPCURL:                node.server.URL,
+		ChainID:               1337,
+		NetworkID:             "TEST",
+		PollInterval:          time.Hour,
+		RequiredConfirmations: 3,
+		WebsocketEndpoints:    []WebSocketEndpoint{{URL: node.wsURL(), Timeout: 1000, Name: "fake node"}},
+	})
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer s.Close()
+	if err := s.SetTokenStore(fakeTokens{{Symbol: "USDT", ContractAddress: token.Hex(), Decimals: 18, NetworkID: "TEST", Enabled: true}}); err != nil {
+		t.Fatalf("SetTokenStore() error = %v", err)
+	}
+
+	transferLog := func(contract, to common.Address, amount int64) *types.Log {
+		return &types.Log{
+			Address: contract,
+			Topics:  []common.Hash{common.HexToHash(transferEventSignature), common.BytesToHash(payer.Bytes()), common.BytesToHash(to.Bytes())},
+			Data:    common.BigToHash(big.NewInt(amount)).Bytes(),
+		}
+	}
+
+	tests := []struct {
+		name       string
+		status     uint64
+		logs       []*types.Log
+		wantValid  bool
+		wantReason string
+	}{
+		{
+			name:       "valid",
+			status:     types.ReceiptStatusSuccessful,
+			logs:       []*types.Log{transferLog(token, receiver, 100)},
+			wantValid:  true,
+			wantReason: "Valid token transfer",
+		},
+		{
+			name:       "reverted",
+			status:     types.ReceiptStatusFailed,
+			logs:       []*types.Log{transferLog(token, receiver, 100)},
+			wantReason: ValidationReverted,
+		},
+		{
+			name:       "wrong token",
+			status:     types.ReceiptStatusSuccessful,
+			logs:       []*types.Log{transferLog(otherToken, receiver, 100)},
+			wantReason: ValidationWrongToken,
+		},
+		{
+			name:       "wrong receiver",
+			status:     types.ReceiptStatusSuccessful,
+			logs:       []*types.Log{transferLog(token, otherReceiver, 100)},
+			wantReason: ValidationWrongReceiver,
+		},
+		{
+			name:       "wrong amount",
+			status:     types.ReceiptStatusSuccessful,
+			logs:       []*types.Log{transferLog(token, otherReceiver, 100), transferLog(token, receiver, 99)},
+			wantReason: ValidationWrongAmount,
+		},
+		{
+			name:       "empty topics",
+			status:     types.ReceiptStatusSuccessful,
+			logs:       []*types.Log{{Address: token, Topics: []common.Hash{}, Data: common.BigToHash(big.NewInt(100)).Bytes()}},
+			wantReason: ValidationWrongToken,
+		},
+		{
+			name:       "no logs",
+			status:     types.ReceiptStatusSuccessful,
+			logs:       []*types.Log{},
+			wantReason: ValidationWrongToken,
+		},
+	}
+
+	signer := types.NewLondonSigner(big.NewInt(1337))
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{ChainID: big.NewInt(1337), Nonce: uint64(i), GasTipCap: big.NewInt(1e9),
+				GasFeeCap: big.NewInt(2e9), Gas: 60000, To: &token, Data: []byte{0xa9, 0x05, 0x9c, 0xbb}})
+			if err != nil {
+				t.Fatalf("failed to sign transaction: %v", err)
+			}
+			for _, log := range tt.logs {
+				log.TxHash = tx.Hash()
+				log.BlockNumber = 5
+			}
+			node.addTransaction(tx, &types.Receipt{Status: tt.status, Logs: tt.logs, BlockNumber: big.NewInt(5)})
+
+			result, err := s.ValidatePayment(context.Background(), tx.Hash(), big.NewInt(100), "USDT", receiver.Hex())
+			if err != nil {
+				t.Fatalf("ValidatePayment() error = %v", err)
+			}
+			if result.Valid != tt.wantValid || result.Reason != tt.wantReason {
+				t.Errorf("ValidatePayment() = valid %v, reason %q, want valid %v, reason %q", result.Valid, result.Reason, tt.wantValid, tt.wantReason)
+			}
+			if tt.wantValid && (result.From != payer || result.Amount.Cmp(big.NewInt(100)) != 0 || result.Confirmations != 6) {
+				t.Errorf("ValidatePayment() = from %s, amount %s, %d confirmations", result.From.Hex(), result.Amount, result.Confirmations)
+			}
+		})
+	}
+}
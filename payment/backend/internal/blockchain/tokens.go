@@ -0,0 +1,126 @@
+package blockchain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"payment-backend/internal/models"
+)
+
+// defaultTokenRefreshInterval is used when Config.TokenRefreshInterval is not set
+const defaultTokenRefreshInterval = time.Minute
+
+// TokenStore provides the enabled tokens the service can monitor
+type TokenStore interface {
+	GetAllTokens() ([]*models.Token, error)
+}
+
+// tokenInfo describes a token contract in the registry
+type tokenInfo struct {
+	symbol    string
+	address   common.Address
+	decimals  int
+	networkID string
+}
+
+// tokenAddressKey builds the registry key of a token contract on a network
+func tokenAddressKey(networkID string, address common.Address) string {
+	return networkID + ":" + address.Hex()
+}
+
+// tokenSymbolKey builds the registry key of a token symbol on a network
+func tokenSymbolKey(networkID, symbol string) string {
+	return networkID + ":" + symbol
+}
+
+// SetTokenStore sets the store the token registry is loaded from and loads it
+func (s *Service) SetTokenStore(store TokenStore) error {
+	s.tokensMu.Lock()
+	s.tokenStore = store
+	s.tokensMu.Unlock()
+
+	return s.ReloadTokens()
+}
+
+// ReloadTokens reloads the token registry from the token store
+func (s *Service) ReloadTokens() error {
+	s.tokensMu.RLock()
+	store := s.tokenStore
+	s.tokensMu.RUnlock()
+	if store == nil {
+		return nil
+	}
+
+	tokens, err := store.GetAllTokens()
+	if err != nil {
+		return fmt.Errorf("failed to load tokens: %w", err)
+	}
+
+	byAddress := make(map[string]tokenInfo, len(tokens))
+	bySymbol := make(map[string]tokenInfo, len(tokens))
+	for _, token := range tokens {
+		if !common.IsHexAddress(token.ContractAddress) {
+			fmt.Printf("[Blockchain Tokens] Skipping %s on %s: invalid contract address %q\n", token.Symbol, token.NetworkID, token.ContractAddress)
+			continue
+		}
+
+		info := tokenInfo{
+			symbol:    token.Symbol,
+			address:   common.HexToAddress(token.ContractAddress),
+			decimals:  token.Decimals,
+			networkID: token.NetworkID,
+		}
+		byAddress[tokenAddressKey(info.networkID, info.address)] = info
+		bySymbol[tokenSymbolKey(info.networkID, info.symbol)] = info
+	}
+
+	s.tokensMu.Lock()
+	s.tokensByAddress = byAddress
+	s.tokensBySymbol = bySymbol
+	s.tokensMu.Unlock()
+
+	return nil
+}
+
+// tokenRefreshInterval returns the configured token registry refresh interval
+func (s *Service) tokenRefreshInterval() time.Duration {
+	if s.config.TokenRefreshInterval > 0 {
+		return s.config.TokenRefreshInterval
+	}
+	return defaultTokenRefreshInterval
+}
+
+// startTokenRefresher periodically reloads the token registry so token changes apply without a restart
+func (s *Service) startTokenRefresher() {
+	ticker := time.NewTicker(s.tokenRefreshInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.ReloadTokens(); err != nil {
+				fmt.Printf("[Blockchain Tokens] Refresh failed: %v\n", err)
+			}
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// tokenBySymbol looks up a token on this service's network by symbol
+func (s *Service) tokenBySymbol(symbol string) (tokenInfo, bool) {
+	s.tokensMu.RLock()
+	defer s.tokensMu.RUnlock()
+	info, ok := s.tokensBySymbol[tokenSymbolKey(s.config.NetworkID, symbol)]
+	return info, ok
+}
+
+// tokenByAddress looks up a token on this service's network by contract address
+func (s *Service) tokenByAddress(address common.Address) (tokenInfo, bool) {
+	s.tokensMu.RLock()
+	defer s.tokensMu.RUnlock()
+	info, ok := s.tokensByAddress[tokenAddressKey(s.config.NetworkID, address)]
+	return info, ok
+}
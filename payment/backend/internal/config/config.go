@@ -8,23 +8,64 @@ import (
 
 // Config holds the application configuration
 type Config struct {
-	ServerPort      int
-	DBPath          string
-	JWTSecret       string
-	BlockchainRPC   string
-	PaymentTimeout  time.Duration
-	DebugMode       bool
+	ServerPort             int
+	DBPath                 string
+	JWTSecret              string
+	AdminAPIKey            string
+	PaymentTokenTTL        time.Duration
+	IdempotencyKeyTTL      time.Duration
+	BlockchainRPC          string
+	BlockchainPollInterval time.Duration
+	TokenRefreshInterval   time.Duration
+	PaymentTimeout         time.Duration
+	LatePaymentGrace       time.Duration
+	ExpirySweepInterval    time.Duration
+	PaymentToleranceBps    int
+	DepositXpub            string
+	UniqueAmountSlots      int
+	UniqueAmountStep       string
+	WebhookPollInterval    time.Duration
+	WebhookMaxAttempts     int
+	WebhookTimeout         time.Duration
+	WebhookAllowPrivate    bool
+	RefundVerifyInterval   time.Duration
+	DebugMode              bool
+}
+
+// publicJWTSecret is the JWT_SECRET shipped in older sample configurations; it signs nothing securely
+const publicJWTSecret = "payment_secret_key"
+
+// HasInsecureJWTSecret reports whether JWT_SECRET is unset or the public sample value,
+// with which anyone could forge payment tokens
+func (c *Config) HasInsecureJWTSecret() bool {
+	return c.JWTSecret == "" || c.JWTSecret == publicJWTSecret
 }
 
 // Load loads configuration from environment variables
 func Load() *Config {
 	cfg := &Config{
-		ServerPort:      getEnvInt("SERVER_PORT", 8080),
-		DBPath:          getEnv("DB_PATH", "./data/payment.db"),
-		JWTSecret:       getEnv("JWT_SECRET", "payment_secret_key"),
-		BlockchainRPC:   getEnv("BLOCKCHAIN_RPC", "https://bsc-dataseed1.binance.org/"),
-		PaymentTimeout:  getEnvDuration("PAYMENT_TIMEOUT", 30*time.Minute),
-		DebugMode:       getEnv("DEBUG_MODE", "false") == "true",
+		ServerPort:             getEnvInt("SERVER_PORT", 8080),
+		DBPath:                 getEnv("DB_PATH", "./data/payment.db"),
+		JWTSecret:              getEnv("JWT_SECRET", ""),
+		AdminAPIKey:            getEnv("ADMIN_API_KEY", ""),
+		PaymentTokenTTL:        getEnvDuration("PAYMENT_TOKEN_TTL", time.Hour),
+		IdempotencyKeyTTL:      getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+		BlockchainRPC:          getEnv("BLOCKCHAIN_RPC", "https://bsc-dataseed1.binance.org/"),
+		BlockchainPollInterval: getEnvDuration("BLOCKCHAIN_POLL_INTERVAL", 5*time.Second),
+		TokenRefreshInterval:   getEnvDuration("TOKEN_REFRESH_INTERVAL", time.Minute),
+		PaymentTimeout:         getEnvDuration("PAYMENT_TIMEOUT", 30*time.Minute),
+		LatePaymentGrace:       getEnvDuration("LATE_PAYMENT_GRACE", time.Hour),
+		ExpirySweepInterval:    getEnvDuration("EXPIRY_SWEEP_INTERVAL", 30*time.Second),
+		PaymentToleranceBps:    getEnvInt("PAYMENT_TOLERANCE_BPS", 0),
+		DepositXpub:            getEnv("DEPOSIT_XPUB", ""),
+		UniqueAmountSlots:      getEnvInt("UNIQUE_AMOUNT_SLOTS", 0),
+		UniqueAmountStep:       getEnv("UNIQUE_AMOUNT_STEP", "0.0001"),
+		WebhookPollInterval:    getEnvDuration("WEBHOOK_POLL_INTERVAL", 5*time.Second),
+		WebhookMaxAttempts:     getEnvInt("WEBHOOK_MAX_ATTEMPTS", 10),
+		WebhookTimeout:         getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookAllowPrivate:    getEnv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "false") == "true",
+		RefundVerifyInterval:   getEnvDuration("REFUND_VERIFY_INTERVAL", 30*time.Second),
+		DebugMode:              getEnv("DEBUG_MODE", "false") == "true",
 	}
 
 	return cfg
@@ -56,4 +97,4 @@ func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 		}
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// IdempotencyKey records a merchant's Idempotency-Key and the response it produced, so a retried
+// request is answered with the original response instead of creating a second session
+type IdempotencyKey struct {
+	MerchantID     string    `json:"merchantId" db:"merchant_id"`
+	Key            string    `json:"key" db:"idempotency_key"`
+	RequestHash    string    `json:"requestHash" db:"request_hash"` // SHA-256 of the normalized request body
+	PaymentID      *string   `json:"paymentId,omitempty" db:"payment_id"`
+	ResponseStatus *int      `json:"responseStatus,omitempty" db:"response_status"` // Nil while the first request is in progress
+	ResponseBody   *string   `json:"responseBody,omitempty" db:"response_body"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+	ExpiresAt      time.Time `json:"expiresAt" db:"expires_at"` // End of the in-progress lease, then of the replay window
+}
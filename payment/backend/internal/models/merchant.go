@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Merchant represents an API client that creates payment sessions
+type Merchant struct {
+	ID           int64     `json:"id" db:"id"`
+	MerchantID   string    `json:"merchantId" db:"merchant_id"`
+	Name         string    `json:"name" db:"name"`
+	APIKeyPrefix string    `json:"apiKeyPrefix" db:"api_key_prefix"` // First characters of the key, to tell keys apart
+	APIKeyHash   string    `json:"-" db:"api_key_hash"`              // SHA-256 of the key; the key itself is never stored
+	Enabled      bool      `json:"enabled" db:"enabled"`
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt    time.Time `json:"updatedAt" db:"updated_at"`
+}
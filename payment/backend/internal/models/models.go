@@ -10,18 +10,33 @@ type PaymentStatus string
 const (
 	PaymentCreated PaymentStatus = "created"
 	PaymentPending PaymentStatus = "pending"
+	PaymentConfirming PaymentStatus = "confirming" // Transfer detected, waiting for the required confirmations
 	PaymentPaid    PaymentStatus = "paid"
+	PaymentUnderpaid PaymentStatus = "underpaid" // Window closed with less than the amount due received
+	PaymentOverpaid  PaymentStatus = "overpaid"  // Confirmed with more than the amount due received
+	PaymentPaidLate  PaymentStatus = "paid_late" // Paid in the grace window after expiry; the merchant accepts or refunds it
 	PaymentExpired PaymentStatus = "expired"
 	PaymentFailed  PaymentStatus = "failed"
+	PaymentCancelled PaymentStatus = "cancelled" // Cancelled by the merchant; transfers arriving afterwards are flagged for refund
 )
 
 // PaymentSession represents a payment session
 type PaymentSession struct {
 	ID             int64         `json:"id" db:"id"`
 	PaymentID      string        `json:"paymentId" db:"payment_id"`
+	MerchantID     *string       `json:"merchantId,omitempty" db:"merchant_id"` // Merchant that created the session
+	MerchantOrderID *string      `json:"merchantOrderId,omitempty" db:"merchant_order_id"` // Merchant's own order reference, unique per merchant
 	ProductID      string        `json:"productId" db:"product_id"`
 	ProductName    string        `json:"productName" db:"product_name"`
-	Amount         float64       `json:"amount" db:"amount"`
+	Amount         string        `json:"amount" db:"amount"` // Decimal amount in whole tokens, e.g. "12.5"
+	AmountBaseUnits string       `json:"amountBaseUnits" db:"amount_base_units"` // Amount in the token's smallest unit
+	TokenDecimals  int           `json:"tokenDecimals" db:"token_decimals"`
+	AmountReceivedBaseUnits string `json:"amountReceivedBaseUnits" db:"amount_received_base_units"` // Total of the credited transfers
+	PayAmountBaseUnits *string   `json:"payAmountBaseUnits,omitempty" db:"pay_amount_base_units"` // Amount plus a unique offset, when enabled
+	DerivationIndex *int64       `json:"derivationIndex,omitempty" db:"derivation_index"` // Child index of a receiver derived from DEPOSIT_XPUB
+	Metadata       *string       `json:"metadata,omitempty" db:"metadata"` // Merchant-defined JSON object
+	SuccessURL     *string       `json:"successUrl,omitempty" db:"success_url"` // Where to send the customer after paying
+	CancelURL      *string       `json:"cancelUrl,omitempty" db:"cancel_url"`   // Where to send a customer who gives up
 	Currency       string        `json:"currency" db:"currency"`
 	TokenSymbol    string        `json:"tokenSymbol" db:"token_symbol"`
 	NetworkID      string        `json:"networkId" db:"network_id"`
@@ -31,6 +46,7 @@ type PaymentSession struct {
 	QRCodeData     *string       `json:"qrCodeData,omitempty" db:"qr_code_data"`
 	TransactionHash *string      `json:"transactionHash,omitempty" db:"transaction_hash"`
 	BlockNumber    *int64        `json:"blockNumber,omitempty" db:"block_number"`
+	StartBlock     *int64        `json:"startBlock,omitempty" db:"start_block"` // Chain head when the session was created
 	ConfirmedAt    *time.Time    `json:"confirmedAt,omitempty" db:"confirmed_at"`
 	ExpiresAt      time.Time     `json:"expiresAt" db:"expires_at"`
 	CreatedAt      time.Time     `json:"createdAt" db:"created_at"`
@@ -58,7 +74,26 @@ type Network struct {
 	RPCURL        string    `json:"rpcUrl" db:"rpc_url"`
 	WebsocketURL  *string   `json:"websocketUrl,omitempty" db:"websocket_url"`
 	BlockExplorer *string   `json:"blockExplorer,omitempty" db:"block_explorer"`
+	RequiredConfirmations int `json:"requiredConfirmations" db:"required_confirmations"`
+	NativeCurrency string   `json:"nativeCurrency" db:"native_currency"` // Symbol of the coin the chain pays gas in, e.g. ETH or BNB
 	Enabled       bool      `json:"enabled" db:"enabled"`
 	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
 	UpdatedAt     time.Time `json:"updatedAt" db:"updated_at"`
-}
\ No newline at end of file
+}
+// PaymentTransfer represents an on-chain transfer credited to a payment session
+type PaymentTransfer struct {
+	ID              int64     `json:"id" db:"id"`
+	PaymentID       string    `json:"paymentId" db:"payment_id"`
+	TransactionHash string    `json:"transactionHash" db:"transaction_hash"`
+	LogIndex        uint      `json:"logIndex" db:"log_index"`
+	SenderAddress   string    `json:"senderAddress" db:"sender_address"`
+	ReceiverAddress string    `json:"receiverAddress" db:"receiver_address"`
+	TokenAddress    string    `json:"tokenAddress" db:"token_address"` // Token contract that emitted the Transfer log
+	AmountBaseUnits string    `json:"amountBaseUnits" db:"amount_base_units"`
+	BlockNumber     int64     `json:"blockNumber" db:"block_number"`
+	Confirmations   int       `json:"confirmations" db:"confirmations"`
+	Confirmed       bool      `json:"confirmed" db:"confirmed"`
+	Removed         bool      `json:"removed" db:"removed"` // Dropped by a chain reorganization
+	CreatedAt       time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time `json:"updatedAt" db:"updated_at"`
+}
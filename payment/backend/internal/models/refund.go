@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// RefundStatus represents the state of a refund
+type RefundStatus string
+
+const (
+	RefundRequested RefundStatus = "requested" // Requested by the merchant, waiting for an operator
+	RefundApproved  RefundStatus = "approved"  // Approved by an operator, waiting for the refund transaction
+	RefundBroadcast RefundStatus = "broadcast" // Transaction submitted, waiting for it to be verified and confirmed
+	RefundConfirmed RefundStatus = "confirmed" // The transaction sent the refund back to the payer
+	RefundFailed    RefundStatus = "failed"    // Rejected by an operator or the transaction did not pay the refund
+)
+
+// Refund represents the return of funds received by a payment session to its payer
+type Refund struct {
+	ID               int64        `json:"id" db:"id"`
+	RefundID         string       `json:"refundId" db:"refund_id"`
+	PaymentID        string       `json:"paymentId" db:"payment_id"`
+	MerchantID       *string      `json:"merchantId,omitempty" db:"merchant_id"`
+	Amount           string       `json:"amount" db:"amount"` // Decimal amount in whole tokens
+	AmountBaseUnits  string       `json:"amountBaseUnits" db:"amount_base_units"`
+	TokenSymbol      string       `json:"tokenSymbol" db:"token_symbol"`
+	NetworkID        string       `json:"networkId" db:"network_id"`
+	RecipientAddress string       `json:"recipientAddress" db:"recipient_address"` // The session's sender address
+	Reason           *string      `json:"reason,omitempty" db:"reason"`
+	Status           RefundStatus `json:"status" db:"status"`
+	TransactionHash  *string      `json:"transactionHash,omitempty" db:"transaction_hash"`
+	BlockNumber      *int64       `json:"blockNumber,omitempty" db:"block_number"`
+	FailureReason    *string      `json:"failureReason,omitempty" db:"failure_reason"`
+	ApprovedAt       *time.Time   `json:"approvedAt,omitempty" db:"approved_at"`
+	ConfirmedAt      *time.Time   `json:"confirmedAt,omitempty" db:"confirmed_at"`
+	CreatedAt        time.Time    `json:"createdAt" db:"created_at"`
+	UpdatedAt        time.Time    `json:"updatedAt" db:"updated_at"`
+}
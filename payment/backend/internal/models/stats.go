@@ -1,15 +1,51 @@
 package models
 
-// PaymentStats represents payment statistics
+import "time"
+
+// StatsGranularity is the width of the buckets of PaymentStats.PaymentsByPeriod
+type StatsGranularity string
+
+const (
+	StatsByHour StatsGranularity = "hour"
+	StatsByDay  StatsGranularity = "day"
+)
+
+// PaymentStats represents payment statistics of the sessions created in a time window.
+// Successful sessions are paid or overpaid; failed ones expired, underpaid, failed or were cancelled.
 type PaymentStats struct {
+	From                time.Time      `json:"from"`
+	To                  time.Time      `json:"to"`
+	Granularity         StatsGranularity `json:"granularity"`
 	TotalPayments       int            `json:"total_payments"`
 	SuccessfulPayments  int            `json:"successful_payments"`
 	FailedPayments      int            `json:"failed_payments"`
-	SuccessRate         float64        `json:"success_rate"`
+	SuccessRate         float64        `json:"success_rate"` // Share of closed sessions that were successful
 	PaymentsByToken     map[string]int `json:"payments_by_token"`
-	PaymentsByPeriod    map[string]int `json:"payments_by_period"`
-	AverageProcessingTime float64      `json:"average_processing_time"`
-	FailureReasons      map[string]int `json:"failure_reasons"`
+	PaymentsByPeriod    map[string]int `json:"payments_by_period"` // Sessions created per hour or day bucket, keyed by bucket start
+	AverageProcessingTime float64      `json:"average_processing_time"` // Seconds from creation to confirmation of successful sessions
+	FailureReasons      map[string]int `json:"failure_reasons"` // Failed sessions by the reason recorded when they entered their status
+	PaymentsByMerchant  map[string]*PaymentBreakdown `json:"payments_by_merchant"`
+	PaymentsByNetwork   map[string]*PaymentBreakdown `json:"payments_by_network"`
+}
+
+// PaymentBreakdown represents the payment statistics of one merchant or network
+type PaymentBreakdown struct {
+	TotalPayments         int     `json:"total_payments"`
+	SuccessfulPayments    int     `json:"successful_payments"`
+	FailedPayments        int     `json:"failed_payments"`
+	SuccessRate           float64 `json:"success_rate"`
+	AverageProcessingTime float64 `json:"average_processing_time"`
+}
+
+// PaymentStatsGroup aggregates the sessions created in a stats window that share a status, token, network and merchant
+type PaymentStatsGroup struct {
+	Status            PaymentStatus
+	TokenSymbol       string
+	NetworkID         string
+	MerchantID        string // Empty for sessions created without a merchant
+	Count             int
+	ConfirmedCount    int     // Sessions with a confirmation time
+	ProcessingSeconds float64 // Total seconds from creation to confirmation of the confirmed sessions
 }
 
 // MonitoringStats represents monitoring statistics
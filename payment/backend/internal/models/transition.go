@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// StatusSource identifies what changed a payment session's status
+type StatusSource string
+
+const (
+	SourceWatcher  StatusSource = "watcher"  // Blockchain transfer monitor
+	SourceClaim    StatusSource = "claim"    // Transaction submitted by the customer
+	SourceSweeper  StatusSource = "sweeper"  // Expiry sweeper and monitoring timeouts
+	SourceMerchant StatusSource = "merchant" // Merchant API, such as cancelling or accepting a late payment
+	SourceAdmin    StatusSource = "admin"    // Operator action through the admin API
+	SourceDebug    StatusSource = "debug"    // Debug endpoints
+)
+
+// StatusChange describes why a payment session's status changed and what changed it
+type StatusChange struct {
+	Reason string
+	Source StatusSource
+}
+
+// PaymentStatusHistory records one status transition of a payment session
+type PaymentStatusHistory struct {
+	ID         int64         `json:"id" db:"id"`
+	PaymentID  string        `json:"paymentId" db:"payment_id"`
+	FromStatus PaymentStatus `json:"fromStatus" db:"from_status"`
+	ToStatus   PaymentStatus `json:"toStatus" db:"to_status"`
+	Reason     string        `json:"reason" db:"reason"`
+	Source     StatusSource  `json:"source" db:"source"`
+	CreatedAt  time.Time     `json:"createdAt" db:"created_at"`
+}
+
+// PaymentStatuses lists every payment session status
+var PaymentStatuses = []PaymentStatus{
+	PaymentCreated, PaymentPending, PaymentConfirming, PaymentPaid, PaymentUnderpaid, PaymentOverpaid,
+	PaymentPaidLate, PaymentExpired, PaymentFailed, PaymentCancelled,
+}
+
+// paymentTransitions lists the statuses a payment session may move to from each status.
+// Statuses without an entry are terminal.
+var paymentTransitions = map[PaymentStatus][]PaymentStatus{
+	PaymentCreated:    {PaymentPending, PaymentConfirming, PaymentPaid, PaymentOverpaid, PaymentUnderpaid, PaymentExpired, PaymentFailed, PaymentCancelled},
+	PaymentPending:    {PaymentConfirming, PaymentPaid, PaymentOverpaid, PaymentUnderpaid, PaymentExpired, PaymentFailed, PaymentCancelled},
+	PaymentConfirming: {PaymentPending, PaymentPaid, PaymentOverpaid, PaymentUnderpaid, PaymentFailed},
+	// Transfers in the late payment grace window
+	PaymentExpired:   {PaymentPaidLate, PaymentUnderpaid},
+	PaymentUnderpaid: {PaymentPaidLate},
+	// The merchant accepts a late payment
+	PaymentPaidLate: {PaymentPaid, PaymentOverpaid},
+}
+
+// CanTransition reports whether a payment session may move from one status to another.
+// Updates that keep the status are always allowed.
+func CanTransition(from, to PaymentStatus) bool {
+	if from == to {
+		return true
+	}
+	for _, next := range paymentTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionSources returns the statuses a payment session may move to the given status from, in
+// PaymentStatuses order. The status itself is not included.
+func TransitionSources(to PaymentStatus) []PaymentStatus {
+	var sources []PaymentStatus
+	for _, from := range PaymentStatuses {
+		if from != to && CanTransition(from, to) {
+			sources = append(sources, from)
+		}
+	}
+	return sources
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	// allowed lists every move between different statuses; any other pair must be rejected
+	allowed := map[PaymentStatus][]PaymentStatus{
+		PaymentCreated:    {PaymentPending, PaymentConfirming, PaymentPaid, PaymentUnderpaid, PaymentOverpaid, PaymentExpired, PaymentFailed, PaymentCancelled},
+		PaymentPending:    {PaymentConfirming, PaymentPaid, PaymentUnderpaid, PaymentOverpaid, PaymentExpired, PaymentFailed, PaymentCancelled},
+		PaymentConfirming: {PaymentPending, PaymentPaid, PaymentUnderpaid, PaymentOverpaid, PaymentFailed},
+		PaymentExpired:    {PaymentUnderpaid, PaymentPaidLate},
+		PaymentUnderpaid:  {PaymentPaidLate},
+		PaymentPaidLate:   {PaymentPaid, PaymentOverpaid},
+	}
+
+	for _, from := range PaymentStatuses {
+		for _, to := range PaymentStatuses {
+			want := from == to
+			for _, next := range allowed[from] {
+				if next == to {
+					want = true
+				}
+			}
+			if got := CanTransition(from, to); got != want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestTransitionSources(t *testing.T) {
+	tests := []struct {
+		to   PaymentStatus
+		want []PaymentStatus
+	}{
+		{PaymentCancelled, []PaymentStatus{PaymentCreated, PaymentPending}},
+		{PaymentExpired, []PaymentStatus{PaymentCreated, PaymentPending}},
+		{PaymentPaidLate, []PaymentStatus{PaymentUnderpaid, PaymentExpired}},
+		{PaymentCreated, nil},
+	}
+
+	for _, tt := range tests {
+		if got := TransitionSources(tt.to); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("TransitionSources(%s) = %v, want %v", tt.to, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// WebhookDeliveryStatus represents the state of a webhook delivery
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"   // Waiting for its next attempt
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded" // The endpoint answered with a 2xx status
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"    // Gave up after the maximum number of attempts
+)
+
+// WebhookEndpoint represents a merchant URL notified of payment status changes
+type WebhookEndpoint struct {
+	ID         int64     `json:"id" db:"id"`
+	MerchantID *string   `json:"merchantId,omitempty" db:"merchant_id"` // Only this merchant's sessions are sent
+	URL        string    `json:"url" db:"url"`
+	Secret     string    `json:"-" db:"secret"` // HMAC-SHA256 signing key, only shown when the endpoint is created
+	Enabled    bool      `json:"enabled" db:"enabled"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// WebhookEvent represents a payment status change recorded in the webhook outbox
+type WebhookEvent struct {
+	ID        int64     `json:"id" db:"id"`
+	EventID   string    `json:"eventId" db:"event_id"`
+	PaymentID string    `json:"paymentId" db:"payment_id"`
+	Type      string    `json:"type" db:"event_type"`
+	Payload   string    `json:"payload" db:"payload"` // JSON body sent to every endpoint
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// WebhookDelivery represents the delivery of one event to one endpoint
+type WebhookDelivery struct {
+	ID             int64                 `json:"id" db:"id"`
+	EventID        string                `json:"eventId" db:"event_id"`
+	EndpointID     int64                 `json:"endpointId" db:"endpoint_id"`
+	Status         WebhookDeliveryStatus `json:"status" db:"status"`
+	Attempts       int                   `json:"attempts" db:"attempts"`
+	NextAttemptAt  *time.Time            `json:"nextAttemptAt,omitempty" db:"next_attempt_at"`
+	LastStatusCode *int                  `json:"lastStatusCode,omitempty" db:"last_status_code"`
+	LastError      *string               `json:"lastError,omitempty" db:"last_error"`
+	DeliveredAt    *time.Time            `json:"deliveredAt,omitempty" db:"delivered_at"`
+	CreatedAt      time.Time             `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time             `json:"updatedAt" db:"updated_at"`
+
+	// Joined from the event and endpoint for the worker
+	PaymentID string `json:"paymentId" db:"payment_id"`
+	Payload   string `json:"-" db:"payload"`
+	URL       string `json:"url" db:"url"`
+	Secret    string `json:"-" db:"secret"`
+}
+
+// WebhookDeliveryAttempt represents one HTTP request made for a webhook delivery
+type WebhookDeliveryAttempt struct {
+	ID           int64     `json:"id" db:"id"`
+	DeliveryID   int64     `json:"deliveryId" db:"delivery_id"`
+	Attempt      int       `json:"attempt" db:"attempt"`
+	StatusCode   *int      `json:"statusCode,omitempty" db:"status_code"`
+	Error        *string   `json:"error,omitempty" db:"error"`
+	ResponseBody *string   `json:"responseBody,omitempty" db:"response_body"` // Truncated
+	DurationMs   int64     `json:"durationMs" db:"duration_ms"`
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"payment-backend/internal/models"
+)
+
+// recordStatusHistoryTx writes a status transition of a payment session to its history.
+// It runs in the transaction that changed the status.
+func recordStatusHistoryTx(tx *sql.Tx, paymentID string, from, to models.PaymentStatus, change models.StatusChange) error {
+	_, err := tx.Exec(`
+		INSERT INTO payment_status_history (payment_id, from_status, to_status, reason, source, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, paymentID, from, to, change.Reason, change.Source, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record status history: %w", err)
+	}
+	return nil
+}
+
+// GetPaymentStatusHistory retrieves every status transition of a payment session, oldest first
+func (r *Repository) GetPaymentStatusHistory(paymentID string) ([]*models.PaymentStatusHistory, error) {
+	rows, err := r.db.Query(`
+		SELECT id, payment_id, from_status, to_status, reason, source, created_at
+		FROM payment_status_history
+		WHERE payment_id = ?
+		ORDER BY id
+	`, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []*models.PaymentStatusHistory
+	for rows.Next() {
+		entry := &models.PaymentStatusHistory{}
+		if err := rows.Scan(&entry.ID, &entry.PaymentID, &entry.FromStatus, &entry.ToStatus,
+			&entry.Reason, &entry.Source, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+
+	return history, rows.Err()
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"payment-backend/internal/models"
+)
+
+// ReserveIdempotencyKey claims an idempotency key for a new request, taking over an expired one;
+// an in-progress reservation expires when its lease ends. When the key is already held it returns
+// the existing record instead.
+func (r *Repository) ReserveIdempotencyKey(key *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	query := `
+		INSERT INTO idempotency_keys (merchant_id, idempotency_key, request_hash, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(merchant_id, idempotency_key) DO UPDATE SET
+			request_hash = excluded.request_hash,
+			payment_id = NULL,
+			response_status = NULL,
+			response_body = NULL,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at
+		WHERE idempotency_keys.expires_at <= excluded.created_at
+	`
+
+	key.CreatedAt = time.Now().UTC()
+	result, err := r.db.Exec(query, key.MerchantID, key.Key, key.RequestHash, key.CreatedAt, key.ExpiresAt.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected > 0 {
+		return nil, nil
+	}
+
+	return r.GetIdempotencyKey(key.MerchantID, key.Key)
+}
+
+// GetIdempotencyKey retrieves a merchant's idempotency key
+func (r *Repository) GetIdempotencyKey(merchantID, key string) (*models.IdempotencyKey, error) {
+	query := `
+		SELECT merchant_id, idempotency_key, request_hash, payment_id, response_status, response_body, created_at, expires_at
+		FROM idempotency_keys
+		WHERE merchant_id = ? AND idempotency_key = ?
+	`
+
+	record := &models.IdempotencyKey{}
+	err := r.db.QueryRow(query, merchantID, key).Scan(
+		&record.MerchantID,
+		&record.Key,
+		&record.RequestHash,
+		&record.PaymentID,
+		&record.ResponseStatus,
+		&record.ResponseBody,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// CompleteIdempotencyKey stores the response produced for a reserved idempotency key and extends
+// its expiry from the reservation lease to the replay window
+func (r *Repository) CompleteIdempotencyKey(merchantID, key, paymentID string, status int, body string, expiresAt time.Time) error {
+	query := `
+		UPDATE idempotency_keys
+		SET payment_id = ?, response_status = ?, response_body = ?, expires_at = ?
+		WHERE merchant_id = ? AND idempotency_key = ?
+	`
+
+	_, err := r.db.Exec(query, paymentID, status, body, expiresAt.UTC(), merchantID, key)
+	return err
+}
+
+// ReleaseIdempotencyKey drops a reservation whose request failed, so the key can be retried
+func (r *Repository) ReleaseIdempotencyKey(merchantID, key string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE merchant_id = ? AND idempotency_key = ? AND response_status IS NULL
+	`
+
+	_, err := r.db.Exec(query, merchantID, key)
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys removes idempotency keys whose replay window has passed
+func (r *Repository) DeleteExpiredIdempotencyKeys(now time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= ?`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
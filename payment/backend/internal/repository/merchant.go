@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"payment-backend/internal/models"
+)
+
+// merchantColumns lists the merchants columns read by scanMerchant
+const merchantColumns = `id, merchant_id, name, api_key_prefix, api_key_hash, enabled, created_at, updated_at`
+
+// scanMerchant scans a merchant selected with merchantColumns
+func scanMerchant(row rowScanner) (*models.Merchant, error) {
+	merchant := &models.Merchant{}
+	err := row.Scan(
+		&merchant.ID,
+		&merchant.MerchantID,
+		&merchant.Name,
+		&merchant.APIKeyPrefix,
+		&merchant.APIKeyHash,
+		&merchant.Enabled,
+		&merchant.CreatedAt,
+		&merchant.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return merchant, nil
+}
+
+// CreateMerchant creates a merchant
+func (r *Repository) CreateMerchant(merchant *models.Merchant) error {
+	query := `
+		INSERT INTO merchants (merchant_id, name, api_key_prefix, api_key_hash, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now().UTC()
+	merchant.CreatedAt = now
+	merchant.UpdatedAt = now
+
+	result, err := r.db.Exec(query, merchant.MerchantID, merchant.Name, merchant.APIKeyPrefix, merchant.APIKeyHash,
+		merchant.Enabled, now, now)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	merchant.ID = id
+
+	return nil
+}
+
+// GetMerchantByAPIKeyHash retrieves the enabled merchant owning an API key hash
+func (r *Repository) GetMerchantByAPIKeyHash(apiKeyHash string) (*models.Merchant, error) {
+	query := `SELECT ` + merchantColumns + `
+		FROM merchants
+		WHERE api_key_hash = ? AND enabled = TRUE
+	`
+
+	merchant, err := scanMerchant(r.db.QueryRow(query, apiKeyHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return merchant, nil
+}
+
+// GetMerchants retrieves all merchants
+func (r *Repository) GetMerchants() ([]*models.Merchant, error) {
+	query := `SELECT ` + merchantColumns + `
+		FROM merchants
+		ORDER BY id
+	`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var merchants []*models.Merchant
+	for rows.Next() {
+		merchant, err := scanMerchant(rows)
+		if err != nil {
+			return nil, err
+		}
+		merchants = append(merchants, merchant)
+	}
+
+	return merchants, rows.Err()
+}
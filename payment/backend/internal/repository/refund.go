@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"payment-backend/internal/models"
+)
+
+// refundColumns lists the refunds columns read by scanRefund
+const refundColumns = `
+	id, refund_id, payment_id, merchant_id, amount, amount_base_units, token_symbol, network_id,
+	recipient_address, reason, status, transaction_hash, block_number, failure_reason,
+	approved_at, confirmed_at, created_at, updated_at
+`
+
+// scanRefund scans a refund selected with refundColumns
+func scanRefund(row rowScanner) (*models.Refund, error) {
+	refund := &models.Refund{}
+	err := row.Scan(
+		&refund.ID,
+		&refund.RefundID,
+		&refund.PaymentID,
+		&refund.MerchantID,
+		&refund.Amount,
+		&refund.AmountBaseUnits,
+		&refund.TokenSymbol,
+		&refund.NetworkID,
+		&refund.RecipientAddress,
+		&refund.Reason,
+		&refund.Status,
+		&refund.TransactionHash,
+		&refund.BlockNumber,
+		&refund.FailureReason,
+		&refund.ApprovedAt,
+		&refund.ConfirmedAt,
+		&refund.CreatedAt,
+		&refund.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// queryRefunds runs a query selecting refundColumns and scans every row
+func (r *Repository) queryRefunds(query string, args ...interface{}) ([]*models.Refund, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refunds []*models.Refund
+	for rows.Next() {
+		refund, err := scanRefund(rows)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, refund)
+	}
+
+	return refunds, rows.Err()
+}
+
+// CreateRefund creates a refund
+func (r *Repository) CreateRefund(refund *models.Refund) error {
+	query := `
+		INSERT INTO refunds (
+			refund_id, payment_id, merchant_id, amount, amount_base_units, token_symbol, network_id,
+			recipient_address, reason, status, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now().UTC()
+	refund.CreatedAt = now
+	refund.UpdatedAt = now
+
+	result, err := r.db.Exec(query, refund.RefundID, refund.PaymentID, refund.MerchantID, refund.Amount,
+		refund.AmountBaseUnits, refund.TokenSymbol, refund.NetworkID, refund.RecipientAddress, refund.Reason,
+		refund.Status, now, now)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	refund.ID = id
+
+	return nil
+}
+
+// GetRefund retrieves a refund by refund ID
+func (r *Repository) GetRefund(refundID string) (*models.Refund, error) {
+	query := `SELECT ` + refundColumns + `
+		FROM refunds
+		WHERE refund_id = ?
+	`
+
+	refund, err := scanRefund(r.db.QueryRow(query, refundID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// GetRefundsByPaymentID retrieves every refund of a payment session, oldest first
+func (r *Repository) GetRefundsByPaymentID(paymentID string) ([]*models.Refund, error) {
+	return r.queryRefunds(`SELECT `+refundColumns+`
+		FROM refunds
+		WHERE payment_id = ?
+		ORDER BY id
+	`, paymentID)
+}
+
+// GetRefundsByStatus retrieves up to limit refunds in a status, oldest first
+func (r *Repository) GetRefundsByStatus(status models.RefundStatus, limit int) ([]*models.Refund, error) {
+	return r.queryRefunds(`SELECT `+refundColumns+`
+		FROM refunds
+		WHERE status = ?
+		ORDER BY id
+		LIMIT ?
+	`, status, limit)
+}
+
+// GetRecentRefunds retrieves up to limit refunds, newest first
+func (r *Repository) GetRecentRefunds(limit int) ([]*models.Refund, error) {
+	return r.queryRefunds(`SELECT `+refundColumns+`
+		FROM refunds
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+}
+
+// ApproveRefund moves a requested refund to approved. It reports false when the refund was not requested.
+func (r *Repository) ApproveRefund(refundID string) (bool, error) {
+	now := time.Now().UTC()
+	result, err := r.db.Exec(`
+		UPDATE refunds
+		SET status = ?, approved_at = ?, updated_at = ?
+		WHERE refund_id = ? AND status = ?
+	`, models.RefundApproved, now, now, refundID, models.RefundRequested)
+	return rowsChanged(result, err)
+}
+
+// RejectRefund fails a refund that has no transaction yet. It reports false when the refund is past approved.
+func (r *Repository) RejectRefund(refundID, reason string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE refunds
+		SET status = ?, failure_reason = ?, updated_at = ?
+		WHERE refund_id = ? AND status IN (?, ?)
+	`, models.RefundFailed, reason, time.Now().UTC(), refundID, models.RefundRequested, models.RefundApproved)
+	return rowsChanged(result, err)
+}
+
+// SetRefundTransaction records the transaction of an approved refund and moves it to broadcast.
+// It reports false when the refund was not approved.
+func (r *Repository) SetRefundTransaction(refundID, txHash string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE refunds
+		SET status = ?, transaction_hash = ?, updated_at = ?
+		WHERE refund_id = ? AND status = ?
+	`, models.RefundBroadcast, txHash, time.Now().UTC(), refundID, models.RefundApproved)
+	if isUniqueViolation(err) {
+		return false, ErrDuplicate
+	}
+	return rowsChanged(result, err)
+}
+
+// ConfirmRefund moves a broadcast refund to confirmed
+func (r *Repository) ConfirmRefund(refundID string, blockNumber int64) (bool, error) {
+	now := time.Now().UTC()
+	result, err := r.db.Exec(`
+		UPDATE refunds
+		SET status = ?, block_number = ?, confirmed_at = ?, updated_at = ?
+		WHERE refund_id = ? AND status = ?
+	`, models.RefundConfirmed, blockNumber, now, now, refundID, models.RefundBroadcast)
+	return rowsChanged(result, err)
+}
+
+// FailRefundTransaction moves a broadcast refund whose transaction did not pay it to failed
+func (r *Repository) FailRefundTransaction(refundID, reason string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE refunds
+		SET status = ?, failure_reason = ?, updated_at = ?
+		WHERE refund_id = ? AND status = ?
+	`, models.RefundFailed, reason, time.Now().UTC(), refundID, models.RefundBroadcast)
+	return rowsChanged(result, err)
+}
+
+// rowsChanged reports whether an update changed any row
+func rowsChanged(result sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
@@ -2,13 +2,37 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"payment-backend/internal/models"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
+// ErrDuplicate is returned when a write violates a unique constraint
+var ErrDuplicate = errors.New("duplicate record")
+
+// ErrDuplicateMerchantOrder is returned when a merchant already has a payment session for an order ID
+var ErrDuplicateMerchantOrder = errors.New("duplicate merchant order")
+
+// isUniqueViolation reports whether err is a SQLite unique or primary key constraint failure
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+}
+
+// isMerchantOrderViolation reports whether err is a unique failure on a session's merchant order ID.
+// SQLite names the columns of the violated index in the message.
+func isMerchantOrderViolation(err error) bool {
+	return isUniqueViolation(err) && strings.Contains(err.Error(), "merchant_order_id")
+}
+
 // Repository provides database operations
 type Repository struct {
 	db *sql.DB
@@ -19,14 +43,77 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// paymentSessionColumns lists the payment_sessions columns read by scanPaymentSession
+const paymentSessionColumns = `
+	id, payment_id, merchant_id, merchant_order_id, product_id, product_name, amount, amount_base_units, token_decimals,
+	amount_received_base_units, pay_amount_base_units, currency, token_symbol, network_id, receiver_address, sender_address,
+	status, qr_code_data, transaction_hash, block_number, start_block, derivation_index,
+	metadata, success_url, cancel_url, confirmed_at, expires_at, created_at, updated_at
+`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPaymentSession scans a payment session selected with paymentSessionColumns
+func scanPaymentSession(row rowScanner) (*models.PaymentSession, error) {
+	session := &models.PaymentSession{}
+	err := row.Scan(
+		&session.ID,
+		&session.PaymentID,
+		&session.MerchantID,
+		&session.MerchantOrderID,
+		&session.ProductID,
+		&session.ProductName,
+		&session.Amount,
+		&session.AmountBaseUnits,
+		&session.TokenDecimals,
+		&session.AmountReceivedBaseUnits,
+		&session.PayAmountBaseUnits,
+		&session.Currency,
+		&session.TokenSymbol,
+		&session.NetworkID,
+		&session.ReceiverAddress,
+		&session.SenderAddress,
+		&session.Status,
+		&session.QRCodeData,
+		&session.TransactionHash,
+		&session.BlockNumber,
+		&session.StartBlock,
+		&session.DerivationIndex,
+		&session.Metadata,
+		&session.SuccessURL,
+		&session.CancelURL,
+		&session.ConfirmedAt,
+		&session.ExpiresAt,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure we're using UTC time after reading from database
+	session.ExpiresAt = session.ExpiresAt.UTC()
+	session.CreatedAt = session.CreatedAt.UTC()
+	session.UpdatedAt = session.UpdatedAt.UTC()
+	if session.ConfirmedAt != nil {
+		confirmedAtUTC := session.ConfirmedAt.UTC()
+		session.ConfirmedAt = &confirmedAtUTC
+	}
+
+	return session, nil
+}
+
 // CreatePaymentSession creates a new payment session
 func (r *Repository) CreatePaymentSession(session *models.PaymentSession) error {
 	query := `
 		INSERT INTO payment_sessions (
-			payment_id, product_id, product_name, amount, currency, 
-			token_symbol, network_id, receiver_address, status, 
-			qr_code_data, expires_at, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			payment_id, merchant_id, merchant_order_id, product_id, product_name, amount, amount_base_units, token_decimals, pay_amount_base_units,
+			currency, token_symbol, network_id, receiver_address, status, 
+			qr_code_data, start_block, derivation_index, metadata, success_url, cancel_url, expires_at, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	now := time.Now().UTC()
@@ -39,19 +126,35 @@ func (r *Repository) CreatePaymentSession(session *models.PaymentSession) error
 	result, err := r.db.Exec(
 		query,
 		session.PaymentID,
+		session.MerchantID,
+		session.MerchantOrderID,
 		session.ProductID,
 		session.ProductName,
 		session.Amount,
+		session.AmountBaseUnits,
+		session.TokenDecimals,
+		session.PayAmountBaseUnits,
 		session.Currency,
 		session.TokenSymbol,
 		session.NetworkID,
 		session.ReceiverAddress,
 		session.Status,
 		session.QRCodeData,
+		session.StartBlock,
+		session.DerivationIndex,
+		session.Metadata,
+		session.SuccessURL,
+		session.CancelURL,
 		expiresAtUTC,
 		session.CreatedAt,
 		session.UpdatedAt,
 	)
+	if isMerchantOrderViolation(err) {
+		return ErrDuplicateMerchantOrder
+	}
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
 	if err != nil {
 		return err
 	}
@@ -67,47 +170,49 @@ func (r *Repository) CreatePaymentSession(session *models.PaymentSession) error
 
 // GetPaymentSessionByPaymentID retrieves a payment session by payment ID
 func (r *Repository) GetPaymentSessionByPaymentID(paymentID string) (*models.PaymentSession, error) {
-	query := `
-		SELECT id, payment_id, product_id, product_name, amount, currency,
-		       token_symbol, network_id, receiver_address, sender_address,
-		       status, qr_code_data, transaction_hash, block_number,
-		       confirmed_at, expires_at, created_at, updated_at
+	query := `SELECT ` + paymentSessionColumns + `
 		FROM payment_sessions
 		WHERE payment_id = ?
 	`
 
-	session := &models.PaymentSession{}
-	err := r.db.QueryRow(query, paymentID).Scan(
-		&session.ID,
-		&session.PaymentID,
-		&session.ProductID,
-		&session.ProductName,
-		&session.Amount,
-		&session.Currency,
-		&session.TokenSymbol,
-		&session.NetworkID,
-		&session.ReceiverAddress,
-		&session.SenderAddress,
-		&session.Status,
-		&session.QRCodeData,
-		&session.TransactionHash,
-		&session.BlockNumber,
-		&session.ConfirmedAt,
-		&session.ExpiresAt,
-		&session.CreatedAt,
-		&session.UpdatedAt,
-	)
+	session, err := scanPaymentSession(r.db.QueryRow(query, paymentID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
 
-	// Ensure we're using UTC time after reading from database
-	if err == nil {
-		session.ExpiresAt = session.ExpiresAt.UTC()
-		session.CreatedAt = session.CreatedAt.UTC()
-		session.UpdatedAt = session.UpdatedAt.UTC()
-		if session.ConfirmedAt != nil {
-			confirmedAtUTC := session.ConfirmedAt.UTC()
-			session.ConfirmedAt = &confirmedAtUTC
+	return session, nil
+}
+
+// GetPaymentSessionByMerchantOrderID retrieves a merchant's payment session for one of its order IDs
+func (r *Repository) GetPaymentSessionByMerchantOrderID(merchantID, merchantOrderID string) (*models.PaymentSession, error) {
+	query := `SELECT ` + paymentSessionColumns + `
+		FROM payment_sessions
+		WHERE merchant_id = ? AND merchant_order_id = ?
+	`
+
+	session, err := scanPaymentSession(r.db.QueryRow(query, merchantID, merchantOrderID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
 		}
+		return nil, err
 	}
+
+	return session, nil
+}
+
+// GetPaymentSessionByTransactionHash retrieves the payment session settled by a transaction, if any
+func (r *Repository) GetPaymentSessionByTransactionHash(txHash string) (*models.PaymentSession, error) {
+	query := `SELECT ` + paymentSessionColumns + `
+		FROM payment_sessions
+		WHERE transaction_hash = ?
+		LIMIT 1
+	`
+
+	session, err := scanPaymentSession(r.db.QueryRow(query, txHash))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -118,18 +223,189 @@ func (r *Repository) GetPaymentSessionByPaymentID(paymentID string) (*models.Pay
 	return session, nil
 }
 
-// UpdatePaymentSessionStatus updates the status of a payment session
-func (r *Repository) UpdatePaymentSessionStatus(paymentID string, status models.PaymentStatus, 
-	senderAddress *string, transactionHash *string, blockNumber *int64, confirmedAt *time.Time) error {
+// GetOpenPaymentSessions retrieves sessions that are still awaiting payment and have not expired,
+// plus sessions whose transfer is still confirming
+func (r *Repository) GetOpenPaymentSessions(now time.Time) ([]*models.PaymentSession, error) {
+	query := `SELECT ` + paymentSessionColumns + `
+		FROM payment_sessions
+		WHERE (status IN (?, ?) AND expires_at > ?) OR status = ?
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.Query(query, models.PaymentCreated, models.PaymentPending, now.UTC(), models.PaymentConfirming)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.PaymentSession
+	for rows.Next() {
+		session, err := scanPaymentSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// GetLatePaymentWindowSessions retrieves expired, underpaid and cancelled sessions whose expiry is after since,
+// which are still watched for late transfers
+func (r *Repository) GetLatePaymentWindowSessions(since time.Time) ([]*models.PaymentSession, error) {
+	query := `SELECT ` + paymentSessionColumns + `
+		FROM payment_sessions
+		WHERE status IN (?, ?, ?) AND expires_at > ?
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.Query(query, models.PaymentExpired, models.PaymentUnderpaid, models.PaymentCancelled, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.PaymentSession
+	for rows.Next() {
+		session, err := scanPaymentSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// GetLatePaymentWindowPayAmounts retrieves the pay amounts of the sessions for a receiver, token and network that
+// are still watched for late transfers because their expiry is after since. The unique index on open pay amounts
+// does not cover them, so a new session must not reuse these amounts.
+func (r *Repository) GetLatePaymentWindowPayAmounts(receiverAddress, tokenSymbol, networkID string, since time.Time) (map[string]bool, error) {
+	query := `
+		SELECT pay_amount_base_units
+		FROM payment_sessions
+		WHERE lower(receiver_address) = lower(?) AND token_symbol = ? AND network_id = ?
+			AND pay_amount_base_units IS NOT NULL AND status IN (?, ?, ?) AND expires_at > ?
+	`
+
+	rows, err := r.db.Query(query, receiverAddress, tokenSymbol, networkID,
+		models.PaymentExpired, models.PaymentUnderpaid, models.PaymentCancelled, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	amounts := make(map[string]bool)
+	for rows.Next() {
+		var amount string
+		if err := rows.Scan(&amount); err != nil {
+			return nil, err
+		}
+		amounts[amount] = true
+	}
+
+	return amounts, rows.Err()
+}
+
+// AcceptLatePayment moves a paid_late session to the given status. It reports false when the session is not paid_late.
+func (r *Repository) AcceptLatePayment(paymentID string, status models.PaymentStatus, change models.StatusChange) (bool, error) {
+	if !models.CanTransition(models.PaymentPaidLate, status) {
+		return false, fmt.Errorf("a late payment cannot be accepted as %s", status)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE payment_sessions
+		SET status = ?, updated_at = ?
+		WHERE payment_id = ? AND status = ?
+	`, status, time.Now().UTC(), paymentID, models.PaymentPaidLate)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	if err := recordStatusChangeTx(tx, paymentID, models.PaymentPaidLate, change); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// CancelPaymentSession moves a session to cancelled from the statuses the state machine allows, created or pending.
+// It reports false when the session is confirming a transfer or already closed.
+func (r *Repository) CancelPaymentSession(paymentID string, change models.StatusChange) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var previous models.PaymentStatus
+	err = tx.QueryRow(`SELECT status FROM payment_sessions WHERE payment_id = ?`, paymentID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	sources, sourceArgs := statusList(models.TransitionSources(models.PaymentCancelled))
+	result, err := tx.Exec(`
+		UPDATE payment_sessions
+		SET status = ?, updated_at = ?
+		WHERE payment_id = ? AND status IN (`+sources+`)
+	`, append([]interface{}{models.PaymentCancelled, time.Now().UTC(), paymentID}, sourceArgs...)...)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	if err := recordStatusChangeTx(tx, paymentID, previous, change); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// UpdatePaymentSessionStatus moves a payment session from one status to another.
+// The sender, transaction hash, block number and confirmation time are overwritten, nil clearing them,
+// so a caller that keeps them passes the session's current values. It reports false when the session
+// is no longer in the from status.
+func (r *Repository) UpdatePaymentSessionStatus(paymentID string, from, status models.PaymentStatus, change models.StatusChange,
+	senderAddress *string, transactionHash *string, blockNumber *int64, confirmedAt *time.Time) (bool, error) {
 	
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// The webhook outbox and status history are written in the same transaction, so a status change is never lost or sent twice
 	query := `
 		UPDATE payment_sessions 
 		SET status = ?, sender_address = ?, transaction_hash = ?, 
 		    block_number = ?, confirmed_at = ?, updated_at = ?
-		WHERE payment_id = ?
+		WHERE payment_id = ? AND status = ?
 	`
 
-	_, err := r.db.Exec(
+	result, err := tx.Exec(
 		query,
 		status,
 		senderAddress,
@@ -138,10 +414,132 @@ func (r *Repository) UpdatePaymentSessionStatus(paymentID string, status models.
 		confirmedAt,
 		time.Now().UTC(),
 		paymentID,
+		from,
 	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	if err := recordStatusChangeTx(tx, paymentID, from, change); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// UpdatePaymentSessionAmountReceived stores the total credited to a payment session
+func (r *Repository) UpdatePaymentSessionAmountReceived(paymentID string, amountReceived string) error {
+	query := `
+		UPDATE payment_sessions
+		SET amount_received_base_units = ?, updated_at = ?
+		WHERE payment_id = ?
+	`
+
+	_, err := r.db.Exec(query, amountReceived, time.Now().UTC(), paymentID)
 	return err
 }
 
+// GetOverduePaymentSessions retrieves the sessions that may expire, created or pending, whose expiry time has passed
+func (r *Repository) GetOverduePaymentSessions(now time.Time) ([]*models.PaymentSession, error) {
+	sources, args := statusList(expirableStatuses())
+	query := `SELECT ` + paymentSessionColumns + `
+		FROM payment_sessions
+		WHERE status IN (` + sources + `) AND expires_at <= ?
+		ORDER BY expires_at
+	`
+
+	rows, err := r.db.Query(query, append(args, now.UTC())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.PaymentSession
+	for rows.Next() {
+		session, err := scanPaymentSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// expirableStatuses returns the statuses the state machine lets a session expire from, to either expired or underpaid
+func expirableStatuses() []models.PaymentStatus {
+	var statuses []models.PaymentStatus
+	for _, status := range models.TransitionSources(models.PaymentExpired) {
+		if models.CanTransition(status, models.PaymentUnderpaid) {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// statusList returns SQL placeholders for an IN list of statuses and their arguments
+func statusList(statuses []models.PaymentStatus) (string, []interface{}) {
+	placeholders := make([]string, len(statuses))
+	args := make([]interface{}, len(statuses))
+	for i, status := range statuses {
+		placeholders[i] = "?"
+		args[i] = status
+	}
+	return strings.Join(placeholders, ", "), args
+}
+
+// ExpirePaymentSession closes a session that is still created or pending, marking it underpaid
+// if part of the amount arrived and expired otherwise, reporting whether the status was changed
+func (r *Repository) ExpirePaymentSession(paymentID string, change models.StatusChange) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var previous models.PaymentStatus
+	err = tx.QueryRow(`SELECT status FROM payment_sessions WHERE payment_id = ?`, paymentID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	sources, sourceArgs := statusList(expirableStatuses())
+	query := `
+		UPDATE payment_sessions
+		SET status = CASE WHEN amount_received_base_units != '0' THEN ? ELSE ? END, updated_at = ?
+		WHERE payment_id = ? AND status IN (` + sources + `)
+	`
+
+	result, err := tx.Exec(query, append([]interface{}{models.PaymentUnderpaid, models.PaymentExpired, time.Now().UTC(),
+		paymentID}, sourceArgs...)...)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	if err := recordStatusChangeTx(tx, paymentID, previous, change); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
 // GetAllTokens retrieves all tokens
 func (r *Repository) GetAllTokens() ([]*models.Token, error) {
 	query := `
@@ -180,10 +578,40 @@ func (r *Repository) GetAllTokens() ([]*models.Token, error) {
 	return tokens, nil
 }
 
+// GetTokenBySymbol retrieves an enabled token by symbol on a network
+func (r *Repository) GetTokenBySymbol(symbol, networkID string) (*models.Token, error) {
+	query := `
+		SELECT id, symbol, name, contract_address, decimals, network_id, enabled, created_at, updated_at
+		FROM tokens
+		WHERE symbol = ? AND network_id = ? AND enabled = TRUE
+	`
+
+	token := &models.Token{}
+	err := r.db.QueryRow(query, symbol, networkID).Scan(
+		&token.ID,
+		&token.Symbol,
+		&token.Name,
+		&token.ContractAddress,
+		&token.Decimals,
+		&token.NetworkID,
+		&token.Enabled,
+		&token.CreatedAt,
+		&token.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
+
 // GetAllNetworks retrieves all networks
 func (r *Repository) GetAllNetworks() ([]*models.Network, error) {
 	query := `
-		SELECT id, name, chain_id, rpc_url, websocket_url, block_explorer, enabled, created_at, updated_at
+		SELECT id, name, chain_id, rpc_url, websocket_url, block_explorer, required_confirmations, native_currency, enabled, created_at, updated_at
 		FROM networks
 		WHERE enabled = TRUE
 		ORDER BY id
@@ -205,6 +633,8 @@ func (r *Repository) GetAllNetworks() ([]*models.Network, error) {
 			&network.RPCURL,
 			&network.WebsocketURL,
 			&network.BlockExplorer,
+			&network.RequiredConfirmations,
+			&network.NativeCurrency,
 			&network.Enabled,
 			&network.CreatedAt,
 			&network.UpdatedAt,
@@ -216,4 +646,180 @@ func (r *Repository) GetAllNetworks() ([]*models.Network, error) {
 	}
 
 	return networks, nil
-}
\ No newline at end of file
+}
+
+// GetLastScannedBlock retrieves the last block scanned by the polling fallback for a network
+func (r *Repository) GetLastScannedBlock(networkID string) (uint64, bool, error) {
+	query := `
+		SELECT last_scanned_block
+		FROM block_cursors
+		WHERE network_id = ?
+	`
+
+	var blockNumber int64
+	err := r.db.QueryRow(query, networkID).Scan(&blockNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	return uint64(blockNumber), true, nil
+}
+
+// SetLastScannedBlock stores the last block scanned by the polling fallback for a network
+func (r *Repository) SetLastScannedBlock(networkID string, blockNumber uint64) error {
+	query := `
+		INSERT INTO block_cursors (network_id, last_scanned_block, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(network_id) DO UPDATE SET
+			last_scanned_block = excluded.last_scanned_block,
+			updated_at = excluded.updated_at
+	`
+
+	_, err := r.db.Exec(query, networkID, int64(blockNumber), time.Now().UTC())
+	return err
+}
+
+// paymentTransferColumns lists the payment_transfers columns read by scanPaymentTransfer
+const paymentTransferColumns = `
+	id, payment_id, transaction_hash, log_index, sender_address, receiver_address, token_address,
+	amount_base_units, block_number, confirmations, confirmed, removed, created_at, updated_at
+`
+
+// scanPaymentTransfer scans a payment transfer selected with paymentTransferColumns
+func scanPaymentTransfer(row rowScanner) (*models.PaymentTransfer, error) {
+	transfer := &models.PaymentTransfer{}
+	err := row.Scan(
+		&transfer.ID,
+		&transfer.PaymentID,
+		&transfer.TransactionHash,
+		&transfer.LogIndex,
+		&transfer.SenderAddress,
+		&transfer.ReceiverAddress,
+		&transfer.TokenAddress,
+		&transfer.AmountBaseUnits,
+		&transfer.BlockNumber,
+		&transfer.Confirmations,
+		&transfer.Confirmed,
+		&transfer.Removed,
+		&transfer.CreatedAt,
+		&transfer.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	transfer.CreatedAt = transfer.CreatedAt.UTC()
+	transfer.UpdatedAt = transfer.UpdatedAt.UTC()
+	return transfer, nil
+}
+
+// UpsertPaymentTransfer records a transfer credited to a payment session, updating its confirmation state
+// if the same log was already recorded. A log removed by a reorg may be credited to another session.
+func (r *Repository) UpsertPaymentTransfer(transfer *models.PaymentTransfer) error {
+	query := `
+		INSERT INTO payment_transfers (
+			payment_id, transaction_hash, log_index, sender_address, receiver_address, token_address,
+			amount_base_units, block_number, confirmations, confirmed, removed, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(transaction_hash, log_index) DO UPDATE SET
+			payment_id = CASE WHEN payment_transfers.removed THEN excluded.payment_id ELSE payment_transfers.payment_id END,
+			block_number = excluded.block_number,
+			confirmations = excluded.confirmations,
+			confirmed = excluded.confirmed,
+			removed = excluded.removed,
+			updated_at = excluded.updated_at
+	`
+
+	now := time.Now().UTC()
+	_, err := r.db.Exec(
+		query,
+		transfer.PaymentID,
+		transfer.TransactionHash,
+		transfer.LogIndex,
+		transfer.SenderAddress,
+		transfer.ReceiverAddress,
+		transfer.TokenAddress,
+		transfer.AmountBaseUnits,
+		transfer.BlockNumber,
+		transfer.Confirmations,
+		transfer.Confirmed,
+		transfer.Removed,
+		now,
+		now,
+	)
+	return err
+}
+
+// GetPaymentTransfers retrieves the transfers recorded for a payment session, oldest first
+func (r *Repository) GetPaymentTransfers(paymentID string) ([]*models.PaymentTransfer, error) {
+	query := `SELECT ` + paymentTransferColumns + `
+		FROM payment_transfers
+		WHERE payment_id = ?
+		ORDER BY id
+	`
+
+	rows, err := r.db.Query(query, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []*models.PaymentTransfer
+	for rows.Next() {
+		transfer, err := scanPaymentTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, rows.Err()
+}
+
+// GetPaymentTransfersByTransactionHash retrieves the recorded transfers of a transaction, whichever session they credited
+func (r *Repository) GetPaymentTransfersByTransactionHash(txHash string) ([]*models.PaymentTransfer, error) {
+	query := `SELECT ` + paymentTransferColumns + `
+		FROM payment_transfers
+		WHERE transaction_hash = ?
+		ORDER BY log_index
+	`
+
+	rows, err := r.db.Query(query, txHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []*models.PaymentTransfer
+	for rows.Next() {
+		transfer, err := scanPaymentTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, rows.Err()
+}
+
+// NextDerivationIndex reserves the next unused child index of an extended public key.
+// Reserved indexes are never handed out again, even if the session using one is not created.
+func (r *Repository) NextDerivationIndex(xpub string) (uint32, error) {
+	query := `
+		INSERT INTO deposit_key_indexes (xpub, next_index, updated_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT(xpub) DO UPDATE SET
+			next_index = next_index + 1,
+			updated_at = excluded.updated_at
+		RETURNING next_index - 1
+	`
+
+	var index int64
+	if err := r.db.QueryRow(query, xpub, time.Now().UTC()).Scan(&index); err != nil {
+		return 0, err
+	}
+	return uint32(index), nil
+}
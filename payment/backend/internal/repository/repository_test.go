@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"payment-backend/internal/models"
+)
+
+// openTestRepository creates a repository over a sqlite database with the schema built from the Up sections of migrations/
+func openTestRepository(t *testing.T) *Repository {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("find migrations: %v", err)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		up := string(content)
+		if i := strings.Index(up, "-- +goose Up"); i >= 0 {
+			up = up[i:]
+		}
+		if i := strings.Index(up, "-- +goose Down"); i >= 0 {
+			up = up[:i]
+		}
+		if _, err := db.Exec(up); err != nil {
+			t.Fatalf("apply %s: %v", filepath.Base(file), err)
+		}
+	}
+
+	return NewRepository(db)
+}
+
+// createTestSession stores a created session with the given payment ID
+func createTestSession(t *testing.T, repo *Repository, paymentID string) *models.PaymentSession {
+	t.Helper()
+
+	session := &models.PaymentSession{
+		PaymentID:       paymentID,
+		ProductID:       "p",
+		ProductName:     "P",
+		Amount:          "1",
+		AmountBaseUnits: "1000000000000000000",
+		TokenDecimals:   18,
+		Currency:        "USD",
+		TokenSymbol:     "USDT",
+		NetworkID:       "BSC",
+		ReceiverAddress: "0xe27577B0e3920cE35f100f66430de0108cb78a04",
+		Status:          models.PaymentCreated,
+		ExpiresAt:       time.Now().Add(15 * time.Minute),
+	}
+	if err := repo.CreatePaymentSession(session); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	return session
+}
+
+func TestUpdatePaymentSessionStatusKeepsEvidencePassedThrough(t *testing.T) {
+	repo := openTestRepository(t)
+	createTestSession(t, repo, "pay_evidence")
+
+	sender := "0x1111111111111111111111111111111111111111"
+	txHash := "0xabc"
+	block := int64(110)
+	updated, err := repo.UpdatePaymentSessionStatus("pay_evidence", models.PaymentCreated, models.PaymentConfirming,
+		models.StatusChange{Source: "test"}, &sender, &txHash, &block, nil)
+	if err != nil || !updated {
+		t.Fatalf("move to confirming = %v, %v", updated, err)
+	}
+
+	// Failing the session with its current values, as the settlement watcher does, keeps the transfer on it
+	current, err := repo.GetPaymentSessionByPaymentID("pay_evidence")
+	if err != nil || current == nil {
+		t.Fatalf("reload session: %v", err)
+	}
+	updated, err = repo.UpdatePaymentSessionStatus("pay_evidence", models.PaymentConfirming, models.PaymentFailed,
+		models.StatusChange{Reason: "monitoring error", Source: "test"},
+		current.SenderAddress, current.TransactionHash, current.BlockNumber, current.ConfirmedAt)
+	if err != nil || !updated {
+		t.Fatalf("move to failed = %v, %v", updated, err)
+	}
+
+	failed, err := repo.GetPaymentSessionByPaymentID("pay_evidence")
+	if err != nil || failed == nil {
+		t.Fatalf("reload session: %v", err)
+	}
+	if failed.Status != models.PaymentFailed {
+		t.Errorf("status = %s, want %s", failed.Status, models.PaymentFailed)
+	}
+	if failed.SenderAddress == nil || *failed.SenderAddress != sender ||
+		failed.TransactionHash == nil || *failed.TransactionHash != txHash ||
+		failed.BlockNumber == nil || *failed.BlockNumber != block {
+		t.Errorf("evidence after failing = %v, %v, %v", failed.SenderAddress, failed.TransactionHash, failed.BlockNumber)
+	}
+
+	// A stale from status does not apply
+	updated, err = repo.UpdatePaymentSessionStatus("pay_evidence", models.PaymentConfirming, models.PaymentPaid,
+		models.StatusChange{Source: "test"}, nil, nil, nil, nil)
+	if err != nil || updated {
+		t.Errorf("update from a stale status = %v, %v", updated, err)
+	}
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"payment-backend/internal/models"
+)
+
+// statsPeriodFormat formats the hour buckets of payment_stats_hourly
+const statsPeriodFormat = "2006-01-02T15:04:05Z"
+
+// periodKeyLengths maps a stats granularity to the prefix of an hour bucket that keys its periods
+var periodKeyLengths = map[models.StatsGranularity]int{
+	models.StatsByHour: len(statsPeriodFormat),
+	models.StatsByDay:  len("2006-01-02"),
+}
+
+// GetPaymentStatsGroups counts the sessions created in the hours [from, to) per status, token, network and merchant,
+// with the time from creation to confirmation of those that were confirmed. It reads the payment_stats_hourly rollup.
+func (r *Repository) GetPaymentStatsGroups(from, to time.Time) ([]*models.PaymentStatsGroup, error) {
+	rows, err := r.db.Query(`
+		SELECT status, token_symbol, network_id, merchant_id, SUM(payments), SUM(confirmed), SUM(processing_seconds)
+		FROM payment_stats_hourly
+		WHERE period >= ? AND period < ?
+		GROUP BY status, token_symbol, network_id, merchant_id
+		HAVING SUM(payments) > 0
+	`, from.UTC().Format(statsPeriodFormat), to.UTC().Format(statsPeriodFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*models.PaymentStatsGroup
+	for rows.Next() {
+		group := &models.PaymentStatsGroup{}
+		if err := rows.Scan(&group.Status, &group.TokenSymbol, &group.NetworkID, &group.MerchantID,
+			&group.Count, &group.ConfirmedCount, &group.ProcessingSeconds); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+// GetPaymentCountsByPeriod counts the sessions created in the hours [from, to) per hour or day bucket,
+// keyed by bucket start in UTC
+func (r *Repository) GetPaymentCountsByPeriod(from, to time.Time, granularity models.StatsGranularity) (map[string]int, error) {
+	keyLength, ok := periodKeyLengths[granularity]
+	if !ok {
+		return nil, fmt.Errorf("unknown stats granularity %q", granularity)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT substr(period, 1, ?) AS bucket, SUM(payments)
+		FROM payment_stats_hourly
+		WHERE period >= ? AND period < ?
+		GROUP BY bucket
+		HAVING SUM(payments) > 0
+	`, keyLength, from.UTC().Format(statsPeriodFormat), to.UTC().Format(statsPeriodFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var bucket string
+		var count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, err
+		}
+		counts[bucket] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// GetFailureReasonCounts counts the sessions created in the hours [from, to) that closed in one of statuses,
+// keyed by the reason recorded with their last transition into that status, or by the status when none was recorded.
+// It reads the payment_status_reasons_hourly rollup.
+func (r *Repository) GetFailureReasonCounts(from, to time.Time, statuses []models.PaymentStatus) (map[string]int, error) {
+	placeholders, statusArgs := statusList(statuses)
+	args := append(statusArgs, from.UTC().Format(statsPeriodFormat), to.UTC().Format(statsPeriodFormat))
+
+	rows, err := r.db.Query(`
+		SELECT COALESCE(NULLIF(reason, ''), status) AS failure_reason, SUM(payments)
+		FROM payment_status_reasons_hourly
+		WHERE status IN (`+placeholders+`) AND period >= ? AND period < ?
+		GROUP BY failure_reason
+		HAVING SUM(payments) > 0
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var reason string
+		var count int
+		if err := rows.Scan(&reason, &count); err != nil {
+			return nil, err
+		}
+		counts[reason] = count
+	}
+
+	return counts, rows.Err()
+}
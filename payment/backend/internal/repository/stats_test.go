@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"payment-backend/internal/models"
+)
+
+func TestFailureReasonCountsFollowStatusChanges(t *testing.T) {
+	repo := openTestRepository(t)
+	failed := []models.PaymentStatus{models.PaymentExpired, models.PaymentUnderpaid, models.PaymentFailed, models.PaymentCancelled}
+
+	for _, id := range []string{"pay_expired", "pay_cancelled", "pay_no_reason", "pay_late", "pay_open"} {
+		createTestSession(t, repo, id)
+	}
+
+	move := func(ok bool, err error) {
+		t.Helper()
+		if err != nil || !ok {
+			t.Fatalf("status change = %v, %v", ok, err)
+		}
+	}
+	move(repo.ExpirePaymentSession("pay_expired", models.StatusChange{Reason: "payment window expired", Source: "test"}))
+	move(repo.CancelPaymentSession("pay_cancelled", models.StatusChange{Reason: "cancelled by merchant", Source: "test"}))
+	move(repo.CancelPaymentSession("pay_no_reason", models.StatusChange{Source: "test"}))
+
+	// A session that is paid after expiring no longer counts as failed
+	move(repo.ExpirePaymentSession("pay_late", models.StatusChange{Reason: "payment window expired", Source: "test"}))
+	move(repo.UpdatePaymentSessionStatus("pay_late", models.PaymentExpired, models.PaymentPaidLate,
+		models.StatusChange{Reason: "transfer after expiry", Source: "test"}, nil, nil, nil, nil))
+
+	now := time.Now().UTC()
+	counts, err := repo.GetFailureReasonCounts(now.Add(-time.Hour), now.Add(time.Hour), failed)
+	if err != nil {
+		t.Fatalf("GetFailureReasonCounts() error = %v", err)
+	}
+	want := map[string]int{"payment window expired": 1, "cancelled by merchant": 1, "cancelled": 1}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("failure reasons = %v, want %v", counts, want)
+	}
+
+	// Sessions created outside the window are not counted
+	counts, err = repo.GetFailureReasonCounts(now.Add(time.Hour), now.Add(2*time.Hour), failed)
+	if err != nil || len(counts) != 0 {
+		t.Errorf("failure reasons of a later window = %v, %v", counts, err)
+	}
+}
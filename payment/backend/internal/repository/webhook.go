@@ -0,0 +1,413 @@
+package repository
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"payment-backend/internal/models"
+)
+
+// webhookPayload is the JSON body delivered to webhook endpoints
+type webhookPayload struct {
+	ID        string             `json:"id"`
+	Type      string             `json:"type"`
+	CreatedAt time.Time          `json:"createdAt"`
+	Data      webhookPaymentData `json:"data"`
+}
+
+// webhookPaymentData describes the payment session whose status changed
+type webhookPaymentData struct {
+	PaymentID               string          `json:"paymentId"`
+	MerchantOrderID         *string         `json:"merchantOrderId,omitempty"`
+	ProductID               string          `json:"productId"`
+	Status                  string          `json:"status"`
+	PreviousStatus          string          `json:"previousStatus"`
+	Amount                  string          `json:"amount"`
+	AmountBaseUnits         string          `json:"amountBaseUnits"`
+	PayAmountBaseUnits      *string         `json:"payAmountBaseUnits,omitempty"`
+	AmountReceivedBaseUnits string          `json:"amountReceivedBaseUnits"`
+	TokenDecimals           int             `json:"tokenDecimals"`
+	TokenSymbol             string          `json:"tokenSymbol"`
+	NetworkID               string          `json:"networkId"`
+	ReceiverAddress         string          `json:"receiverAddress"`
+	SenderAddress           *string         `json:"senderAddress,omitempty"`
+	TransactionHash         *string         `json:"transactionHash,omitempty"`
+	BlockNumber             *int64          `json:"blockNumber,omitempty"`
+	ConfirmedAt             *time.Time      `json:"confirmedAt,omitempty"`
+	ExpiresAt               time.Time       `json:"expiresAt"`
+	Metadata                json.RawMessage `json:"metadata,omitempty"`
+}
+
+// recordStatusChangeTx records the transition in the status history and writes a webhook event and one delivery
+// per enabled endpoint of the session's merchant to the outbox when a session's status differs from previous.
+// It runs in the transaction that changed the status.
+func recordStatusChangeTx(tx *sql.Tx, paymentID string, previous models.PaymentStatus, change models.StatusChange) error {
+	session, err := scanPaymentSession(tx.QueryRow(`SELECT `+paymentSessionColumns+`
+		FROM payment_sessions
+		WHERE payment_id = ?
+	`, paymentID))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if session.Status == previous {
+		return nil
+	}
+
+	if err := recordStatusHistoryTx(tx, paymentID, previous, session.Status, change); err != nil {
+		return err
+	}
+
+	eventID, err := generateEventID()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	payload, err := json.Marshal(webhookPayload{
+		ID:        eventID,
+		Type:      "payment." + string(session.Status),
+		CreatedAt: now,
+		Data: webhookPaymentData{
+			PaymentID:               session.PaymentID,
+			MerchantOrderID:         session.MerchantOrderID,
+			ProductID:               session.ProductID,
+			Status:                  string(session.Status),
+			PreviousStatus:          string(previous),
+			Amount:                  session.Amount,
+			AmountBaseUnits:         session.AmountBaseUnits,
+			PayAmountBaseUnits:      session.PayAmountBaseUnits,
+			AmountReceivedBaseUnits: session.AmountReceivedBaseUnits,
+			TokenDecimals:           session.TokenDecimals,
+			TokenSymbol:             session.TokenSymbol,
+			NetworkID:               session.NetworkID,
+			ReceiverAddress:         session.ReceiverAddress,
+			SenderAddress:           session.SenderAddress,
+			TransactionHash:         session.TransactionHash,
+			BlockNumber:             session.BlockNumber,
+			ConfirmedAt:             session.ConfirmedAt,
+			ExpiresAt:               session.ExpiresAt,
+			Metadata:                metadataJSON(session.Metadata),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO webhook_events (event_id, payment_id, event_type, payload, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, eventID, paymentID, "payment."+string(session.Status), string(payload), now)
+	if err != nil {
+		return fmt.Errorf("failed to write webhook event: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO webhook_deliveries (event_id, endpoint_id, status, attempts, next_attempt_at, created_at, updated_at)
+		SELECT ?, id, ?, 0, ?, ?, ? FROM webhook_endpoints WHERE enabled = TRUE AND merchant_id IS ?
+	`, eventID, models.WebhookDeliveryPending, now, now, now, session.MerchantID)
+	if err != nil {
+		return fmt.Errorf("failed to queue webhook deliveries: %w", err)
+	}
+
+	return nil
+}
+
+// generateEventID generates a unique webhook event ID
+func generateEventID() (string, error) {
+	bytes := make([]byte, 12)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return "evt_" + hex.EncodeToString(bytes), nil
+}
+
+// CreateWebhookEndpoint registers a webhook endpoint
+func (r *Repository) CreateWebhookEndpoint(endpoint *models.WebhookEndpoint) error {
+	query := `
+		INSERT INTO webhook_endpoints (merchant_id, url, secret, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now().UTC()
+	endpoint.CreatedAt = now
+	endpoint.UpdatedAt = now
+
+	result, err := r.db.Exec(query, endpoint.MerchantID, endpoint.URL, endpoint.Secret, endpoint.Enabled, now, now)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	endpoint.ID = id
+
+	return nil
+}
+
+// GetWebhookEndpoints retrieves the webhook endpoints of a merchant
+func (r *Repository) GetWebhookEndpoints(merchantID string) ([]*models.WebhookEndpoint, error) {
+	query := `
+		SELECT id, merchant_id, url, secret, enabled, created_at, updated_at
+		FROM webhook_endpoints
+		WHERE merchant_id = ?
+		ORDER BY id
+	`
+
+	rows, err := r.db.Query(query, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endpoints []*models.WebhookEndpoint
+	for rows.Next() {
+		endpoint := &models.WebhookEndpoint{}
+		err := rows.Scan(
+			&endpoint.ID,
+			&endpoint.MerchantID,
+			&endpoint.URL,
+			&endpoint.Secret,
+			&endpoint.Enabled,
+			&endpoint.CreatedAt,
+			&endpoint.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, rows.Err()
+}
+
+// DeleteWebhookEndpoint disables a merchant's webhook endpoint so no new deliveries are queued for it,
+// reporting whether it existed
+func (r *Repository) DeleteWebhookEndpoint(merchantID string, id int64) (bool, error) {
+	query := `
+		UPDATE webhook_endpoints
+		SET enabled = FALSE, updated_at = ?
+		WHERE id = ? AND merchant_id = ?
+	`
+
+	result, err := r.db.Exec(query, time.Now().UTC(), id, merchantID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// webhookDeliveryColumns lists the columns read by scanWebhookDelivery, joined with the event and endpoint
+const webhookDeliveryColumns = `
+	d.id, d.event_id, d.endpoint_id, d.status, d.attempts, d.next_attempt_at, d.last_status_code,
+	d.last_error, d.delivered_at, d.created_at, d.updated_at, e.payment_id, e.payload, w.url, w.secret
+`
+
+// webhookDeliveryJoins joins a delivery with its event and endpoint
+const webhookDeliveryJoins = `
+	FROM webhook_deliveries d
+	JOIN webhook_events e ON e.event_id = d.event_id
+	JOIN webhook_endpoints w ON w.id = d.endpoint_id
+`
+
+// scanWebhookDelivery scans a webhook delivery selected with webhookDeliveryColumns
+func scanWebhookDelivery(row rowScanner) (*models.WebhookDelivery, error) {
+	delivery := &models.WebhookDelivery{}
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.EventID,
+		&delivery.EndpointID,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.DeliveredAt,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+		&delivery.PaymentID,
+		&delivery.Payload,
+		&delivery.URL,
+		&delivery.Secret,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// queryWebhookDeliveries runs a webhook delivery query and scans every row
+func (r *Repository) queryWebhookDeliveries(query string, args ...interface{}) ([]*models.WebhookDelivery, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// GetDueWebhookDeliveries retrieves pending deliveries whose next attempt is due, oldest first
+func (r *Repository) GetDueWebhookDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + webhookDeliveryJoins + `
+		WHERE d.status = ? AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT ?
+	`
+
+	return r.queryWebhookDeliveries(query, models.WebhookDeliveryPending, now.UTC(), limit)
+}
+
+// GetWebhookDeliveries retrieves the deliveries of a merchant's endpoint, newest first
+func (r *Repository) GetWebhookDeliveries(merchantID string, endpointID int64, limit int) ([]*models.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + webhookDeliveryJoins + `
+		WHERE d.endpoint_id = ? AND w.merchant_id = ?
+		ORDER BY d.id DESC
+		LIMIT ?
+	`
+
+	return r.queryWebhookDeliveries(query, endpointID, merchantID, limit)
+}
+
+// GetWebhookDelivery retrieves a webhook delivery by ID
+func (r *Repository) GetWebhookDelivery(id int64) (*models.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + webhookDeliveryJoins + `
+		WHERE d.id = ?
+	`
+
+	delivery, err := scanWebhookDelivery(r.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// RecordWebhookAttempt logs an attempt and moves its delivery to status, scheduling nextAttemptAt while pending
+func (r *Repository) RecordWebhookAttempt(attempt *models.WebhookDeliveryAttempt, status models.WebhookDeliveryStatus, nextAttemptAt *time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	attempt.CreatedAt = now
+
+	_, err = tx.Exec(`
+		INSERT INTO webhook_delivery_attempts (delivery_id, attempt, status_code, error, response_body, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, attempt.DeliveryID, attempt.Attempt, attempt.StatusCode, attempt.Error, attempt.ResponseBody, attempt.DurationMs, now)
+	if err != nil {
+		return err
+	}
+
+	var deliveredAt *time.Time
+	if status == models.WebhookDeliverySucceeded {
+		deliveredAt = &now
+	}
+
+	_, err = tx.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?, last_error = ?,
+		    delivered_at = COALESCE(?, delivered_at), updated_at = ?
+		WHERE id = ?
+	`, status, attempt.Attempt, nextAttemptAt, attempt.StatusCode, attempt.Error, deliveredAt, now, attempt.DeliveryID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetWebhookDeliveryAttempts retrieves the attempts made for a delivery, oldest first
+func (r *Repository) GetWebhookDeliveryAttempts(deliveryID int64) ([]*models.WebhookDeliveryAttempt, error) {
+	query := `
+		SELECT id, delivery_id, attempt, status_code, error, response_body, duration_ms, created_at
+		FROM webhook_delivery_attempts
+		WHERE delivery_id = ?
+		ORDER BY id
+	`
+
+	rows, err := r.db.Query(query, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []*models.WebhookDeliveryAttempt
+	for rows.Next() {
+		attempt := &models.WebhookDeliveryAttempt{}
+		err := rows.Scan(
+			&attempt.ID,
+			&attempt.DeliveryID,
+			&attempt.Attempt,
+			&attempt.StatusCode,
+			&attempt.Error,
+			&attempt.ResponseBody,
+			&attempt.DurationMs,
+			&attempt.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts, rows.Err()
+}
+
+// RedeliverWebhook queues a delivery to a merchant's endpoint for an immediate new round of attempts,
+// reporting whether it existed
+func (r *Repository) RedeliverWebhook(merchantID string, id int64) (bool, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = 0, next_attempt_at = ?, updated_at = ?
+		WHERE id = ? AND endpoint_id IN (SELECT id FROM webhook_endpoints WHERE merchant_id = ?)
+	`
+
+	now := time.Now().UTC()
+	result, err := r.db.Exec(query, models.WebhookDeliveryPending, now, now, id, merchantID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// metadataJSON returns a session's stored metadata object for embedding in JSON, or nil when it has none
+func metadataJSON(metadata *string) json.RawMessage {
+	if metadata == nil || *metadata == "" {
+		return nil
+	}
+	return json.RawMessage(*metadata)
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"payment-backend/internal/blockchain"
+	"payment-backend/internal/models"
+)
+
+// cancelledRefundReason is recorded on refunds flagged for funds sent to a cancelled session
+const cancelledRefundReason = "payment session was cancelled"
+
+// ErrCancelNotAllowed is returned when a payment session is confirming a transfer or already closed
+var ErrCancelNotAllowed = errors.New("payment session cannot be cancelled")
+
+// CancelPayment lets a merchant cancel one of its created or pending sessions. The session stops taking
+// payments and its customer's WebSocket is closed; until its late payment grace window ends the receiver
+// is still watched, so transfers sent anyway are flagged for refund instead of being lost.
+func (s *PaymentService) CancelPayment(ctx context.Context, merchantID, paymentID string) (*models.PaymentSession, error) {
+	s.settleMu.Lock()
+	defer s.settleMu.Unlock()
+
+	session, err := s.merchantPaymentSession(merchantID, paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	cancelled, err := s.repo.CancelPaymentSession(paymentID, models.StatusChange{
+		Reason: "cancelled by merchant",
+		Source: models.SourceMerchant,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel payment session: %w", err)
+	}
+	current, err := s.repo.GetPaymentSessionByPaymentID(paymentID)
+	if err != nil || current == nil {
+		return nil, fmt.Errorf("failed to reload payment session: %v", err)
+	}
+	if !cancelled {
+		return nil, fmt.Errorf("%w: the session is %s", ErrCancelNotAllowed, current.Status)
+	}
+
+	if bcService, err := s.blockchainFor(session.NetworkID); err == nil {
+		// The watcher entry no longer counts as an open payment; it only catches transfers to flag for refund
+		if time.Now().UTC().Before(s.latePaymentWindowEnd(session)) {
+			bcService.MarkPaymentLate(paymentID)
+		} else {
+			bcService.StopPaymentMonitoring(paymentID)
+		}
+	}
+
+	// Part of the amount may already have arrived while the session was pending
+	if current.SenderAddress != nil {
+		s.flagCancelledPayment(current)
+	}
+
+	fmt.Printf("Payment %s cancelled by merchant %s\n", paymentID, merchantID)
+	amountReceived, amountRemaining := AmountReceivedAndRemaining(current)
+	s.publishStatusUpdate(&blockchain.PaymentStatusUpdate{
+		PaymentID:       paymentID,
+		Status:          string(current.Status),
+		Token:           current.TokenSymbol,
+		AmountReceived:  amountReceived,
+		AmountRemaining: amountRemaining,
+	})
+	return current, nil
+}
+
+// flagCancelledPayment requests refunds of everything a cancelled session received and has not refunded yet,
+// each payer getting back what it sent, leaving them for an operator to approve like a merchant's refund request
+func (s *PaymentService) flagCancelledPayment(session *models.PaymentSession) {
+	s.refundMu.Lock()
+	defer s.refundMu.Unlock()
+
+	refundable, err := s.refundableBaseUnits(session)
+	if err != nil {
+		fmt.Printf("Failed to flag refund for cancelled payment %s: %v\n", session.PaymentID, err)
+		return
+	}
+	senders, shares, err := s.senderShares(session)
+	if err != nil {
+		fmt.Printf("Failed to flag refund for cancelled payment %s: %v\n", session.PaymentID, err)
+		return
+	}
+	refunds, err := s.repo.GetRefundsByPaymentID(session.PaymentID)
+	if err != nil {
+		fmt.Printf("Failed to flag refund for cancelled payment %s: %v\n", session.PaymentID, err)
+		return
+	}
+
+	// Earlier refunds already returned part of a payer's share
+	for _, refund := range refunds {
+		share := shares[common.HexToAddress(refund.RecipientAddress).Hex()]
+		if share == nil || refund.Status == models.RefundFailed {
+			continue
+		}
+		if value, ok := new(big.Int).SetString(refund.AmountBaseUnits, 10); ok {
+			share.Sub(share, value)
+		}
+	}
+
+	for _, sender := range senders {
+		amount := shares[sender]
+		if amount.Cmp(refundable) > 0 {
+			amount = refundable
+		}
+		if amount.Sign() <= 0 {
+			continue
+		}
+		if !s.flagCancelledRefund(session, sender, amount) {
+			return
+		}
+		refundable = new(big.Int).Sub(refundable, amount)
+	}
+}
+
+// flagCancelledRefund records a requested refund of amount to one payer of a cancelled session. It reports
+// false when the refund could not be recorded.
+func (s *PaymentService) flagCancelledRefund(session *models.PaymentSession, recipient string, refundable *big.Int) bool {
+	refundID, err := randomID("rfd_", 8)
+	if err != nil {
+		fmt.Printf("Failed to generate refund ID for cancelled payment %s: %v\n", session.PaymentID, err)
+		return false
+	}
+
+	reason := cancelledRefundReason
+	refund := &models.Refund{
+		RefundID:         refundID,
+		PaymentID:        session.PaymentID,
+		MerchantID:       session.MerchantID,
+		Amount:           blockchain.FormatTokenAmount(refundable, session.TokenDecimals),
+		AmountBaseUnits:  refundable.String(),
+		TokenSymbol:      session.TokenSymbol,
+		NetworkID:        session.NetworkID,
+		RecipientAddress: recipient,
+		Reason:           &reason,
+		Status:           models.RefundRequested,
+	}
+	if err := s.repo.CreateRefund(refund); err != nil {
+		fmt.Printf("Failed to flag refund for cancelled payment %s: %v\n", session.PaymentID, err)
+		return false
+	}
+
+	fmt.Printf("Refund %s of %s %s to %s flagged for cancelled payment %s\n", refund.RefundID, refund.Amount, refund.TokenSymbol,
+		recipient, session.PaymentID)
+	return true
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+
+	"payment-backend/internal/blockchain"
+	"payment-backend/internal/models"
+)
+
+// ErrPaymentNotFound is returned when a payment session does not exist
+var ErrPaymentNotFound = errors.New("payment session not found")
+
+// ErrPaymentClosed is returned when a claim is made for a session that already has an outcome
+var ErrPaymentClosed = errors.New("payment session is closed")
+
+// ErrTransactionAlreadyUsed is returned when a claimed transaction already credited another session
+var ErrTransactionAlreadyUsed = errors.New("transaction already used by another payment")
+
+// ErrClaimRejected is returned when a claimed transaction does not pay the session
+var ErrClaimRejected = errors.New("transaction does not pay this session")
+
+// ClaimPayment credits a transaction submitted by the customer to a payment session, including one that
+// expired within its late payment grace window. The transaction is validated on chain for the session's
+// token and receiver, and its amount is then settled like a transfer found by the live watcher.
+func (s *PaymentService) ClaimPayment(ctx context.Context, paymentID, transactionHash string) (*models.PaymentSession, error) {
+	s.claimMu.Lock()
+	defer s.claimMu.Unlock()
+
+	session, err := s.repo.GetPaymentSessionByPaymentID(paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment session: %w", err)
+	}
+	if session == nil {
+		return nil, ErrPaymentNotFound
+	}
+	if isFinalStatus(session.Status) && !s.acceptsLateTransfers(session) {
+		return nil, fmt.Errorf("%w: %s", ErrPaymentClosed, session.Status)
+	}
+
+	txHash := common.HexToHash(transactionHash)
+	if err := s.checkTransactionUnused(paymentID, txHash.Hex()); err != nil {
+		return nil, err
+	}
+
+	bcService, err := s.blockchainFor(session.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Any amount is credited, as the watcher would; settlement decides whether it pays, overpays or only part-pays
+	result, err := bcService.ValidatePayment(ctx, txHash, nil, session.TokenSymbol, session.ReceiverAddress)
+	if errors.Is(err, ethereum.NotFound) {
+		return nil, fmt.Errorf("%w: transaction not found", ErrClaimRejected)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate payment: %w", err)
+	}
+	if !result.Valid {
+		return nil, fmt.Errorf("%w: %s", ErrClaimRejected, result.Reason)
+	}
+	if err := checkClaimedTransfer(session, result); err != nil {
+		return nil, err
+	}
+
+	transfer := &blockchain.TokenTransfer{
+		From:          result.From,
+		To:            result.To,
+		Value:         result.Amount,
+		TxHash:        txHash,
+		BlockNumber:   result.Receipt.BlockNumber,
+		TokenSymbol:   session.TokenSymbol,
+		Token:         result.Token,
+		LogIndex:      result.LogIndex,
+		BlockHash:     result.Receipt.BlockHash,
+		Confirmations: result.Confirmations,
+		Confirmed:     result.Confirmations >= bcService.RequiredConfirmations(),
+	}
+
+	// Follow the claimed transfer's confirmations if the session is still watched
+	if bcService.TrackTransfer(paymentID, transfer) {
+		fmt.Printf("Tracking claimed transfer %s for payment %s\n", txHash.Hex(), paymentID)
+	}
+	s.settleTransfer(ctx, session, bcService, transfer, models.SourceClaim)
+
+	return s.GetPaymentSession(ctx, paymentID)
+}
+
+// checkClaimedTransfer rejects a validated transfer that cannot be the customer's payment for the session:
+// one mined before the session was created, which may be any earlier deposit to a shared receiver, or,
+// with unique amounts, one whose value is not the session's pay amount
+func checkClaimedTransfer(session *models.PaymentSession, result *blockchain.PaymentValidationResult) error {
+	// Without the head at creation a claim cannot be told apart from an older transfer to the same receiver
+	if session.StartBlock == nil {
+		return fmt.Errorf("%w: the session has no start block", ErrClaimRejected)
+	}
+	if result.Receipt == nil || result.Receipt.BlockNumber == nil || result.Receipt.BlockNumber.Int64() < *session.StartBlock {
+		return fmt.Errorf("%w: transaction was mined before the session was created", ErrClaimRejected)
+	}
+
+	if session.PayAmountBaseUnits != nil {
+		payAmount, ok := new(big.Int).SetString(*session.PayAmountBaseUnits, 10)
+		if !ok {
+			return fmt.Errorf("invalid pay amount %q for payment %s", *session.PayAmountBaseUnits, session.PaymentID)
+		}
+		if result.Amount == nil || result.Amount.Cmp(payAmount) != 0 {
+			return fmt.Errorf("%w: %s", ErrClaimRejected, blockchain.ValidationWrongAmount)
+		}
+	}
+	return nil
+}
+
+// checkTransactionUnused rejects a transaction that already credited or settled another session
+func (s *PaymentService) checkTransactionUnused(paymentID, txHash string) error {
+	transfers, err := s.repo.GetPaymentTransfersByTransactionHash(txHash)
+	if err != nil {
+		return fmt.Errorf("failed to get payment transfers: %w", err)
+	}
+	for _, transfer := range transfers {
+		if transfer.PaymentID != paymentID && !transfer.Removed {
+			return fmt.Errorf("%w: %s", ErrTransactionAlreadyUsed, transfer.PaymentID)
+		}
+	}
+
+	other, err := s.repo.GetPaymentSessionByTransactionHash(txHash)
+	if err != nil {
+		return fmt.Errorf("failed to get payment session: %w", err)
+	}
+	if other != nil && other.PaymentID != paymentID {
+		return fmt.Errorf("%w: %s", ErrTransactionAlreadyUsed, other.PaymentID)
+	}
+	return nil
+}
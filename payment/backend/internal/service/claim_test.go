@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"payment-backend/internal/blockchain"
+	"payment-backend/internal/models"
+)
+
+func TestCheckClaimedTransfer(t *testing.T) {
+	startBlock := int64(1000)
+	payAmount := "1000123"
+
+	validated := func(block int64, amount int64) *blockchain.PaymentValidationResult {
+		return &blockchain.PaymentValidationResult{
+			Valid:   true,
+			Receipt: &types.Receipt{BlockNumber: big.NewInt(block)},
+			Amount:  big.NewInt(amount),
+		}
+	}
+
+	tests := []struct {
+		name       string
+		startBlock *int64
+		payAmount  *string
+		result     *blockchain.PaymentValidationResult
+		wantErr    bool
+	}{
+		{"transfer before the session", &startBlock, nil, validated(999, 1000000), true},
+		{"transfer in the start block", &startBlock, nil, validated(1000, 1000000), false},
+		{"transfer after the session", &startBlock, nil, validated(1200, 5), false},
+		{"session without start block", nil, nil, validated(1200, 1000000), true},
+		{"unique amount matches", &startBlock, &payAmount, validated(1200, 1000123), false},
+		{"unique amount differs", &startBlock, &payAmount, validated(1200, 1000000), true},
+		{"older transfer of the unique amount", &startBlock, &payAmount, validated(10, 1000123), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := &models.PaymentSession{
+				PaymentID:          "pay_claim_test",
+				StartBlock:         tt.startBlock,
+				PayAmountBaseUnits: tt.payAmount,
+			}
+			err := checkClaimedTransfer(session, tt.result)
+			if tt.wantErr && !errors.Is(err, ErrClaimRejected) {
+				t.Errorf("checkClaimedTransfer error = %v, want ErrClaimRejected", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("checkClaimedTransfer error = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"payment-backend/internal/blockchain"
+	"payment-backend/internal/models"
+)
+
+// defaultExpirySweepInterval is used when no sweep interval is configured
+const defaultExpirySweepInterval = 30 * time.Second
+
+// StartExpirySweeper periodically expires created and pending sessions past their expiry time
+// and deletes idempotency keys past their replay window
+func (s *PaymentService) StartExpirySweeper(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultExpirySweepInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	fmt.Printf("Started payment expiry sweeper (interval %s)\n", interval)
+
+	for {
+		s.sweepExpiredPayments(ctx)
+		s.pruneIdempotencyKeys()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sweepExpiredPayments expires every overdue session
+func (s *PaymentService) sweepExpiredPayments(ctx context.Context) {
+	sessions, err := s.repo.GetOverduePaymentSessions(time.Now().UTC())
+	if err != nil {
+		fmt.Printf("Failed to get overdue payment sessions: %v\n", err)
+		return
+	}
+
+	for _, session := range sessions {
+		s.expirePayment(ctx, session)
+	}
+}
+
+// expirePayment closes a session whose window passed, marking it underpaid if part of the amount arrived
+// and expired otherwise, then stops its blockchain watch and notifies frontend clients.
+// Sessions that moved past pending in the meantime are left alone.
+func (s *PaymentService) expirePayment(ctx context.Context, session *models.PaymentSession) {
+	s.settleMu.Lock()
+	defer s.settleMu.Unlock()
+
+	expired, err := s.repo.ExpirePaymentSession(session.PaymentID, models.StatusChange{
+		Reason: "payment window expired",
+		Source: models.SourceSweeper,
+	})
+	if err != nil {
+		fmt.Printf("Failed to expire payment %s: %v\n", session.PaymentID, err)
+		return
+	}
+	if !expired {
+		return
+	}
+
+	if bcService, err := s.blockchainFor(session.NetworkID); err == nil {
+		// Keep watching through the grace window so transfers arriving just after expiry are not lost
+		if time.Now().UTC().Before(s.latePaymentWindowEnd(session)) {
+			bcService.MarkPaymentLate(session.PaymentID)
+		} else {
+			bcService.StopPaymentMonitoring(session.PaymentID)
+		}
+	}
+
+	current, err := s.repo.GetPaymentSessionByPaymentID(session.PaymentID)
+	if err != nil || current == nil {
+		fmt.Printf("Failed to reload expired payment %s: %v\n", session.PaymentID, err)
+		return
+	}
+
+	fmt.Printf("Payment %s closed as %s\n", session.PaymentID, current.Status)
+	amountReceived, amountRemaining := AmountReceivedAndRemaining(current)
+	s.publishStatusUpdate(&blockchain.PaymentStatusUpdate{
+		PaymentID:       session.PaymentID,
+		Status:          string(current.Status),
+		Token:           session.TokenSymbol,
+		AmountReceived:  amountReceived,
+		AmountRemaining: amountRemaining,
+	})
+}
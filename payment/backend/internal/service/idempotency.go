@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"payment-backend/internal/models"
+)
+
+// defaultIdempotencyKeyTTL is used when no idempotency key lifetime is configured
+const defaultIdempotencyKeyTTL = 24 * time.Hour
+
+// idempotencyKeyLease is how long an in-progress reservation holds its key. A reservation left behind
+// by a request that crashed before completing or releasing it can be taken over once the lease ends.
+const idempotencyKeyLease = time.Minute
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is replayed with a different request body
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used with a different request")
+
+// ErrIdempotencyKeyInProgress is returned when the first request with an idempotency key has not finished
+var ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is in progress")
+
+// BeginIdempotentRequest reserves a merchant's idempotency key for a request with the given body hash.
+// It returns the stored record when the key already completed the same request, which should be replayed,
+// and nil when the caller should process the request and then complete or release the key.
+func (s *PaymentService) BeginIdempotentRequest(ctx context.Context, merchantID, key, requestHash string) (*models.IdempotencyKey, error) {
+	existing, err := s.repo.ReserveIdempotencyKey(&models.IdempotencyKey{
+		MerchantID:  merchantID,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   time.Now().UTC().Add(idempotencyKeyLease),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if existing == nil {
+		return nil, nil
+	}
+
+	if existing.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if existing.ResponseStatus == nil || existing.ResponseBody == nil {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	return existing, nil
+}
+
+// CompleteIdempotentRequest stores the response of a request made with a reserved idempotency key
+// and keeps it for replay until the idempotency key lifetime ends
+func (s *PaymentService) CompleteIdempotentRequest(ctx context.Context, merchantID, key, paymentID string, status int, body []byte) error {
+	ttl := s.config.IdempotencyKeyTTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyKeyTTL
+	}
+
+	if err := s.repo.CompleteIdempotencyKey(merchantID, key, paymentID, status, string(body), time.Now().UTC().Add(ttl)); err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotentRequest frees a reserved idempotency key after its request failed, so it can be retried
+func (s *PaymentService) ReleaseIdempotentRequest(ctx context.Context, merchantID, key string) {
+	if err := s.repo.ReleaseIdempotencyKey(merchantID, key); err != nil {
+		fmt.Printf("Failed to release idempotency key %s for %s: %v\n", key, merchantID, err)
+	}
+}
+
+// pruneIdempotencyKeys deletes idempotency keys past their replay window
+func (s *PaymentService) pruneIdempotencyKeys() {
+	deleted, err := s.repo.DeleteExpiredIdempotencyKeys(time.Now().UTC())
+	if err != nil {
+		fmt.Printf("Failed to delete expired idempotency keys: %v\n", err)
+		return
+	}
+	if deleted > 0 {
+		fmt.Printf("Deleted %d expired idempotency keys\n", deleted)
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"payment-backend/internal/blockchain"
+	"payment-backend/internal/models"
+)
+
+// ErrNotLatePayment is returned when accepting a payment session that is not paid_late
+var ErrNotLatePayment = errors.New("payment session is not paid late")
+
+// latePaymentWindowEnd returns when a session stops being watched for transfers: its expiry plus the late payment grace
+func (s *PaymentService) latePaymentWindowEnd(session *models.PaymentSession) time.Time {
+	if s.config.LatePaymentGrace <= 0 {
+		return session.ExpiresAt
+	}
+	return session.ExpiresAt.Add(s.config.LatePaymentGrace)
+}
+
+// acceptsLateTransfers reports whether a closed session still takes transfers: expired, underpaid and cancelled
+// sessions are watched until their late payment grace window ends
+func (s *PaymentService) acceptsLateTransfers(session *models.PaymentSession) bool {
+	switch session.Status {
+	case models.PaymentExpired, models.PaymentUnderpaid, models.PaymentCancelled:
+		return time.Now().UTC().Before(s.latePaymentWindowEnd(session))
+	}
+	return false
+}
+
+// lateSettlementStatus decides whether a transfer to a closed session reopens it. Only expired, underpaid and
+// paid_late sessions take transfers detected within the grace window; a session paid in full becomes paid_late
+// and a partial payment keeps it underpaid. It reports false when the transfer is only recorded.
+func (s *PaymentService) lateSettlementStatus(session *models.PaymentSession, status models.PaymentStatus, detectedAt time.Time) (models.PaymentStatus, bool) {
+	switch session.Status {
+	case models.PaymentExpired, models.PaymentUnderpaid, models.PaymentPaidLate:
+	default:
+		return "", false
+	}
+	if detectedAt.After(s.latePaymentWindowEnd(session)) {
+		return "", false
+	}
+
+	switch status {
+	case models.PaymentPaid, models.PaymentOverpaid:
+		return models.PaymentPaidLate, true
+	case models.PaymentUnderpaid:
+		return models.PaymentUnderpaid, true
+	default:
+		// Unconfirmed transfers are settled once they have their confirmations
+		return "", false
+	}
+}
+
+// AcceptLatePayment lets a merchant accept a session paid in its late payment grace window,
+// settling it as paid or overpaid from the amount received. Merchants refund it instead through RequestRefund.
+func (s *PaymentService) AcceptLatePayment(ctx context.Context, merchantID, paymentID string) (*models.PaymentSession, error) {
+	s.settleMu.Lock()
+	defer s.settleMu.Unlock()
+
+	session, err := s.merchantPaymentSession(merchantID, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != models.PaymentPaidLate {
+		return nil, fmt.Errorf("%w: the session is %s", ErrNotLatePayment, session.Status)
+	}
+
+	expected, err := sessionBaseUnits(session)
+	if err != nil {
+		return nil, err
+	}
+	received, ok := new(big.Int).SetString(session.AmountReceivedBaseUnits, 10)
+	if !ok {
+		received = new(big.Int)
+	}
+	status := s.settlementStatus(expected, received, false, true)
+	if status != models.PaymentOverpaid {
+		status = models.PaymentPaid
+	}
+
+	accepted, err := s.repo.AcceptLatePayment(paymentID, status, models.StatusChange{
+		Reason: "late payment accepted by merchant",
+		Source: models.SourceMerchant,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept late payment: %w", err)
+	}
+	if !accepted {
+		return nil, fmt.Errorf("%w: the session changed status", ErrNotLatePayment)
+	}
+
+	current, err := s.repo.GetPaymentSessionByPaymentID(paymentID)
+	if err != nil || current == nil {
+		return nil, fmt.Errorf("failed to reload payment session: %v", err)
+	}
+
+	fmt.Printf("Late payment %s accepted as %s\n", paymentID, current.Status)
+	amountReceived, amountRemaining := AmountReceivedAndRemaining(current)
+	s.publishStatusUpdate(&blockchain.PaymentStatusUpdate{
+		PaymentID:       paymentID,
+		Status:          string(current.Status),
+		Token:           current.TokenSymbol,
+		AmountReceived:  amountReceived,
+		AmountRemaining: amountRemaining,
+	})
+	return current, nil
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"payment-backend/internal/models"
+	"payment-backend/internal/repository"
+)
+
+// apiKeyPrefixLength is the number of leading API key characters stored to tell keys apart
+const apiKeyPrefixLength = 11
+
+// ErrInvalidAPIKey is returned when an API key does not belong to an enabled merchant
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// ErrMerchantNameRequired is returned when a merchant is created without a name
+var ErrMerchantNameRequired = errors.New("merchant name is required")
+
+// MerchantService manages merchants and authenticates their API keys
+type MerchantService struct {
+	repo *repository.Repository
+}
+
+// NewMerchantService creates a new merchant service
+func NewMerchantService(repo *repository.Repository) *MerchantService {
+	return &MerchantService{repo: repo}
+}
+
+// CreateMerchant creates a merchant and returns it with its API key, which is not stored and cannot be shown again
+func (s *MerchantService) CreateMerchant(ctx context.Context, name string) (*models.Merchant, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", ErrMerchantNameRequired
+	}
+
+	merchantID, err := randomID("mch_", 8)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate merchant ID: %w", err)
+	}
+	apiKey, err := randomID("sk_", 24)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	merchant := &models.Merchant{
+		MerchantID:   merchantID,
+		Name:         name,
+		APIKeyPrefix: apiKey[:apiKeyPrefixLength],
+		APIKeyHash:   hashAPIKey(apiKey),
+		Enabled:      true,
+	}
+	if err := s.repo.CreateMerchant(merchant); err != nil {
+		return nil, "", fmt.Errorf("failed to create merchant: %w", err)
+	}
+
+	return merchant, apiKey, nil
+}
+
+// GetMerchants returns every merchant
+func (s *MerchantService) GetMerchants(ctx context.Context) ([]*models.Merchant, error) {
+	return s.repo.GetMerchants()
+}
+
+// Authenticate returns the enabled merchant owning an API key
+func (s *MerchantService) Authenticate(ctx context.Context, apiKey string) (*models.Merchant, error) {
+	if apiKey == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	merchant, err := s.repo.GetMerchantByAPIKeyHash(hashAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merchant: %w", err)
+	}
+	if merchant == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	return merchant, nil
+}
+
+// hashAPIKey returns the hex SHA-256 of an API key. Keys are random, so an unsalted hash is enough
+// to keep a leaked database from revealing usable keys.
+func hashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomID returns prefix followed by n random bytes in hex
+func randomID(prefix string, n int) (string, error) {
+	key := make([]byte, n)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(key), nil
+}
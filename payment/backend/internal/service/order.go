@@ -0,0 +1,111 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"unicode/utf8"
+
+	"payment-backend/internal/models"
+)
+
+// Limits on the merchant order details attached to a payment session
+const (
+	maxMerchantOrderIDLength = 128
+	maxMetadataBytes         = 4096
+	maxMetadataKeys          = 50
+	maxMetadataKeyLength     = 64
+	maxRedirectURLLength     = 2048
+)
+
+// ErrInvalidOrderDetails is returned when a merchant order ID, metadata object or redirect URL is rejected
+var ErrInvalidOrderDetails = errors.New("invalid order details")
+
+// ErrDuplicateMerchantOrder is returned when the merchant already has a payment session for an order ID
+var ErrDuplicateMerchantOrder = errors.New("merchant order already has a payment session")
+
+// orderDetails are the validated merchant order fields of a new payment session
+type orderDetails struct {
+	merchantOrderID *string
+	metadata        *string
+	successURL      *string
+	cancelURL       *string
+}
+
+// validateOrderDetails checks the merchant order fields of a create request. Metadata must be a JSON object
+// of at most maxMetadataKeys keys and maxMetadataBytes once compacted; redirect URLs must be absolute http(s).
+func validateOrderDetails(req *CreatePaymentRequest) (*orderDetails, error) {
+	details := &orderDetails{}
+
+	if req.MerchantOrderID != "" {
+		if utf8.RuneCountInString(req.MerchantOrderID) > maxMerchantOrderIDLength {
+			return nil, fmt.Errorf("%w: merchantOrderId must be at most %d characters", ErrInvalidOrderDetails, maxMerchantOrderIDLength)
+		}
+		details.merchantOrderID = &req.MerchantOrderID
+	}
+
+	if len(req.Metadata) > 0 && string(req.Metadata) != "null" {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(req.Metadata, &fields); err != nil || fields == nil {
+			return nil, fmt.Errorf("%w: metadata must be a JSON object", ErrInvalidOrderDetails)
+		}
+		if len(fields) > maxMetadataKeys {
+			return nil, fmt.Errorf("%w: metadata may have at most %d keys", ErrInvalidOrderDetails, maxMetadataKeys)
+		}
+		for key := range fields {
+			if key == "" || utf8.RuneCountInString(key) > maxMetadataKeyLength {
+				return nil, fmt.Errorf("%w: metadata keys must be 1 to %d characters", ErrInvalidOrderDetails, maxMetadataKeyLength)
+			}
+		}
+
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, req.Metadata); err != nil {
+			return nil, fmt.Errorf("%w: metadata must be a JSON object", ErrInvalidOrderDetails)
+		}
+		if compacted.Len() > maxMetadataBytes {
+			return nil, fmt.Errorf("%w: metadata must be at most %d bytes", ErrInvalidOrderDetails, maxMetadataBytes)
+		}
+		metadata := compacted.String()
+		details.metadata = &metadata
+	}
+
+	var err error
+	if details.successURL, err = validateRedirectURL("successUrl", req.SuccessURL); err != nil {
+		return nil, err
+	}
+	if details.cancelURL, err = validateRedirectURL("cancelUrl", req.CancelURL); err != nil {
+		return nil, err
+	}
+
+	return details, nil
+}
+
+// validateRedirectURL returns nil for an empty URL and rejects anything but an absolute http(s) URL
+func validateRedirectURL(field, redirectURL string) (*string, error) {
+	if redirectURL == "" {
+		return nil, nil
+	}
+	if len(redirectURL) > maxRedirectURLLength {
+		return nil, fmt.Errorf("%w: %s must be at most %d characters", ErrInvalidOrderDetails, field, maxRedirectURLLength)
+	}
+	parsed, err := url.Parse(redirectURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: %s must be an absolute http or https URL", ErrInvalidOrderDetails, field)
+	}
+	return &redirectURL, nil
+}
+
+// GetPaymentSessionByMerchantOrderID retrieves a merchant's payment session by its merchant order ID
+func (s *PaymentService) GetPaymentSessionByMerchantOrderID(ctx context.Context, merchantID, merchantOrderID string) (*models.PaymentSession, error) {
+	session, err := s.repo.GetPaymentSessionByMerchantOrderID(merchantID, merchantOrderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment session: %w", err)
+	}
+	if session == nil {
+		return nil, ErrPaymentNotFound
+	}
+	return session, nil
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -18,69 +21,213 @@ import (
 // PaymentService provides payment-related business logic
 type PaymentService struct {
 	repo         *repository.Repository
-	bcService    BlockchainService
+	chains       *blockchain.Registry
 	config       PaymentConfig
+	paymentCh    chan<- *blockchain.PaymentStatusUpdate
+
+	// settleMu serializes settlement so concurrent transfers are totalled consistently
+	settleMu sync.Mutex
+	// claimMu serializes claims so one transaction cannot be claimed by two sessions at once
+	claimMu sync.Mutex
+	// refundMu serializes refund requests so a session is never refunded more than it received
+	refundMu sync.Mutex
 }
 
-// BlockchainService interface for blockchain operations
+// BlockchainService interface for blockchain operations on one network
 type BlockchainService interface {
 	MonitorTokenTransfers(ctx context.Context, tokenAddress common.Address, expectedAmount *big.Int) (<-chan *blockchain.TokenTransfer, error)
 	ValidatePayment(ctx context.Context, txHash common.Hash, expectedAmount *big.Int, tokenSymbol, receiverAddress string) (*blockchain.PaymentValidationResult, error)
+	ValidateTransfer(ctx context.Context, txHash common.Hash, expectedAmount *big.Int, tokenSymbol, senderAddress, receiverAddress string) (*blockchain.PaymentValidationResult, error)
 	GetTokenBalance(ctx context.Context, tokenAddress, ownerAddress common.Address) (*big.Int, error)
 	GetLatestBlockNumber(ctx context.Context) (*big.Int, error)
 	StartPaymentMonitoringWithCallback(paymentID, tokenSymbol, receiverAddress string, expectedAmount *big.Int, timeout time.Duration, callback blockchain.PaymentCallback) error
+	BackfillPayment(ctx context.Context, paymentID string, fromBlock uint64) error
+	RequiredConfirmations() int
+	ChainID() int64
+	TrackTransfer(paymentID string, transfer *blockchain.TokenTransfer) bool
+	MarkPaymentLate(paymentID string)
+	StopPaymentMonitoring(paymentID string)
 	GetConnectionStats() map[string]interface{}
 	GetMessageLog(limit int) []blockchain.WebSocketMessageLog
 	Close()
 }
 
+// ErrUnsupportedNetwork is returned when a payment uses a network that is not enabled
+var ErrUnsupportedNetwork = errors.New("unsupported network")
+
+// ErrUnsupportedToken is returned when a payment uses a token that is not enabled on its network
+var ErrUnsupportedToken = errors.New("unsupported token")
+
+// ErrReceiverAddressRequired is returned when a session has no receiver address and none can be derived
+var ErrReceiverAddressRequired = errors.New("receiver address is required")
+
+// ErrInvalidAmount is returned when a payment amount is not a positive amount the token can represent
+var ErrInvalidAmount = errors.New("invalid amount")
+
 // PaymentConfig holds payment configuration
 type PaymentConfig struct {
 	ReceiverAddress string
 	PaymentTimeout  time.Duration
+	ToleranceBps    int // Shortfall or excess, in basis points of the amount due, still settled as paid
+	DepositKey      *blockchain.ExtendedPublicKey // Derives a receiver address per session when set
+	UniqueAmountSlots int    // Number of distinct offsets tried per amount; 0 disables unique amounts
+	UniqueAmountStep  string // Decimal token amount between offsets
+	TokenSecret       []byte        // Signs payment tokens granting customers read access to a session
+	TokenTTL          time.Duration // Lifetime of a payment token
+	IdempotencyKeyTTL time.Duration // How long an Idempotency-Key replays its original response
+	LatePaymentGrace  time.Duration // How long expired sessions are still watched for late transfers
 }
 
 // NewPaymentService creates a new payment service
-func NewPaymentService(repo *repository.Repository, bcService BlockchainService, config PaymentConfig) *PaymentService {
+func NewPaymentService(repo *repository.Repository, chains *blockchain.Registry, config PaymentConfig) *PaymentService {
 	return &PaymentService{
-		repo:      repo,
-		bcService: bcService,
-		config:    config,
+		repo:   repo,
+		chains: chains,
+		config: config,
+	}
+}
+
+// blockchainFor returns the blockchain service watching a network
+func (s *PaymentService) blockchainFor(networkID string) (BlockchainService, error) {
+	bcService, ok := s.chains.Get(networkID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedNetwork, networkID)
+	}
+	return bcService, nil
+}
+
+// SetPaymentChannel sets the channel that receives payment status updates for frontend clients
+func (s *PaymentService) SetPaymentChannel(paymentCh chan<- *blockchain.PaymentStatusUpdate) {
+	s.paymentCh = paymentCh
+}
+
+// publishStatusUpdate sends a payment status update to frontend clients without blocking
+func (s *PaymentService) publishStatusUpdate(update *blockchain.PaymentStatusUpdate) {
+	if s.paymentCh == nil {
+		return
+	}
+
+	select {
+	case s.paymentCh <- update:
+	default:
+		fmt.Printf("Payment status channel full, dropping %s update for %s\n", update.Status, update.PaymentID)
 	}
 }
 
 // CreatePaymentSession creates a new payment session
 func (s *PaymentService) CreatePaymentSession(ctx context.Context, req *CreatePaymentRequest) (*models.PaymentSession, error) {
+	order, err := validateOrderDetails(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fail fast on a reused order ID; the unique index still decides races
+	if order.merchantOrderID != nil {
+		existing, err := s.repo.GetPaymentSessionByMerchantOrderID(req.MerchantID, req.MerchantOrderID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check merchant order: %w", err)
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateMerchantOrder, req.MerchantOrderID)
+		}
+	}
+
 	// Generate unique payment ID
 	paymentID, err := generatePaymentID()
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate payment ID: %w", err)
 	}
 
+	bcService, err := s.blockchainFor(req.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert the amount to base units with the token's configured decimals
+	token, err := s.repo.GetTokenBySymbol(req.TokenSymbol, req.NetworkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token: %w", err)
+	}
+	if token == nil {
+		return nil, fmt.Errorf("%w: %s on %s", ErrUnsupportedToken, req.TokenSymbol, req.NetworkID)
+	}
+
+	amountBaseUnits, err := blockchain.ParseTokenAmount(req.Amount, token.Decimals)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+	}
+	if amountBaseUnits.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: amount must be greater than zero", ErrInvalidAmount)
+	}
+	amount := blockchain.FormatTokenAmount(amountBaseUnits, token.Decimals)
+
+	// Without an explicit receiver, pay to a fresh address derived from the deposit key
+	receiverAddress := req.ReceiverAddress
+	var derivationIndex *int64
+	if receiverAddress == "" {
+		address, index, err := s.deriveReceiverAddress()
+		if err != nil {
+			return nil, err
+		}
+		receiverAddress = address
+		derivationIndex = &index
+	}
+
+	var merchantID *string
+	if req.MerchantID != "" {
+		merchantID = &req.MerchantID
+	}
+
 	// Calculate expiration time using UTC to avoid timezone issues
 	expiresAt := time.Now().UTC().Add(s.config.PaymentTimeout)
 
-	// Generate QR code data (simplified)
-	qrCodeData := fmt.Sprintf("%s?amount=%f&token=%s", req.ReceiverAddress, req.Amount, req.TokenSymbol)
+	// Generate an EIP-681 URI so wallets prefill the ERC-20 transfer
+	qrCodeData := paymentURI(token.ContractAddress, bcService.ChainID(), receiverAddress, amountBaseUnits)
+
+	// Remember the chain head so transfers can be backfilled from here after a restart
+	var startBlock *int64
+	if latestBlock, err := bcService.GetLatestBlockNumber(ctx); err != nil {
+		fmt.Printf("Warning: failed to get latest block for payment %s: %v\n", paymentID, err)
+	} else {
+		blockNumber := latestBlock.Int64()
+		startBlock = &blockNumber
+	}
 
 	// Create payment session
 	session := &models.PaymentSession{
 		PaymentID:       paymentID,
+		MerchantID:      merchantID,
+		MerchantOrderID: order.merchantOrderID,
 		ProductID:       req.ProductID,
 		ProductName:     req.ProductName,
-		Amount:          req.Amount,
+		Amount:          amount,
+		AmountBaseUnits: amountBaseUnits.String(),
+		TokenDecimals:   token.Decimals,
 		Currency:        req.Currency,
 		TokenSymbol:     req.TokenSymbol,
 		NetworkID:       req.NetworkID,
-		ReceiverAddress: req.ReceiverAddress,
+		ReceiverAddress: receiverAddress,
 		Status:          models.PaymentCreated,
 		QRCodeData:      &qrCodeData,
+		StartBlock:      startBlock,
+		DerivationIndex: derivationIndex,
+		Metadata:        order.metadata,
+		SuccessURL:      order.successURL,
+		CancelURL:       order.cancelURL,
 		ExpiresAt:       expiresAt,
 	}
 
-	// Save to database
-	if err := s.repo.CreatePaymentSession(session); err != nil {
-		return nil, fmt.Errorf("failed to create payment session: %w", err)
+	// Save to database, offsetting the amount to pay when sessions share a receiver
+	if s.config.UniqueAmountSlots > 0 {
+		err = s.createWithUniqueAmount(session, amountBaseUnits, token.ContractAddress, bcService.ChainID())
+	} else if err = s.repo.CreatePaymentSession(session); err != nil {
+		err = fmt.Errorf("failed to create payment session: %w", err)
+	}
+	if errors.Is(err, repository.ErrDuplicateMerchantOrder) {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicateMerchantOrder, req.MerchantOrderID)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	// Start monitoring for payment (in a real implementation, this would be done asynchronously)
@@ -89,6 +236,35 @@ func (s *PaymentService) CreatePaymentSession(ctx context.Context, req *CreatePa
 	return session, nil
 }
 
+// DerivesReceiverAddresses reports whether sessions without a receiver address get a derived one
+func (s *PaymentService) DerivesReceiverAddresses() bool {
+	return s.config.DepositKey != nil
+}
+
+// deriveReceiverAddress reserves the next child index of the deposit key and returns its address
+func (s *PaymentService) deriveReceiverAddress() (string, int64, error) {
+	if s.config.DepositKey == nil {
+		return "", 0, ErrReceiverAddressRequired
+	}
+
+	for {
+		index, err := s.repo.NextDerivationIndex(s.config.DepositKey.String())
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to reserve derivation index: %w", err)
+		}
+
+		address, err := s.config.DepositKey.DeriveAddress(index)
+		if errors.Is(err, blockchain.ErrInvalidChildIndex) {
+			// BIP-32 skips the rare index without a valid child key
+			continue
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to derive receiver address: %w", err)
+		}
+		return address.Hex(), int64(index), nil
+	}
+}
+
 // GetPaymentSession retrieves a payment session by ID
 func (s *PaymentService) GetPaymentSession(ctx context.Context, paymentID string) (*models.PaymentSession, error) {
 	session, err := s.repo.GetPaymentSessionByPaymentID(paymentID)
@@ -96,11 +272,29 @@ func (s *PaymentService) GetPaymentSession(ctx context.Context, paymentID string
 		return nil, fmt.Errorf("failed to get payment session: %w", err)
 	}
 	if session == nil {
-		return nil, fmt.Errorf("payment session not found")
+		return nil, ErrPaymentNotFound
 	}
 	return session, nil
 }
 
+// GetPaymentTransfers retrieves every transfer recorded for a payment session
+func (s *PaymentService) GetPaymentTransfers(ctx context.Context, paymentID string) ([]*models.PaymentTransfer, error) {
+	transfers, err := s.repo.GetPaymentTransfers(paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment transfers: %w", err)
+	}
+	return transfers, nil
+}
+
+// GetPaymentStatusHistory retrieves the status transitions of a payment session, oldest first
+func (s *PaymentService) GetPaymentStatusHistory(ctx context.Context, paymentID string) ([]*models.PaymentStatusHistory, error) {
+	history, err := s.repo.GetPaymentStatusHistory(paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment status history: %w", err)
+	}
+	return history, nil
+}
+
 // GetAllTokens retrieves all supported tokens
 func (s *PaymentService) GetAllTokens(ctx context.Context) ([]*models.Token, error) {
 	tokens, err := s.repo.GetAllTokens()
@@ -119,22 +313,6 @@ func (s *PaymentService) GetAllNetworks(ctx context.Context) ([]*models.Network,
 	return networks, nil
 }
 
-// GetPaymentStats retrieves payment statistics
-func (s *PaymentService) GetPaymentStats(ctx context.Context) (*models.PaymentStats, error) {
-	// This is a simplified implementation
-	// In a real implementation, you would query the database for statistics
-	return &models.PaymentStats{
-		TotalPayments:       0,
-		SuccessfulPayments:  0,
-		FailedPayments:      0,
-		SuccessRate:         0.0,
-		PaymentsByToken:     make(map[string]int),
-		PaymentsByPeriod:    make(map[string]int),
-		AverageProcessingTime: 0.0,
-		FailureReasons:      make(map[string]int),
-	}, nil
-}
-
 // GetMonitoringStats retrieves monitoring statistics
 func (s *PaymentService) GetMonitoringStats(ctx context.Context) (*models.MonitoringStats, error) {
 	// This is a simplified implementation
@@ -174,78 +352,140 @@ func (s *PaymentService) GetSystemStats(ctx context.Context) (*models.SystemStat
 	}, nil
 }
 
-// UpdatePaymentStatus updates the status of a payment session
-func (s *PaymentService) UpdatePaymentStatus(ctx context.Context, paymentID string, status models.PaymentStatus,
+// ErrInvalidTransition is returned when the payment state machine does not allow a status change
+var ErrInvalidTransition = errors.New("invalid payment status transition")
+
+// ErrStatusConflict is returned when a payment session changed status before an update could apply
+var ErrStatusConflict = errors.New("payment status changed concurrently")
+
+// UpdatePaymentStatus moves a payment session from the status it was read in to a new one, recording why in its
+// status history. Illegal transitions are rejected, and the update only applies while the session is still in from.
+func (s *PaymentService) UpdatePaymentStatus(ctx context.Context, paymentID string, from, status models.PaymentStatus, change models.StatusChange,
 	senderAddress *string, transactionHash *string, blockNumber *int64, confirmedAt *time.Time) error {
 
-	if err := s.repo.UpdatePaymentSessionStatus(paymentID, status, senderAddress, transactionHash, blockNumber, confirmedAt); err != nil {
+	if !models.CanTransition(from, status) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, status)
+	}
+	updated, err := s.repo.UpdatePaymentSessionStatus(paymentID, from, status, change, senderAddress, transactionHash, blockNumber, confirmedAt)
+	if err != nil {
 		return fmt.Errorf("failed to update payment status: %w", err)
 	}
+	if !updated {
+		return fmt.Errorf("%w: payment %s is no longer %s", ErrStatusConflict, paymentID, from)
+	}
 	return nil
 }
 
-// GetBlockchainConnectionStats retrieves blockchain connection statistics
+// GetBlockchainConnectionStats retrieves blockchain connection statistics keyed by network ID
 func (s *PaymentService) GetBlockchainConnectionStats() map[string]interface{} {
-	// Check if the blockchain service has the GetConnectionStats method
-	if bcServiceWithStats, ok := s.bcService.(interface {
-		GetConnectionStats() map[string]interface{}
-	}); ok {
-		return bcServiceWithStats.GetConnectionStats()
+	stats := make(map[string]interface{})
+	for _, networkID := range s.chains.NetworkIDs() {
+		if bcService, err := s.blockchainFor(networkID); err == nil {
+			stats[networkID] = bcService.GetConnectionStats()
+		}
 	}
-
-	// Return empty stats if method not available
-	return make(map[string]interface{})
+	return stats
 }
 
-// GetBlockchainMessageLog retrieves blockchain WebSocket message logs
+// GetBlockchainMessageLog retrieves blockchain WebSocket message logs of every network
 func (s *PaymentService) GetBlockchainMessageLog(limit int) []blockchain.WebSocketMessageLog {
-	// Check if the blockchain service has the GetMessageLog method
-	if bcServiceWithLogs, ok := s.bcService.(interface {
-		GetMessageLog(limit int) []blockchain.WebSocketMessageLog
-	}); ok {
-		return bcServiceWithLogs.GetMessageLog(limit)
+	messages := make([]blockchain.WebSocketMessageLog, 0)
+	for _, networkID := range s.chains.NetworkIDs() {
+		if bcService, err := s.blockchainFor(networkID); err == nil {
+			messages = append(messages, bcService.GetMessageLog(limit)...)
+		}
+	}
+	return messages
+}
+
+// ResumePaymentMonitoring re-registers every open, unexpired session with the blockchain service
+// and backfills transfers that landed while the process was down
+func (s *PaymentService) ResumePaymentMonitoring(ctx context.Context) error {
+	sessions, err := s.repo.GetOpenPaymentSessions(time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to get open payment sessions: %w", err)
+	}
+
+	// Sessions that expired or were cancelled within the grace window are still watched for late transfers
+	lateSessions, err := s.repo.GetLatePaymentWindowSessions(time.Now().UTC().Add(-s.config.LatePaymentGrace))
+	if err != nil {
+		return fmt.Errorf("failed to get expired payment sessions: %w", err)
 	}
 
-	// Return empty log if method not available
-	return make([]blockchain.WebSocketMessageLog, 0)
+	fmt.Printf("Resuming monitoring for %d open and %d recently expired payment sessions\n", len(sessions), len(lateSessions))
+
+	late := make(map[string]bool, len(lateSessions))
+	for _, session := range lateSessions {
+		late[session.PaymentID] = true
+	}
+	sessions = append(sessions, lateSessions...)
+
+	for _, session := range sessions {
+		s.monitorPayment(ctx, session)
+		if late[session.PaymentID] {
+			if bcService, err := s.blockchainFor(session.NetworkID); err == nil {
+				bcService.MarkPaymentLate(session.PaymentID)
+			}
+		}
+
+		if session.StartBlock == nil {
+			fmt.Printf("Payment %s has no start block, skipping backfill\n", session.PaymentID)
+			continue
+		}
+
+		bcService, err := s.blockchainFor(session.NetworkID)
+		if err != nil {
+			fmt.Printf("Failed to backfill payment %s: %v\n", session.PaymentID, err)
+			continue
+		}
+		if err := bcService.BackfillPayment(ctx, session.PaymentID, uint64(*session.StartBlock)); err != nil {
+			fmt.Printf("Failed to backfill payment %s: %v\n", session.PaymentID, err)
+		}
+	}
+
+	return nil
 }
 
 // monitorPayment monitors a payment session for completion
 func (s *PaymentService) monitorPayment(ctx context.Context, session *models.PaymentSession) {
+	bcService, err := s.blockchainFor(session.NetworkID)
+	if err != nil {
+		fmt.Printf("Failed to start WebSocket monitoring for payment %s: %v\n", session.PaymentID, err)
+		return
+	}
+
 	// Try to start WebSocket monitoring for this payment
-	if bcServiceWithWebSocket, ok := s.bcService.(interface {
+	if bcServiceWithWebSocket, ok := bcService.(interface {
 		StartPaymentMonitoringWithCallback(paymentID, tokenSymbol, receiverAddress string, expectedAmount *big.Int, timeout time.Duration, callback blockchain.PaymentCallback) error
 	}); ok {
-		// Convert amount to wei for monitoring
-		amountWei := new(big.Int)
-		amountWei.SetString(fmt.Sprintf("%.0f", session.Amount*1e18), 10)
+		expectedAmount, err := sessionBaseUnits(session)
+		if err != nil {
+			fmt.Printf("Failed to start WebSocket monitoring for payment %s: %v\n", session.PaymentID, err)
+			return
+		}
 
 		// Start monitoring with callback to update payment status
 		callback := func(transfer *blockchain.TokenTransfer, err error) {
+			if errors.Is(err, blockchain.ErrPaymentTimeout) {
+				s.expirePayment(ctx, session)
+				return
+			}
 			if err != nil {
 				fmt.Printf("Payment monitoring error for %s: %v\n", session.PaymentID, err)
 				// Update payment status to failed
-				s.UpdatePaymentStatus(ctx, session.PaymentID, models.PaymentFailed, nil, nil, nil, nil)
+				s.failPayment(ctx, session.PaymentID, err.Error())
 				return
 			}
 
-			// Update payment status to paid
-			senderAddr := transfer.From.Hex()
-			txHashStr := transfer.TxHash.Hex()
-			blockNum := transfer.BlockNumber.Int64()
-			confirmedAt := time.Now()
-
-			err = s.UpdatePaymentStatus(ctx, session.PaymentID, models.PaymentPaid, &senderAddr, &txHashStr, &blockNum, &confirmedAt)
-			if err != nil {
-				fmt.Printf("Failed to update payment status for %s: %v\n", session.PaymentID, err)
-			} else {
-				fmt.Printf("Successfully updated payment status for %s to paid\n", session.PaymentID)
-			}
+			s.settleTransfer(ctx, session, bcService, transfer, models.SourceWatcher)
 		}
 
-		// Start monitoring with 30 minute timeout
-		timeout := 30 * time.Minute
-		if err := bcServiceWithWebSocket.StartPaymentMonitoringWithCallback(session.PaymentID, session.TokenSymbol, session.ReceiverAddress, amountWei, timeout, callback); err != nil {
+		// Stop monitoring when the late payment grace window after expiry ends
+		timeout := time.Until(s.latePaymentWindowEnd(session))
+		if timeout <= 0 {
+			timeout = s.config.PaymentTimeout
+		}
+		if err := bcServiceWithWebSocket.StartPaymentMonitoringWithCallback(session.PaymentID, session.TokenSymbol, session.ReceiverAddress, expectedAmount, timeout, callback); err != nil {
 			fmt.Printf("Failed to start WebSocket monitoring for payment %s: %v\n", session.PaymentID, err)
 		} else {
 			fmt.Printf("Started WebSocket monitoring for payment %s to address %s\n", session.PaymentID, session.ReceiverAddress)
@@ -259,19 +499,29 @@ func (s *PaymentService) monitorPayment(ctx context.Context, session *models.Pay
 
 // CreatePaymentRequest represents the request to create a payment session
 type CreatePaymentRequest struct {
+	MerchantID      string  `json:"merchantId"`
 	ProductID       string  `json:"productId"`
 	ProductName     string  `json:"productName"`
-	Amount          float64 `json:"amount"`
+	Amount          string  `json:"amount"` // Decimal amount in whole tokens
 	Currency        string  `json:"currency"`
 	TokenSymbol     string  `json:"tokenSymbol"`
 	NetworkID       string  `json:"networkId"`
 	ReceiverAddress string  `json:"receiverAddress"`
+	MerchantOrderID string  `json:"merchantOrderId"`
+	Metadata        json.RawMessage `json:"metadata"` // JSON object, validated by validateOrderDetails
+	SuccessURL      string  `json:"successUrl"`
+	CancelURL       string  `json:"cancelUrl"`
 }
 
 // ValidatePaymentIfNeeded validates a payment against the blockchain if it's in a pending state
 func (s *PaymentService) ValidatePaymentIfNeeded(ctx context.Context, session *models.PaymentSession) (*models.PaymentSession, error) {
-	// Only validate payments that are created or pending
-	if session.Status != models.PaymentCreated && session.Status != models.PaymentPending {
+	// Only validate payments that are created, pending or still confirming
+	if session.Status != models.PaymentCreated && session.Status != models.PaymentPending && session.Status != models.PaymentConfirming {
+		return session, nil
+	}
+
+	// Sessions credited by the transfer monitor are settled from their recorded transfers
+	if session.AmountReceivedBaseUnits != "" && session.AmountReceivedBaseUnits != "0" {
 		return session, nil
 	}
 
@@ -279,12 +529,18 @@ func (s *PaymentService) ValidatePaymentIfNeeded(ctx context.Context, session *m
 	if session.TransactionHash != nil && *session.TransactionHash != "" {
 		hash := common.HexToHash(*session.TransactionHash)
 
-		// Convert amount to wei for validation
-		amountWei := new(big.Int)
-		amountWei.SetString(fmt.Sprintf("%.0f", session.Amount*1e18), 10)
+		expectedAmount, err := sessionBaseUnits(session)
+		if err != nil {
+			return session, err
+		}
+
+		bcService, err := s.blockchainFor(session.NetworkID)
+		if err != nil {
+			return session, err
+		}
 
 		// Validate payment with the session's receiver address
-		result, err := s.bcService.ValidatePayment(ctx, hash, amountWei, session.TokenSymbol, session.ReceiverAddress)
+		result, err := bcService.ValidatePayment(ctx, hash, expectedAmount, session.TokenSymbol, session.ReceiverAddress)
 		if err != nil {
 			return session, fmt.Errorf("failed to validate payment: %w", err)
 		}
@@ -294,22 +550,34 @@ func (s *PaymentService) ValidatePaymentIfNeeded(ctx context.Context, session *m
 		var senderAddr *string
 		var blockNum *int64
 		var confirmedAt *time.Time
+		change := models.StatusChange{Source: models.SourceClaim}
 
 		if result.Valid {
-			newStatus = models.PaymentPaid
+			change.Reason = fmt.Sprintf("transaction %s validated with %d confirmations", hash.Hex(), result.Confirmations)
+			newStatus = models.PaymentConfirming
 			sender := result.From.Hex()
 			senderAddr = &sender
 			blockNum = new(int64)
 			*blockNum = result.Receipt.BlockNumber.Int64()
-			// Use current time as confirmed time since we don't have it in the result
-			now := time.Now()
-			confirmedAt = &now
+			if result.Confirmations >= bcService.RequiredConfirmations() {
+				newStatus = models.PaymentPaid
+				// Use current time as confirmed time since we don't have it in the result
+				now := time.Now()
+				confirmedAt = &now
+			}
 		} else {
 			newStatus = models.PaymentFailed
+			change.Reason = result.Reason
+			fmt.Printf("Payment %s failed validation: %s\n", session.PaymentID, result.Reason)
+			// Keep the recovered signer so a failed payment can still be traced to its sender
+			if result.TxSender != (common.Address{}) {
+				sender := result.TxSender.Hex()
+				senderAddr = &sender
+			}
 		}
 
 		// Update payment status in database
-		err = s.UpdatePaymentStatus(ctx, session.PaymentID, newStatus, senderAddr, session.TransactionHash, blockNum, confirmedAt)
+		err = s.UpdatePaymentStatus(ctx, session.PaymentID, session.Status, newStatus, change, senderAddr, session.TransactionHash, blockNum, confirmedAt)
 		if err != nil {
 			return session, fmt.Errorf("failed to update payment status: %w", err)
 		}
@@ -327,6 +595,16 @@ func (s *PaymentService) ValidatePaymentIfNeeded(ctx context.Context, session *m
 	return session, nil
 }
 
+// sessionBaseUnits returns the amount a session expects in the token's base units, including any unique offset
+func sessionBaseUnits(session *models.PaymentSession) (*big.Int, error) {
+	_, baseUnits := SessionPayAmount(session)
+	amount, ok := new(big.Int).SetString(baseUnits, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid base unit amount %q for payment %s", baseUnits, session.PaymentID)
+	}
+	return amount, nil
+}
+
 // generatePaymentID generates a unique payment ID
 func generatePaymentID() (string, error) {
 	bytes := make([]byte, 16)
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPaymentTokenTTL is used when no payment token lifetime is configured
+const defaultPaymentTokenTTL = time.Hour
+
+// ErrInvalidPaymentToken is returned when a payment token is malformed, expired or issued for another session
+var ErrInvalidPaymentToken = errors.New("invalid payment token")
+
+// IssuePaymentToken returns a token granting read access to one payment session until it expires.
+// The token is "<expiry unix>.<hex HMAC-SHA256 of paymentID and expiry>", so it can be checked without a lookup.
+func (s *PaymentService) IssuePaymentToken(paymentID string) (string, time.Time) {
+	ttl := s.config.TokenTTL
+	if ttl <= 0 {
+		ttl = defaultPaymentTokenTTL
+	}
+
+	expiresAt := time.Now().UTC().Add(ttl).Truncate(time.Second)
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expiry + "." + s.signPaymentToken(paymentID, expiry), expiresAt
+}
+
+// VerifyPaymentToken checks that a token was issued for a payment session and has not expired
+func (s *PaymentService) VerifyPaymentToken(paymentID, token string) error {
+	expiry, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidPaymentToken
+	}
+
+	expected := s.signPaymentToken(paymentID, expiry)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidPaymentToken
+	}
+
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return ErrInvalidPaymentToken
+	}
+	return nil
+}
+
+// signPaymentToken returns the hex HMAC-SHA256 binding a token expiry to a payment session
+func (s *PaymentService) signPaymentToken(paymentID, expiry string) string {
+	mac := hmac.New(sha256.New, s.config.TokenSecret)
+	mac.Write([]byte(paymentID))
+	mac.Write([]byte("."))
+	mac.Write([]byte(expiry))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyPaymentToken(t *testing.T) {
+	s := NewPaymentService(nil, nil, PaymentConfig{TokenSecret: []byte("test-secret"), TokenTTL: time.Hour})
+	other := NewPaymentService(nil, nil, PaymentConfig{TokenSecret: []byte("other-secret"), TokenTTL: time.Hour})
+
+	token, expiresAt := s.IssuePaymentToken("pay_a")
+	if until := time.Until(expiresAt); until < 59*time.Minute || until > time.Hour {
+		t.Fatalf("token expires in %s, want about an hour", until)
+	}
+	expiry, signature, _ := strings.Cut(token, ".")
+
+	// A correctly signed token whose expiry has passed
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	expired := past + "." + s.signPaymentToken("pay_a", past)
+
+	// A later expiry keeps the signature of the original one
+	later := strconv.FormatInt(time.Now().Add(24*time.Hour).Unix(), 10)
+
+	flipped := []byte(signature)
+	if flipped[0] == 'a' {
+		flipped[0] = 'b'
+	} else {
+		flipped[0] = 'a'
+	}
+
+	otherToken, _ := other.IssuePaymentToken("pay_a")
+
+	tests := []struct {
+		name      string
+		paymentID string
+		token     string
+		wantValid bool
+	}{
+		{"valid", "pay_a", token, true},
+		{"other payment", "pay_b", token, false},
+		{"expired", "pay_a", expired, false},
+		{"extended expiry", "pay_a", later + "." + signature, false},
+		{"tampered signature", "pay_a", expiry + "." + string(flipped), false},
+		{"signed with another secret", "pay_a", otherToken, false},
+		{"missing signature", "pay_a", expiry, false},
+		{"empty", "pay_a", "", false},
+		{"non-numeric expiry", "pay_a", "soon." + s.signPaymentToken("pay_a", "soon"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.VerifyPaymentToken(tt.paymentID, tt.token)
+			if tt.wantValid && err != nil {
+				t.Errorf("VerifyPaymentToken = %v, want nil", err)
+			}
+			if !tt.wantValid && err != ErrInvalidPaymentToken {
+				t.Errorf("VerifyPaymentToken = %v, want ErrInvalidPaymentToken", err)
+			}
+		})
+	}
+}
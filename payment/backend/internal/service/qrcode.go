@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/skip2/go-qrcode"
+
+	"payment-backend/internal/models"
+)
+
+// eip681Scheme prefixes EIP-681 payment request URIs
+const eip681Scheme = "ethereum:"
+
+// Bounds for rendered QR code images, in pixels
+const (
+	defaultQRCodeSize = 256
+	minQRCodeSize     = 128
+	maxQRCodeSize     = 1024
+)
+
+// paymentURI builds an EIP-681 URI requesting an ERC-20 transfer of baseUnits to receiver,
+// e.g. ethereum:<token>@56/transfer?address=<receiver>&uint256=<baseUnits>
+func paymentURI(tokenAddress string, chainID int64, receiver string, baseUnits *big.Int) string {
+	return fmt.Sprintf("%s%s@%d/transfer?address=%s&uint256=%s", eip681Scheme,
+		common.HexToAddress(tokenAddress).Hex(), chainID, common.HexToAddress(receiver).Hex(), baseUnits.String())
+}
+
+// PaymentURI returns the EIP-681 URI a wallet scans to pay a session.
+// Sessions stored before URIs were EIP-681 get one built from the token registry.
+func (s *PaymentService) PaymentURI(ctx context.Context, session *models.PaymentSession) (string, error) {
+	if session.QRCodeData != nil && strings.HasPrefix(*session.QRCodeData, eip681Scheme) {
+		return *session.QRCodeData, nil
+	}
+
+	bcService, err := s.blockchainFor(session.NetworkID)
+	if err != nil {
+		return "", err
+	}
+	token, err := s.repo.GetTokenBySymbol(session.TokenSymbol, session.NetworkID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get token: %w", err)
+	}
+	if token == nil {
+		return "", fmt.Errorf("%w: %s on %s", ErrUnsupportedToken, session.TokenSymbol, session.NetworkID)
+	}
+	payAmount, err := sessionBaseUnits(session)
+	if err != nil {
+		return "", err
+	}
+
+	return paymentURI(token.ContractAddress, bcService.ChainID(), session.ReceiverAddress, payAmount), nil
+}
+
+// RenderPaymentQRCode renders a session's payment URI as a PNG image of the given size
+func (s *PaymentService) RenderPaymentQRCode(ctx context.Context, session *models.PaymentSession, size int) ([]byte, error) {
+	uri, err := s.PaymentURI(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	png, err := qrcode.Encode(uri, qrcode.Medium, clampQRCodeSize(size))
+	if err != nil {
+		return nil, fmt.Errorf("failed to render QR code: %w", err)
+	}
+	return png, nil
+}
+
+// RenderPaymentQRCodeSVG renders a session's payment URI as an SVG image of the given size
+func (s *PaymentService) RenderPaymentQRCodeSVG(ctx context.Context, session *models.PaymentSession, size int) (string, error) {
+	uri, err := s.PaymentURI(ctx, session)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := qrcode.New(uri, qrcode.Medium)
+	if err != nil {
+		return "", fmt.Errorf("failed to render QR code: %w", err)
+	}
+
+	// One unit square per dark module; the bitmap already includes the quiet zone
+	bitmap := code.Bitmap()
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		clampQRCodeSize(size), clampQRCodeSize(size), len(bitmap), len(bitmap))
+	svg.WriteString(`<rect width="100%" height="100%" fill="#ffffff"/><path fill="#000000" d="`)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&svg, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	svg.WriteString(`"/></svg>`)
+	return svg.String(), nil
+}
+
+// clampQRCodeSize bounds a requested image size, using the default when none is given
+func clampQRCodeSize(size int) int {
+	switch {
+	case size <= 0:
+		return defaultQRCodeSize
+	case size < minQRCodeSize:
+		return minQRCodeSize
+	case size > maxQRCodeSize:
+		return maxQRCodeSize
+	}
+	return size
+}
@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+
+	"payment-backend/internal/blockchain"
+	"payment-backend/internal/models"
+	"payment-backend/internal/repository"
+)
+
+const (
+	// defaultRefundVerifyInterval is used when no refund verification interval is configured
+	defaultRefundVerifyInterval = 30 * time.Second
+	// refundVerifyBatch bounds the broadcast refunds checked per pass
+	refundVerifyBatch = 50
+)
+
+// ErrRefundNotFound is returned when a refund does not exist
+var ErrRefundNotFound = errors.New("refund not found")
+
+// ErrRefundNotAllowed is returned when a payment session has nothing that can be refunded
+var ErrRefundNotAllowed = errors.New("payment session cannot be refunded")
+
+// ErrInvalidRefundAmount is returned when a refund amount is not positive or exceeds what is left to refund
+var ErrInvalidRefundAmount = errors.New("invalid refund amount")
+
+// ErrRefundTransactionUsed is returned when a refund transaction was already submitted for another refund
+var ErrRefundTransactionUsed = errors.New("transaction already submitted for another refund")
+
+// ErrRefundStatus is returned when a refund is not in the status an operation requires
+var ErrRefundStatus = errors.New("refund status does not allow this")
+
+// RequestRefund records a merchant's request to return part or all of the funds a closed session received
+// to its payer. Without an amount, everything not yet refunded is requested. Sessions paid from several
+// addresses are rejected, since a single refund cannot return each payer's share.
+func (s *PaymentService) RequestRefund(ctx context.Context, merchantID, paymentID, amount, reason string) (*models.Refund, error) {
+	s.refundMu.Lock()
+	defer s.refundMu.Unlock()
+
+	session, err := s.merchantPaymentSession(merchantID, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if !isFinalStatus(session.Status) {
+		return nil, fmt.Errorf("%w: the session is still %s", ErrRefundNotAllowed, session.Status)
+	}
+	if session.SenderAddress == nil || *session.SenderAddress == "" {
+		return nil, fmt.Errorf("%w: the payer address is unknown", ErrRefundNotAllowed)
+	}
+	senders, _, err := s.senderShares(session)
+	if err != nil {
+		return nil, err
+	}
+	if len(senders) > 1 {
+		return nil, fmt.Errorf("%w: the session was paid from %d addresses", ErrRefundNotAllowed, len(senders))
+	}
+
+	refundable, err := s.refundableBaseUnits(session)
+	if err != nil {
+		return nil, err
+	}
+	if refundable.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: nothing left to refund", ErrRefundNotAllowed)
+	}
+
+	value := refundable
+	if amount != "" {
+		value, err = blockchain.ParseTokenAmount(amount, session.TokenDecimals)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRefundAmount, err)
+		}
+		if value.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: amount must be greater than zero", ErrInvalidRefundAmount)
+		}
+		if value.Cmp(refundable) > 0 {
+			return nil, fmt.Errorf("%w: at most %s %s can be refunded", ErrInvalidRefundAmount,
+				blockchain.FormatTokenAmount(refundable, session.TokenDecimals), session.TokenSymbol)
+		}
+	}
+
+	refundID, err := randomID("rfd_", 8)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refund ID: %w", err)
+	}
+
+	refund := &models.Refund{
+		RefundID:         refundID,
+		PaymentID:        session.PaymentID,
+		MerchantID:       session.MerchantID,
+		Amount:           blockchain.FormatTokenAmount(value, session.TokenDecimals),
+		AmountBaseUnits:  value.String(),
+		TokenSymbol:      session.TokenSymbol,
+		NetworkID:        session.NetworkID,
+		RecipientAddress: *session.SenderAddress,
+		Status:           models.RefundRequested,
+	}
+	if reason = strings.TrimSpace(reason); reason != "" {
+		refund.Reason = &reason
+	}
+	if err := s.repo.CreateRefund(refund); err != nil {
+		return nil, fmt.Errorf("failed to create refund: %w", err)
+	}
+
+	fmt.Printf("Refund %s of %s %s requested for payment %s\n", refund.RefundID, refund.Amount, refund.TokenSymbol, paymentID)
+	return refund, nil
+}
+
+// GetPaymentRefunds retrieves the refunds of one of a merchant's payment sessions
+func (s *PaymentService) GetPaymentRefunds(ctx context.Context, merchantID, paymentID string) ([]*models.Refund, error) {
+	if _, err := s.merchantPaymentSession(merchantID, paymentID); err != nil {
+		return nil, err
+	}
+	refunds, err := s.repo.GetRefundsByPaymentID(paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refunds: %w", err)
+	}
+	return refunds, nil
+}
+
+// GetRefunds retrieves up to limit refunds for operators, newest first, or the oldest in a status when one is given
+func (s *PaymentService) GetRefunds(ctx context.Context, status models.RefundStatus, limit int) ([]*models.Refund, error) {
+	var refunds []*models.Refund
+	var err error
+	if status != "" {
+		refunds, err = s.repo.GetRefundsByStatus(status, limit)
+	} else {
+		refunds, err = s.repo.GetRecentRefunds(limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refunds: %w", err)
+	}
+	return refunds, nil
+}
+
+// ApproveRefund lets an operator approve a requested refund, after which its transaction can be sent
+func (s *PaymentService) ApproveRefund(ctx context.Context, refundID string) (*models.Refund, error) {
+	approved, err := s.repo.ApproveRefund(refundID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to approve refund: %w", err)
+	}
+	return s.refundAfterTransition(refundID, approved)
+}
+
+// RejectRefund lets an operator decline a refund that has no transaction yet
+func (s *PaymentService) RejectRefund(ctx context.Context, refundID, reason string) (*models.Refund, error) {
+	if reason = strings.TrimSpace(reason); reason == "" {
+		reason = "rejected by operator"
+	}
+	rejected, err := s.repo.RejectRefund(refundID, reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reject refund: %w", err)
+	}
+	return s.refundAfterTransition(refundID, rejected)
+}
+
+// SubmitRefundTransaction records the transaction an operator sent for an approved refund and verifies it.
+// A transaction that is not yet mined or confirmed is left to the refund verifier.
+func (s *PaymentService) SubmitRefundTransaction(ctx context.Context, refundID, transactionHash string) (*models.Refund, error) {
+	txHash := common.HexToHash(transactionHash).Hex()
+	submitted, err := s.repo.SetRefundTransaction(refundID, txHash)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return nil, ErrRefundTransactionUsed
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record refund transaction: %w", err)
+	}
+
+	refund, err := s.refundAfterTransition(refundID, submitted)
+	if err != nil {
+		return nil, err
+	}
+
+	s.verifyRefund(ctx, refund)
+	return s.GetRefund(ctx, refundID)
+}
+
+// GetRefund retrieves a refund by ID
+func (s *PaymentService) GetRefund(ctx context.Context, refundID string) (*models.Refund, error) {
+	refund, err := s.repo.GetRefund(refundID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refund: %w", err)
+	}
+	if refund == nil {
+		return nil, ErrRefundNotFound
+	}
+	return refund, nil
+}
+
+// refundAfterTransition returns a refund after a status change, or explains why the change did not apply
+func (s *PaymentService) refundAfterTransition(refundID string, changed bool) (*models.Refund, error) {
+	refund, err := s.repo.GetRefund(refundID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refund: %w", err)
+	}
+	if refund == nil {
+		return nil, ErrRefundNotFound
+	}
+	if !changed {
+		return nil, fmt.Errorf("%w: the refund is %s", ErrRefundStatus, refund.Status)
+	}
+	return refund, nil
+}
+
+// merchantPaymentSession returns a payment session owned by the merchant, reporting other sessions as not found
+func (s *PaymentService) merchantPaymentSession(merchantID, paymentID string) (*models.PaymentSession, error) {
+	session, err := s.repo.GetPaymentSessionByPaymentID(paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment session: %w", err)
+	}
+	if session == nil || session.MerchantID == nil || *session.MerchantID != merchantID {
+		return nil, ErrPaymentNotFound
+	}
+	return session, nil
+}
+
+// refundableBaseUnits returns what a session received less every refund that has not failed
+func (s *PaymentService) refundableBaseUnits(session *models.PaymentSession) (*big.Int, error) {
+	received, ok := new(big.Int).SetString(session.AmountReceivedBaseUnits, 10)
+	if !ok {
+		received = new(big.Int)
+	}
+	// Sessions settled from a single validated transaction before transfers were recorded received the pay amount
+	if received.Sign() == 0 && session.TransactionHash != nil &&
+		(session.Status == models.PaymentPaid || session.Status == models.PaymentOverpaid) {
+		_, payAmountBaseUnits := SessionPayAmount(session)
+		received.SetString(payAmountBaseUnits, 10)
+	}
+
+	refunds, err := s.repo.GetRefundsByPaymentID(session.PaymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refunds: %w", err)
+	}
+	for _, refund := range refunds {
+		if refund.Status == models.RefundFailed {
+			continue
+		}
+		if value, ok := new(big.Int).SetString(refund.AmountBaseUnits, 10); ok {
+			received.Sub(received, value)
+		}
+	}
+	return received, nil
+}
+
+// senderShares totals what each payer address sent to a session from its transfers still in the canonical chain,
+// returning the addresses in the order they first paid
+func (s *PaymentService) senderShares(session *models.PaymentSession) ([]string, map[string]*big.Int, error) {
+	transfers, err := s.repo.GetPaymentTransfers(session.PaymentID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get payment transfers: %w", err)
+	}
+
+	var senders []string
+	shares := make(map[string]*big.Int)
+	for _, transfer := range transfers {
+		if transfer.Removed {
+			continue
+		}
+		value, ok := new(big.Int).SetString(transfer.AmountBaseUnits, 10)
+		if !ok {
+			continue
+		}
+		sender := common.HexToAddress(transfer.SenderAddress).Hex()
+		if shares[sender] == nil {
+			shares[sender] = new(big.Int)
+			senders = append(senders, sender)
+		}
+		shares[sender].Add(shares[sender], value)
+	}
+	return senders, shares, nil
+}
+
+// StartRefundVerifier periodically checks the transactions of broadcast refunds until they are confirmed or fail
+func (s *PaymentService) StartRefundVerifier(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultRefundVerifyInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	fmt.Printf("Started refund verifier (interval %s)\n", interval)
+
+	for {
+		refunds, err := s.repo.GetRefundsByStatus(models.RefundBroadcast, refundVerifyBatch)
+		if err != nil {
+			fmt.Printf("Failed to get broadcast refunds: %v\n", err)
+		}
+		for _, refund := range refunds {
+			s.verifyRefund(ctx, refund)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// verifyRefund checks a broadcast refund's transaction like a payment claim: it must succeed and transfer
+// exactly the refund amount of the session's token from the session's receiver address to the payer, so an
+// unrelated transfer to the payer cannot confirm it. The refund is confirmed once the transaction
+// has the network's required confirmations and failed when the transaction pays something else.
+func (s *PaymentService) verifyRefund(ctx context.Context, refund *models.Refund) {
+	if refund.Status != models.RefundBroadcast || refund.TransactionHash == nil {
+		return
+	}
+
+	bcService, err := s.blockchainFor(refund.NetworkID)
+	if err != nil {
+		fmt.Printf("Cannot verify refund %s: %v\n", refund.RefundID, err)
+		return
+	}
+	amount, ok := new(big.Int).SetString(refund.AmountBaseUnits, 10)
+	if !ok {
+		fmt.Printf("Invalid amount %q on refund %s\n", refund.AmountBaseUnits, refund.RefundID)
+		return
+	}
+	session, err := s.repo.GetPaymentSessionByPaymentID(refund.PaymentID)
+	if err != nil || session == nil {
+		fmt.Printf("Cannot verify refund %s: failed to get payment session: %v\n", refund.RefundID, err)
+		return
+	}
+
+	result, err := bcService.ValidateTransfer(ctx, common.HexToHash(*refund.TransactionHash), amount, refund.TokenSymbol,
+		session.ReceiverAddress, refund.RecipientAddress)
+	if errors.Is(err, ethereum.NotFound) {
+		// Not mined yet
+		return
+	}
+	if err != nil {
+		fmt.Printf("Failed to verify refund %s: %v\n", refund.RefundID, err)
+		return
+	}
+
+	if !result.Valid {
+		if _, err := s.repo.FailRefundTransaction(refund.RefundID, result.Reason); err != nil {
+			fmt.Printf("Failed to mark refund %s failed: %v\n", refund.RefundID, err)
+			return
+		}
+		fmt.Printf("Refund %s failed: transaction %s was rejected (%s)\n", refund.RefundID, *refund.TransactionHash, result.Reason)
+		return
+	}
+
+	if result.Confirmations < bcService.RequiredConfirmations() {
+		return
+	}
+	if _, err := s.repo.ConfirmRefund(refund.RefundID, result.Receipt.BlockNumber.Int64()); err != nil {
+		fmt.Printf("Failed to confirm refund %s: %v\n", refund.RefundID, err)
+		return
+	}
+	fmt.Printf("Refund %s confirmed by transaction %s\n", refund.RefundID, *refund.TransactionHash)
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"payment-backend/internal/blockchain"
+	"payment-backend/internal/models"
+)
+
+// basisPoints is the denominator of PaymentConfig.ToleranceBps
+const basisPoints = 10000
+
+// settleTransfer records a transfer reported for a session and re-derives the session status
+// from the total of every credited transfer. Source is what reported the transfer.
+func (s *PaymentService) settleTransfer(ctx context.Context, session *models.PaymentSession, bcService BlockchainService, transfer *blockchain.TokenTransfer, source models.StatusSource) {
+	s.settleMu.Lock()
+	defer s.settleMu.Unlock()
+
+	record := &models.PaymentTransfer{
+		PaymentID:       session.PaymentID,
+		TransactionHash: transfer.TxHash.Hex(),
+		LogIndex:        transfer.LogIndex,
+		SenderAddress:   transfer.From.Hex(),
+		ReceiverAddress: transfer.To.Hex(),
+		TokenAddress:    transfer.Token.Hex(),
+		AmountBaseUnits: transfer.Value.String(),
+		Confirmations:   transfer.Confirmations,
+		Confirmed:       transfer.Confirmed,
+		Removed:         transfer.Removed,
+	}
+	if transfer.BlockNumber != nil {
+		record.BlockNumber = transfer.BlockNumber.Int64()
+	}
+	if err := s.repo.UpsertPaymentTransfer(record); err != nil {
+		fmt.Printf("Failed to record transfer %s for payment %s: %v\n", record.TransactionHash, session.PaymentID, err)
+		return
+	}
+
+	transfers, err := s.repo.GetPaymentTransfers(session.PaymentID)
+	if err != nil {
+		fmt.Printf("Failed to get transfers for payment %s: %v\n", session.PaymentID, err)
+		return
+	}
+
+	// Total the transfers still in the canonical chain; the latest one is reported on the session
+	received := new(big.Int)
+	unconfirmed := false
+	detectedAt := time.Now().UTC()
+	var latest *models.PaymentTransfer
+	for _, t := range transfers {
+		if t.TransactionHash == record.TransactionHash && t.LogIndex == record.LogIndex {
+			detectedAt = t.CreatedAt
+		}
+		if t.Removed {
+			continue
+		}
+		value, ok := new(big.Int).SetString(t.AmountBaseUnits, 10)
+		if !ok {
+			fmt.Printf("Invalid amount %q on transfer %s for payment %s\n", t.AmountBaseUnits, t.TransactionHash, session.PaymentID)
+			continue
+		}
+		received.Add(received, value)
+		if !t.Confirmed {
+			unconfirmed = true
+		}
+		latest = t
+	}
+
+	if err := s.repo.UpdatePaymentSessionAmountReceived(session.PaymentID, received.String()); err != nil {
+		fmt.Printf("Failed to update amount received for %s: %v\n", session.PaymentID, err)
+		return
+	}
+
+	current, err := s.repo.GetPaymentSessionByPaymentID(session.PaymentID)
+	if err != nil || current == nil {
+		fmt.Printf("Failed to reload payment %s: %v\n", session.PaymentID, err)
+		return
+	}
+	expected, err := sessionBaseUnits(current)
+	if err != nil {
+		fmt.Printf("Failed to settle payment %s: %v\n", session.PaymentID, err)
+		return
+	}
+	status := s.settlementStatus(expected, received, unconfirmed, time.Now().UTC().After(current.ExpiresAt))
+
+	// A closed session keeps its outcome, unless the transfer arrived in its late payment grace window
+	keepWatching := false
+	if isFinalStatus(current.Status) {
+		// Funds sent to a cancelled session go back to the payer once confirmed
+		if current.Status == models.PaymentCancelled && !unconfirmed && latest != nil {
+			s.flagCancelledPayment(current)
+		}
+		lateStatus, ok := s.lateSettlementStatus(current, status, detectedAt)
+		if !ok {
+			fmt.Printf("Recorded transfer %s for closed payment %s (%s)\n", record.TransactionHash, session.PaymentID, current.Status)
+			return
+		}
+		status = lateStatus
+		// A late partial payment may still be completed within the window
+		keepWatching = status == models.PaymentUnderpaid
+	}
+
+	var senderAddr, txHashStr *string
+	var blockNum *int64
+	if latest != nil {
+		senderAddr = &latest.SenderAddress
+		txHashStr = &latest.TransactionHash
+		blockNum = &latest.BlockNumber
+	}
+	var confirmedAt *time.Time
+	if isFinalStatus(status) {
+		now := time.Now()
+		confirmedAt = &now
+	}
+
+	change := models.StatusChange{
+		Reason: fmt.Sprintf("transfer %s: received %s of %s base units", record.TransactionHash, received, expected),
+		Source: source,
+	}
+	if status == models.PaymentUnderpaid {
+		// A fixed reason lets failure stats group underpaid sessions; the transfers record the amounts
+		change.Reason = "received less than the amount due"
+	}
+	if err := s.UpdatePaymentStatus(ctx, session.PaymentID, current.Status, status, change, senderAddr, txHashStr, blockNum, confirmedAt); err != nil {
+		fmt.Printf("Failed to update payment status for %s: %v\n", session.PaymentID, err)
+		return
+	}
+	fmt.Printf("Successfully updated payment status for %s to %s (received %s of %s base units, transfer %s has %d/%d confirmations)\n",
+		session.PaymentID, status, received, expected, record.TransactionHash, transfer.Confirmations, bcService.RequiredConfirmations())
+
+	if isFinalStatus(status) && !keepWatching {
+		bcService.StopPaymentMonitoring(session.PaymentID)
+	}
+
+	current.AmountReceivedBaseUnits = received.String()
+	amountReceived, amountRemaining := AmountReceivedAndRemaining(current)
+	update := &blockchain.PaymentStatusUpdate{
+		PaymentID:       session.PaymentID,
+		Status:          string(status),
+		Token:           session.TokenSymbol,
+		AmountReceived:  amountReceived,
+		AmountRemaining: amountRemaining,
+	}
+	if !transfer.Removed {
+		update.TransactionHash = record.TransactionHash
+		update.BlockNumber = record.BlockNumber
+		update.Confirmations = transfer.Confirmations
+		update.Amount = blockchain.FormatTokenAmount(transfer.Value, session.TokenDecimals)
+	}
+	s.publishStatusUpdate(update)
+}
+
+// failPayment marks a session failed after a monitoring error. A session that settled in the meantime
+// keeps its status, since the state machine does not allow failing it.
+func (s *PaymentService) failPayment(ctx context.Context, paymentID, reason string) {
+	s.settleMu.Lock()
+	defer s.settleMu.Unlock()
+
+	current, err := s.repo.GetPaymentSessionByPaymentID(paymentID)
+	if err != nil || current == nil {
+		fmt.Printf("Failed to reload payment %s: %v\n", paymentID, err)
+		return
+	}
+
+	// The transfer the session already recorded stays on it as evidence of what was received
+	change := models.StatusChange{Reason: reason, Source: models.SourceWatcher}
+	if err := s.UpdatePaymentStatus(ctx, paymentID, current.Status, models.PaymentFailed, change,
+		current.SenderAddress, current.TransactionHash, current.BlockNumber, current.ConfirmedAt); err != nil {
+		fmt.Printf("Payment %s not marked failed: %v\n", paymentID, err)
+	}
+}
+
+// settlementStatus derives a session's status from the amount received against the amount due.
+// Amounts within the configured tolerance of the amount due count as paid.
+func (s *PaymentService) settlementStatus(expected, received *big.Int, unconfirmed, windowClosed bool) models.PaymentStatus {
+	tolerance := new(big.Int).Mul(expected, big.NewInt(int64(s.config.ToleranceBps)))
+	tolerance.Quo(tolerance, big.NewInt(basisPoints))
+	minimum := new(big.Int).Sub(expected, tolerance)
+	maximum := new(big.Int).Add(expected, tolerance)
+
+	switch {
+	case received.Sign() == 0:
+		return models.PaymentPending
+	case unconfirmed:
+		return models.PaymentConfirming
+	case received.Cmp(minimum) < 0:
+		if windowClosed {
+			return models.PaymentUnderpaid
+		}
+		return models.PaymentPending
+	case received.Cmp(maximum) > 0:
+		return models.PaymentOverpaid
+	default:
+		return models.PaymentPaid
+	}
+}
+
+// AmountReceivedAndRemaining returns the decimal amount credited to a session and the amount still due
+func AmountReceivedAndRemaining(session *models.PaymentSession) (string, string) {
+	received, ok := new(big.Int).SetString(session.AmountReceivedBaseUnits, 10)
+	if !ok {
+		received = new(big.Int)
+	}
+	remaining := new(big.Int)
+	if expected, err := sessionBaseUnits(session); err == nil && expected.Cmp(received) > 0 {
+		remaining.Sub(expected, received)
+	}
+	return blockchain.FormatTokenAmount(received, session.TokenDecimals),
+		blockchain.FormatTokenAmount(remaining, session.TokenDecimals)
+}
+
+// isFinalStatus reports whether a session has reached an outcome that transfers no longer change
+func isFinalStatus(status models.PaymentStatus) bool {
+	switch status {
+	case models.PaymentPaid, models.PaymentOverpaid, models.PaymentPaidLate, models.PaymentUnderpaid, models.PaymentExpired, models.PaymentFailed,
+		models.PaymentCancelled:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"payment-backend/internal/models"
+	"payment-backend/internal/repository"
+)
+
+func TestFailPaymentKeepsTransferEvidence(t *testing.T) {
+	repo := repository.NewRepository(openTestDB(t))
+	payments := NewPaymentService(repo, nil, PaymentConfig{})
+
+	session := &models.PaymentSession{
+		PaymentID:       "pay_fail_test",
+		ProductID:       "p",
+		ProductName:     "P",
+		Amount:          "1",
+		AmountBaseUnits: "1000000000000000000",
+		TokenDecimals:   18,
+		Currency:        "USD",
+		TokenSymbol:     "USDT",
+		NetworkID:       "BSC",
+		ReceiverAddress: "0xe27577B0e3920cE35f100f66430de0108cb78a04",
+		Status:          models.PaymentCreated,
+		ExpiresAt:       time.Now().Add(15 * time.Minute),
+	}
+	if err := repo.CreatePaymentSession(session); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	sender := "0x1111111111111111111111111111111111111111"
+	txHash := "0xabc"
+	block := int64(110)
+	updated, err := repo.UpdatePaymentSessionStatus(session.PaymentID, models.PaymentCreated, models.PaymentConfirming,
+		models.StatusChange{Source: "test"}, &sender, &txHash, &block, nil)
+	if err != nil || !updated {
+		t.Fatalf("move to confirming = %v, %v", updated, err)
+	}
+
+	payments.failPayment(context.Background(), session.PaymentID, "monitoring error")
+
+	failed, err := repo.GetPaymentSessionByPaymentID(session.PaymentID)
+	if err != nil || failed == nil {
+		t.Fatalf("reload session: %v", err)
+	}
+	if failed.Status != models.PaymentFailed {
+		t.Fatalf("status = %s, want %s", failed.Status, models.PaymentFailed)
+	}
+	if failed.SenderAddress == nil || *failed.SenderAddress != sender ||
+		failed.TransactionHash == nil || *failed.TransactionHash != txHash ||
+		failed.BlockNumber == nil || *failed.BlockNumber != block {
+		t.Errorf("evidence after failing = %v, %v, %v", failed.SenderAddress, failed.TransactionHash, failed.BlockNumber)
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"payment-backend/internal/models"
+)
+
+// maxStatsBuckets bounds the number of PaymentsByPeriod buckets a stats window may span
+const maxStatsBuckets = 1000
+
+// noMerchantKey keys PaymentsByMerchant for sessions created without a merchant
+const noMerchantKey = "none"
+
+// ErrInvalidStatsRange is returned when a stats window is empty or spans too many buckets, or its granularity is unknown
+var ErrInvalidStatsRange = errors.New("invalid stats range")
+
+// GetPaymentStats computes payment statistics of the sessions created in [from, to) from SQL aggregates over the
+// hourly stats rollup, with PaymentsByPeriod bucketed by granularity. FailureReasons counts failed sessions by the
+// reason recorded in their status history. The window is widened to whole hours.
+// A zero to means now; a zero from means 24 hours before to for hourly buckets and 30 days before to for daily ones.
+func (s *PaymentService) GetPaymentStats(ctx context.Context, from, to time.Time, granularity models.StatsGranularity) (*models.PaymentStats, error) {
+	bucket := 24 * time.Hour
+	switch granularity {
+	case "", models.StatsByDay:
+		granularity = models.StatsByDay
+	case models.StatsByHour:
+		bucket = time.Hour
+	default:
+		return nil, fmt.Errorf("%w: granularity must be hour or day", ErrInvalidStatsRange)
+	}
+
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		if granularity == models.StatsByHour {
+			from = to.Add(-24 * time.Hour)
+		} else {
+			from = to.AddDate(0, 0, -30)
+		}
+	}
+	from = from.UTC().Truncate(time.Hour)
+	if aligned := to.UTC().Truncate(time.Hour); aligned.Before(to) {
+		to = aligned.Add(time.Hour)
+	} else {
+		to = aligned
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidStatsRange)
+	}
+	if to.Sub(from) > maxStatsBuckets*bucket {
+		return nil, fmt.Errorf("%w: the range may span at most %d %s buckets", ErrInvalidStatsRange, maxStatsBuckets, granularity)
+	}
+
+	groups, err := s.repo.GetPaymentStatsGroups(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment stats: %w", err)
+	}
+	periods, err := s.repo.GetPaymentCountsByPeriod(from, to, granularity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payments by period: %w", err)
+	}
+	failureReasons, err := s.repo.GetFailureReasonCounts(from, to, failedOutcomes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get failure reasons: %w", err)
+	}
+
+	stats := &models.PaymentStats{
+		From:               from,
+		To:                 to,
+		Granularity:        granularity,
+		PaymentsByToken:    make(map[string]int),
+		PaymentsByPeriod:   periods,
+		FailureReasons:     failureReasons,
+		PaymentsByMerchant: make(map[string]*models.PaymentBreakdown),
+		PaymentsByNetwork:  make(map[string]*models.PaymentBreakdown),
+	}
+
+	overall := &paymentTally{}
+	merchants := make(map[string]*paymentTally)
+	networks := make(map[string]*paymentTally)
+	for _, group := range groups {
+		stats.PaymentsByToken[group.TokenSymbol] += group.Count
+
+		merchantID := group.MerchantID
+		if merchantID == "" {
+			merchantID = noMerchantKey
+		}
+		overall.add(group)
+		tallyFor(merchants, merchantID).add(group)
+		tallyFor(networks, group.NetworkID).add(group)
+	}
+
+	totals := overall.breakdown()
+	stats.TotalPayments = totals.TotalPayments
+	stats.SuccessfulPayments = totals.SuccessfulPayments
+	stats.FailedPayments = totals.FailedPayments
+	stats.SuccessRate = totals.SuccessRate
+	stats.AverageProcessingTime = totals.AverageProcessingTime
+	for merchantID, tally := range merchants {
+		stats.PaymentsByMerchant[merchantID] = tally.breakdown()
+	}
+	for networkID, tally := range networks {
+		stats.PaymentsByNetwork[networkID] = tally.breakdown()
+	}
+
+	return stats, nil
+}
+
+// paymentTally accumulates payment stats groups into a breakdown
+type paymentTally struct {
+	total             int
+	successful        int
+	failed            int
+	confirmed         int
+	processingSeconds float64
+}
+
+// tallyFor returns the tally of a key, adding an empty one if there is none yet
+func tallyFor(tallies map[string]*paymentTally, key string) *paymentTally {
+	tally, ok := tallies[key]
+	if !ok {
+		tally = &paymentTally{}
+		tallies[key] = tally
+	}
+	return tally
+}
+
+// add counts a group; only successful sessions contribute to the processing time
+func (t *paymentTally) add(group *models.PaymentStatsGroup) {
+	t.total += group.Count
+	switch {
+	case isSuccessfulOutcome(group.Status):
+		t.successful += group.Count
+		t.confirmed += group.ConfirmedCount
+		t.processingSeconds += group.ProcessingSeconds
+	case isFailedOutcome(group.Status):
+		t.failed += group.Count
+	}
+}
+
+// breakdown returns the tally's counts, the share of closed sessions that succeeded and the average processing time
+func (t *paymentTally) breakdown() *models.PaymentBreakdown {
+	breakdown := &models.PaymentBreakdown{
+		TotalPayments:      t.total,
+		SuccessfulPayments: t.successful,
+		FailedPayments:     t.failed,
+	}
+	if closed := t.successful + t.failed; closed > 0 {
+		breakdown.SuccessRate = float64(t.successful) / float64(closed)
+	}
+	if t.confirmed > 0 {
+		breakdown.AverageProcessingTime = t.processingSeconds / float64(t.confirmed)
+	}
+	return breakdown
+}
+
+// isSuccessfulOutcome reports whether a session was paid in full
+func isSuccessfulOutcome(status models.PaymentStatus) bool {
+	return status == models.PaymentPaid || status == models.PaymentOverpaid
+}
+
+// failedOutcomes are the statuses of sessions that closed without being paid in full
+var failedOutcomes = []models.PaymentStatus{models.PaymentExpired, models.PaymentUnderpaid, models.PaymentFailed, models.PaymentCancelled}
+
+// isFailedOutcome reports whether a session closed without being paid in full
+func isFailedOutcome(status models.PaymentStatus) bool {
+	for _, failed := range failedOutcomes {
+		if status == failed {
+			return true
+		}
+	}
+	return false
+}
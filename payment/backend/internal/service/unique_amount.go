@@ -0,0 +1,73 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"payment-backend/internal/blockchain"
+	"payment-backend/internal/models"
+	"payment-backend/internal/repository"
+)
+
+// ErrNoUniqueAmount is returned when every offset of an amount is taken by an open session for the same receiver
+// or one still in its late payment grace window
+var ErrNoUniqueAmount = errors.New("no unique amount available")
+
+// createWithUniqueAmount saves a session whose pay amount is its amount plus the first offset not used
+// by another open session for the same receiver, token and network, or by a session still in its late payment
+// grace window. The database's unique index on open pay amounts decides which offset is free, so concurrent
+// sessions never share one.
+func (s *PaymentService) createWithUniqueAmount(session *models.PaymentSession, amount *big.Int, tokenAddress string, chainID int64) error {
+	step, err := blockchain.ParseTokenAmount(s.config.UniqueAmountStep, session.TokenDecimals)
+	if err != nil || step.Sign() <= 0 {
+		// The step is finer than the token supports; fall back to one base unit
+		step = big.NewInt(1)
+	}
+
+	// Late transfers to these sessions are still matched by amount, so their offsets stay reserved
+	latePayAmounts, err := s.repo.GetLatePaymentWindowPayAmounts(session.ReceiverAddress, session.TokenSymbol,
+		session.NetworkID, time.Now().UTC().Add(-s.config.LatePaymentGrace))
+	if err != nil {
+		return fmt.Errorf("failed to load late payment window amounts: %w", err)
+	}
+
+	for slot := 0; slot < s.config.UniqueAmountSlots; slot++ {
+		payAmount := new(big.Int).Mul(step, big.NewInt(int64(slot)))
+		payAmount.Add(payAmount, amount)
+
+		payAmountBaseUnits := payAmount.String()
+		if latePayAmounts[payAmountBaseUnits] {
+			continue
+		}
+		qrCodeData := paymentURI(tokenAddress, chainID, session.ReceiverAddress, payAmount)
+		session.PayAmountBaseUnits = &payAmountBaseUnits
+		session.QRCodeData = &qrCodeData
+
+		err := s.repo.CreatePaymentSession(session)
+		if errors.Is(err, repository.ErrDuplicate) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create payment session: %w", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: %d open or late-window sessions pay %s %s to %s", ErrNoUniqueAmount, s.config.UniqueAmountSlots,
+		session.Amount, session.TokenSymbol, session.ReceiverAddress)
+}
+
+// SessionPayAmount returns the exact decimal and base unit amount a session must be paid,
+// which is its amount plus any unique offset
+func SessionPayAmount(session *models.PaymentSession) (string, string) {
+	if session.PayAmountBaseUnits == nil {
+		return session.Amount, session.AmountBaseUnits
+	}
+	payAmount, ok := new(big.Int).SetString(*session.PayAmountBaseUnits, 10)
+	if !ok {
+		return session.Amount, session.AmountBaseUnits
+	}
+	return blockchain.FormatTokenAmount(payAmount, session.TokenDecimals), *session.PayAmountBaseUnits
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"payment-backend/internal/models"
+	"payment-backend/internal/repository"
+)
+
+// Headers sent with every webhook request
+const (
+	WebhookIDHeader        = "X-Webhook-Id"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	// defaultWebhookPollInterval is used when no poll interval is configured
+	defaultWebhookPollInterval = 5 * time.Second
+	// webhookBatchSize is the number of due deliveries sent per poll
+	webhookBatchSize = 50
+	// webhookBaseBackoff is the delay before the first retry; each retry doubles it
+	webhookBaseBackoff = 10 * time.Second
+	// webhookMaxBackoff caps the delay between retries
+	webhookMaxBackoff = 6 * time.Hour
+	// webhookResponseLimit is the number of response body bytes kept in the delivery log
+	webhookResponseLimit = 1024
+)
+
+// ErrInvalidWebhookURL is returned when a webhook endpoint URL is not an absolute http(s) URL
+// or its host resolves to an internal address
+var ErrInvalidWebhookURL = errors.New("invalid webhook url")
+
+// errWebhookAddressBlocked is returned by the webhook dialer for an internal address
+var errWebhookAddressBlocked = errors.New("webhook address is not public")
+
+// sharedAddressSpace is the RFC 6598 carrier-grade NAT range, which net.IP does not classify as private
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// ErrWebhookNotFound is returned when a webhook endpoint or delivery does not exist
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// WebhookConfig holds webhook delivery configuration
+type WebhookConfig struct {
+	MaxAttempts int           // Attempts before a delivery is marked failed
+	Timeout     time.Duration // Timeout of each HTTP request
+	// AllowPrivateTargets lets endpoints resolve to loopback, private and link-local addresses.
+	// It is off in production so merchants cannot make the worker call internal services.
+	AllowPrivateTargets bool
+}
+
+// WebhookService delivers payment status events from the outbox to merchant endpoints
+type WebhookService struct {
+	repo   *repository.Repository
+	config WebhookConfig
+	client *http.Client
+}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService(repo *repository.Repository, config WebhookConfig) *WebhookService {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 10
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	if !config.AllowPrivateTargets {
+		// Check the address actually dialled, so a host re-resolving to an internal address after
+		// the endpoint was registered is still refused
+		dialer.Control = func(network, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicAddress(ip) {
+				return fmt.Errorf("%w: %s", errWebhookAddressBlocked, host)
+			}
+			return nil
+		}
+	}
+
+	return &WebhookService{
+		repo:   repo,
+		config: config,
+		client: &http.Client{
+			Timeout: config.Timeout,
+			// No proxy, so the dialer sees the endpoint's own address
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: config.Timeout,
+				MaxIdleConnsPerHost: 2,
+			},
+			// Deliveries go only to the registered URL; a redirect is recorded as a failed attempt
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// CreateEndpoint registers a merchant's webhook endpoint with a new signing secret
+func (s *WebhookService) CreateEndpoint(ctx context.Context, merchantID, endpointURL string) (*models.WebhookEndpoint, error) {
+	parsed, err := url.Parse(endpointURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrInvalidWebhookURL
+	}
+	if !s.config.AllowPrivateTargets {
+		if err := checkPublicHost(ctx, parsed.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	endpoint := &models.WebhookEndpoint{
+		MerchantID: &merchantID,
+		URL:        endpointURL,
+		Secret:     secret,
+		Enabled:    true,
+	}
+	if err := s.repo.CreateWebhookEndpoint(endpoint); err != nil {
+		return nil, fmt.Errorf("failed to create webhook endpoint: %w", err)
+	}
+
+	return endpoint, nil
+}
+
+// GetEndpoints returns the webhook endpoints of a merchant
+func (s *WebhookService) GetEndpoints(ctx context.Context, merchantID string) ([]*models.WebhookEndpoint, error) {
+	return s.repo.GetWebhookEndpoints(merchantID)
+}
+
+// DeleteEndpoint disables a merchant's webhook endpoint; deliveries already queued for it are still attempted
+func (s *WebhookService) DeleteEndpoint(ctx context.Context, merchantID string, id int64) error {
+	found, err := s.repo.DeleteWebhookEndpoint(merchantID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook endpoint: %w", err)
+	}
+	if !found {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// GetDeliveries returns the most recent deliveries of a merchant's endpoint with their attempts
+func (s *WebhookService) GetDeliveries(ctx context.Context, merchantID string, endpointID int64, limit int) ([]*models.WebhookDelivery, map[int64][]*models.WebhookDeliveryAttempt, error) {
+	deliveries, err := s.repo.GetWebhookDeliveries(merchantID, endpointID, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+
+	attempts := make(map[int64][]*models.WebhookDeliveryAttempt, len(deliveries))
+	for _, delivery := range deliveries {
+		deliveryAttempts, err := s.repo.GetWebhookDeliveryAttempts(delivery.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get webhook delivery attempts: %w", err)
+		}
+		attempts[delivery.ID] = deliveryAttempts
+	}
+
+	return deliveries, attempts, nil
+}
+
+// Redeliver queues a delivery to a merchant's endpoint for a new round of attempts, whatever its current status
+func (s *WebhookService) Redeliver(ctx context.Context, merchantID string, deliveryID int64) (*models.WebhookDelivery, error) {
+	found, err := s.repo.RedeliverWebhook(merchantID, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeliver webhook: %w", err)
+	}
+	if !found {
+		return nil, ErrWebhookNotFound
+	}
+
+	return s.repo.GetWebhookDelivery(deliveryID)
+}
+
+// StartWebhookWorker periodically sends due deliveries from the outbox
+func (s *WebhookService) StartWebhookWorker(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultWebhookPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	fmt.Printf("Started webhook worker (interval %s, max attempts %d)\n", interval, s.config.MaxAttempts)
+
+	for {
+		s.sendDueDeliveries(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sendDueDeliveries attempts every delivery whose next attempt is due
+func (s *WebhookService) sendDueDeliveries(ctx context.Context) {
+	deliveries, err := s.repo.GetDueWebhookDeliveries(time.Now().UTC(), webhookBatchSize)
+	if err != nil {
+		fmt.Printf("Failed to get due webhook deliveries: %v\n", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		s.deliver(ctx, delivery)
+	}
+}
+
+// deliver makes one attempt at a delivery and records its outcome, scheduling a retry on failure
+func (s *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	attempt := &models.WebhookDeliveryAttempt{
+		DeliveryID: delivery.ID,
+		Attempt:    delivery.Attempts + 1,
+	}
+
+	start := time.Now()
+	statusCode, body, err := s.post(ctx, delivery)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if statusCode > 0 {
+		attempt.StatusCode = &statusCode
+		attempt.ResponseBody = &body
+	}
+	if err == nil && (statusCode < 200 || statusCode >= 300) {
+		err = fmt.Errorf("endpoint responded with status %d", statusCode)
+	}
+
+	status := models.WebhookDeliverySucceeded
+	var nextAttemptAt *time.Time
+	if err != nil {
+		message := err.Error()
+		attempt.Error = &message
+
+		status = models.WebhookDeliveryFailed
+		if attempt.Attempt < s.config.MaxAttempts {
+			status = models.WebhookDeliveryPending
+			next := time.Now().UTC().Add(webhookBackoff(attempt.Attempt))
+			nextAttemptAt = &next
+		}
+		fmt.Printf("Webhook delivery %d (%s) to %s failed on attempt %d/%d: %v\n",
+			delivery.ID, delivery.EventID, delivery.URL, attempt.Attempt, s.config.MaxAttempts, err)
+	} else {
+		fmt.Printf("Webhook delivery %d (%s) to %s succeeded on attempt %d\n",
+			delivery.ID, delivery.EventID, delivery.URL, attempt.Attempt)
+	}
+
+	if err := s.repo.RecordWebhookAttempt(attempt, status, nextAttemptAt); err != nil {
+		fmt.Printf("Failed to record webhook attempt for delivery %d: %v\n", delivery.ID, err)
+	}
+}
+
+// post sends a signed delivery and returns the response status and the start of its body
+func (s *WebhookService) post(ctx context.Context, delivery *models.WebhookDelivery) (int, string, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	payload := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, delivery.EventID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "t="+timestamp+",v1="+SignWebhookPayload(delivery.Secret, timestamp, payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	return resp.StatusCode, string(body), nil
+}
+
+// checkPublicHost resolves a webhook host and rejects it unless every address it resolves to is public
+func checkPublicHost(ctx context.Context, host string) error {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return fmt.Errorf("%w: cannot resolve %s: %v", ErrInvalidWebhookURL, host, err)
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	for _, ip := range ips {
+		if !isPublicAddress(ip) {
+			return fmt.Errorf("%w: %s resolves to the internal address %s", ErrInvalidWebhookURL, host, ip)
+		}
+	}
+	return nil
+}
+
+// isPublicAddress reports whether an IP is not loopback, private, link-local, multicast, unspecified or shared NAT space
+func isPublicAddress(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || sharedAddressSpace.Contains(ip))
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 of "<timestamp>.<payload>" keyed with the endpoint secret.
+// Receivers recompute it from the X-Webhook-Timestamp header and the raw body.
+func SignWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns the delay before the attempt following attempt, doubling from webhookBaseBackoff
+func webhookBackoff(attempt int) time.Duration {
+	delay := webhookBaseBackoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return delay
+}
+
+// generateWebhookSecret generates a random endpoint signing secret
+func generateWebhookSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(key), nil
+}
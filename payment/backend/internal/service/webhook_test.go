@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"payment-backend/internal/models"
+	"payment-backend/internal/repository"
+)
+
+// openTestDB creates a sqlite database with the schema built from the Up sections of migrations/
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("find migrations: %v", err)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		up := string(content)
+		if i := strings.Index(up, "-- +goose Up"); i >= 0 {
+			up = up[i:]
+		}
+		if i := strings.Index(up, "-- +goose Down"); i >= 0 {
+			up = up[:i]
+		}
+		if _, err := db.Exec(up); err != nil {
+			t.Fatalf("apply %s: %v", filepath.Base(file), err)
+		}
+	}
+
+	return db
+}
+
+// webhookReceiver records the requests made to an httptest endpoint and answers with a settable status
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+func (r *webhookReceiver) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func (r *webhookReceiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func (r *webhookReceiver) last() (*http.Request, []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests[len(r.requests)-1], r.bodies[len(r.bodies)-1]
+}
+
+// queueWebhookDelivery registers an endpoint at url for a merchant and cancels one of its sessions,
+// which writes a payment.cancelled event to the outbox
+func queueWebhookDelivery(t *testing.T, repo *repository.Repository, webhooks *WebhookService, url string) (*models.WebhookEndpoint, *models.WebhookDelivery) {
+	t.Helper()
+
+	endpoint, err := webhooks.CreateEndpoint(context.Background(), "mch_test", url)
+	if err != nil {
+		t.Fatalf("create endpoint: %v", err)
+	}
+	return endpoint, queueDeliveryTo(t, repo, endpoint)
+}
+
+// queueDeliveryTo cancels a session of the endpoint's merchant and returns the delivery queued for the endpoint
+func queueDeliveryTo(t *testing.T, repo *repository.Repository, endpoint *models.WebhookEndpoint) *models.WebhookDelivery {
+	t.Helper()
+
+	merchantID := *endpoint.MerchantID
+	session := &models.PaymentSession{
+		PaymentID:       "pay_webhook_test",
+		MerchantID:      &merchantID,
+		ProductID:       "p",
+		ProductName:     "P",
+		Amount:          "1",
+		AmountBaseUnits: "1000000000000000000",
+		TokenDecimals:   18,
+		Currency:        "USD",
+		TokenSymbol:     "USDT",
+		NetworkID:       "BSC",
+		ReceiverAddress: "0xe27577B0e3920cE35f100f66430de0108cb78a04",
+		Status:          models.PaymentCreated,
+		ExpiresAt:       time.Now().Add(15 * time.Minute),
+	}
+	if err := repo.CreatePaymentSession(session); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	cancelled, err := repo.CancelPaymentSession(session.PaymentID, models.StatusChange{Source: "test"})
+	if err != nil || !cancelled {
+		t.Fatalf("cancel session: %v, %v", cancelled, err)
+	}
+
+	deliveries, err := repo.GetWebhookDeliveries(merchantID, endpoint.ID, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("expected one queued delivery, got %d (%v)", len(deliveries), err)
+	}
+	return deliveries[0]
+}
+
+func getDelivery(t *testing.T, repo *repository.Repository, id int64) *models.WebhookDelivery {
+	t.Helper()
+	delivery, err := repo.GetWebhookDelivery(id)
+	if err != nil || delivery == nil {
+		t.Fatalf("get delivery %d: %v", id, err)
+	}
+	return delivery
+}
+
+// makeDue moves a pending delivery's next attempt into the past so the next poll sends it
+func makeDue(t *testing.T, db *sql.DB, id int64) {
+	t.Helper()
+	if _, err := db.Exec(`UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ?`, time.Now().UTC().Add(-time.Second), id); err != nil {
+		t.Fatalf("make delivery due: %v", err)
+	}
+}
+
+func TestWebhookDeliverySignatureRetryAndRedelivery(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewRepository(db)
+	webhooks := NewWebhookService(repo, WebhookConfig{MaxAttempts: 3, Timeout: 5 * time.Second, AllowPrivateTargets: true})
+	ctx := context.Background()
+
+	receiver := &webhookReceiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	endpoint, delivery := queueWebhookDelivery(t, repo, webhooks, server.URL)
+	if delivery.Status != models.WebhookDeliveryPending {
+		t.Fatalf("queued delivery status = %s, want pending", delivery.Status)
+	}
+
+	// First attempt: signed request, 500 schedules a retry after the base backoff
+	start := time.Now().UTC()
+	webhooks.sendDueDeliveries(ctx)
+	if receiver.count() != 1 {
+		t.Fatalf("expected 1 request, got %d", receiver.count())
+	}
+
+	req, body := receiver.last()
+	timestamp := req.Header.Get(WebhookTimestampHeader)
+	if timestamp == "" {
+		t.Fatal("missing timestamp header")
+	}
+	wantSignature := "t=" + timestamp + ",v1=" + SignWebhookPayload(endpoint.Secret, timestamp, body)
+	if got := req.Header.Get(WebhookSignatureHeader); got != wantSignature {
+		t.Errorf("signature header = %q, want %q", got, wantSignature)
+	}
+	if got := req.Header.Get(WebhookIDHeader); got != delivery.EventID {
+		t.Errorf("event id header = %q, want %q", got, delivery.EventID)
+	}
+	if string(body) != delivery.Payload {
+		t.Errorf("body = %s, want the event payload %s", body, delivery.Payload)
+	}
+
+	checkRetry := func(attempts int, backoff time.Duration, since time.Time) {
+		t.Helper()
+		d := getDelivery(t, repo, delivery.ID)
+		if d.Status != models.WebhookDeliveryPending || d.Attempts != attempts {
+			t.Fatalf("after attempt %d: status %s, attempts %d", attempts, d.Status, d.Attempts)
+		}
+		if d.LastStatusCode == nil || *d.LastStatusCode != http.StatusInternalServerError {
+			t.Errorf("after attempt %d: last status code = %v, want 500", attempts, d.LastStatusCode)
+		}
+		if d.NextAttemptAt == nil {
+			t.Fatalf("after attempt %d: next_attempt_at not set", attempts)
+		}
+		low, high := since.Add(backoff), time.Now().UTC().Add(backoff)
+		if d.NextAttemptAt.Before(low.Add(-time.Second)) || d.NextAttemptAt.After(high.Add(time.Second)) {
+			t.Errorf("after attempt %d: next_attempt_at = %s, want about %s after the attempt", attempts, d.NextAttemptAt, backoff)
+		}
+	}
+	checkRetry(1, webhookBaseBackoff, start)
+
+	// Not due yet: nothing is sent
+	webhooks.sendDueDeliveries(ctx)
+	if receiver.count() != 1 {
+		t.Fatalf("delivery sent before its next attempt: %d requests", receiver.count())
+	}
+
+	// Second attempt doubles the backoff
+	makeDue(t, db, delivery.ID)
+	start = time.Now().UTC()
+	webhooks.sendDueDeliveries(ctx)
+	checkRetry(2, 2*webhookBaseBackoff, start)
+
+	// The last allowed attempt marks the delivery failed with no further attempt
+	makeDue(t, db, delivery.ID)
+	webhooks.sendDueDeliveries(ctx)
+	d := getDelivery(t, repo, delivery.ID)
+	if d.Status != models.WebhookDeliveryFailed || d.Attempts != 3 || d.NextAttemptAt != nil {
+		t.Fatalf("after max attempts: status %s, attempts %d, next %v", d.Status, d.Attempts, d.NextAttemptAt)
+	}
+	webhooks.sendDueDeliveries(ctx)
+	if receiver.count() != 3 {
+		t.Fatalf("failed delivery was retried: %d requests", receiver.count())
+	}
+
+	attempts, err := repo.GetWebhookDeliveryAttempts(delivery.ID)
+	if err != nil || len(attempts) != 3 {
+		t.Fatalf("expected 3 recorded attempts, got %d (%v)", len(attempts), err)
+	}
+
+	// Redelivery queues a new round that succeeds once the endpoint recovers
+	receiver.setStatus(http.StatusOK)
+	redelivered, err := webhooks.Redeliver(ctx, "mch_test", delivery.ID)
+	if err != nil {
+		t.Fatalf("redeliver: %v", err)
+	}
+	if redelivered.Status != models.WebhookDeliveryPending {
+		t.Fatalf("redelivered status = %s, want pending", redelivered.Status)
+	}
+	if _, err := webhooks.Redeliver(ctx, "mch_other", delivery.ID); err != ErrWebhookNotFound {
+		t.Errorf("redeliver for another merchant: err = %v, want ErrWebhookNotFound", err)
+	}
+
+	webhooks.sendDueDeliveries(ctx)
+	if receiver.count() != 4 {
+		t.Fatalf("expected redelivery request, got %d requests", receiver.count())
+	}
+	d = getDelivery(t, repo, delivery.ID)
+	if d.Status != models.WebhookDeliverySucceeded || d.DeliveredAt == nil {
+		t.Fatalf("after redelivery: status %s, delivered at %v", d.Status, d.DeliveredAt)
+	}
+}
+
+func TestWebhookDeliveryDoesNotFollowRedirects(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewRepository(db)
+	webhooks := NewWebhookService(repo, WebhookConfig{MaxAttempts: 3, Timeout: 5 * time.Second, AllowPrivateTargets: true})
+
+	target := &webhookReceiver{status: http.StatusOK}
+	targetServer := httptest.NewServer(target)
+	defer targetServer.Close()
+
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, targetServer.URL, http.StatusTemporaryRedirect)
+	}))
+	defer redirector.Close()
+
+	_, delivery := queueWebhookDelivery(t, repo, webhooks, redirector.URL)
+	webhooks.sendDueDeliveries(context.Background())
+
+	if target.count() != 0 {
+		t.Fatalf("redirect was followed: %d requests reached the target", target.count())
+	}
+	d := getDelivery(t, repo, delivery.ID)
+	if d.Status != models.WebhookDeliveryPending || d.LastStatusCode == nil || *d.LastStatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("redirect response: status %s, last status code %v", d.Status, d.LastStatusCode)
+	}
+}
+
+func TestWebhookEndpointsMustBePublic(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewRepository(db)
+	webhooks := NewWebhookService(repo, WebhookConfig{MaxAttempts: 3, Timeout: 5 * time.Second})
+	ctx := context.Background()
+
+	rejected := []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://10.1.2.3/hook",
+		"http://192.168.0.10/hook",
+		"http://172.16.5.4/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://100.64.0.1/hook",
+		"http://0.0.0.0/hook",
+		"http://[::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://[fd00::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"ftp://example.com/hook",
+	}
+	for _, url := range rejected {
+		if _, err := webhooks.CreateEndpoint(ctx, "mch_test", url); !errors.Is(err, ErrInvalidWebhookURL) {
+			t.Errorf("CreateEndpoint(%s) error = %v, want ErrInvalidWebhookURL", url, err)
+		}
+	}
+
+	if _, err := webhooks.CreateEndpoint(ctx, "mch_test", "https://93.184.216.34/hook"); err != nil {
+		t.Errorf("CreateEndpoint with a public address: %v", err)
+	}
+
+	// An endpoint whose host later resolves to an internal address is refused when dialled
+	receiver := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	merchantID := "mch_rebind"
+	endpoint := &models.WebhookEndpoint{MerchantID: &merchantID, URL: server.URL, Secret: "whsec_test", Enabled: true}
+	if err := repo.CreateWebhookEndpoint(endpoint); err != nil {
+		t.Fatalf("create endpoint: %v", err)
+	}
+	delivery := queueDeliveryTo(t, repo, endpoint)
+
+	webhooks.sendDueDeliveries(ctx)
+	if receiver.count() != 0 {
+		t.Fatalf("internal endpoint was called %d times", receiver.count())
+	}
+	d := getDelivery(t, repo, delivery.ID)
+	if d.Status != models.WebhookDeliveryPending || d.LastError == nil || !strings.Contains(*d.LastError, errWebhookAddressBlocked.Error()) {
+		t.Fatalf("blocked delivery: status %s, last error %v", d.Status, d.LastError)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, 80 * time.Second},
+		{12, 20480 * time.Second},
+		{13, webhookMaxBackoff},
+		{100, webhookMaxBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempt); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Chain head at session creation, used to backfill transfers missed while the service was down
+ALTER TABLE payment_sessions ADD COLUMN start_block INTEGER;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE payment_sessions DROP COLUMN start_block;
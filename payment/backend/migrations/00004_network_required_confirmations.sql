@@ -0,0 +1,10 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Block depth at which a detected transfer counts as paid
+ALTER TABLE networks ADD COLUMN required_confirmations INTEGER NOT NULL DEFAULT 12;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE networks DROP COLUMN required_confirmations;
@@ -0,0 +1,108 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Store amounts as decimal strings plus integer base units instead of REAL.
+-- Base units are built from the plain decimal form of the old amount, as the Go migration does with
+-- FormatFloat('f'); CAST(amount AS TEXT) would give exponent forms such as 1.0e-05.
+-- printf keeps 16 significant digits, so no float noise leaks in; digits beyond the token's decimals are dropped.
+ALTER TABLE payment_sessions RENAME TO payment_sessions_legacy;
+
+CREATE TABLE payment_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    payment_id TEXT UNIQUE NOT NULL,
+    product_id TEXT NOT NULL,
+    product_name TEXT NOT NULL,
+    amount TEXT NOT NULL,
+    amount_base_units TEXT NOT NULL,
+    token_decimals INTEGER NOT NULL,
+    currency TEXT NOT NULL,
+    token_symbol TEXT NOT NULL,
+    network_id TEXT NOT NULL,
+    receiver_address TEXT NOT NULL,
+    sender_address TEXT,
+    status TEXT NOT NULL,
+    qr_code_data TEXT,
+    transaction_hash TEXT,
+    block_number INTEGER,
+    start_block INTEGER,
+    confirmed_at DATETIME,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO payment_sessions (
+    id, payment_id, product_id, product_name, amount, amount_base_units, token_decimals,
+    currency, token_symbol, network_id, receiver_address, sender_address, status, qr_code_data,
+    transaction_hash, block_number, start_block, confirmed_at, expires_at, created_at, updated_at
+)
+SELECT
+    id, payment_id, product_id, product_name,
+    CASE WHEN frac_part = '' THEN int_part ELSE int_part || '.' || frac_part END,
+    COALESCE(NULLIF(ltrim(int_part || substr(frac_part || '000000000000000000000000000000', 1, decimals), '0'), ''), '0'),
+    decimals,
+    currency, token_symbol, network_id, receiver_address, sender_address, status, qr_code_data,
+    transaction_hash, block_number, start_block, confirmed_at, expires_at, created_at, updated_at
+FROM (
+    SELECT s.*, d.decimals,
+        CASE WHEN instr(d.amount_text, '.') > 0 THEN substr(d.amount_text, 1, instr(d.amount_text, '.') - 1) ELSE d.amount_text END AS int_part,
+        CASE WHEN instr(d.amount_text, '.') > 0
+            THEN rtrim(substr(substr(d.amount_text, instr(d.amount_text, '.') + 1), 1, d.decimals), '0')
+            ELSE '' END AS frac_part
+    FROM payment_sessions_legacy s
+    JOIN (
+        SELECT l.id AS session_id, printf('%.30f', l.amount) AS amount_text, COALESCE(t.decimals, 18) AS decimals
+        FROM payment_sessions_legacy l
+        LEFT JOIN tokens t ON t.symbol = l.token_symbol AND t.network_id = l.network_id
+    ) d ON d.session_id = s.id
+);
+
+DROP TABLE payment_sessions_legacy;
+
+CREATE INDEX idx_payment_sessions_payment_id ON payment_sessions(payment_id);
+CREATE INDEX idx_payment_sessions_status ON payment_sessions(status);
+CREATE INDEX idx_payment_sessions_expires_at ON payment_sessions(expires_at);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE payment_sessions RENAME TO payment_sessions_exact;
+
+CREATE TABLE payment_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    payment_id TEXT UNIQUE NOT NULL,
+    product_id TEXT NOT NULL,
+    product_name TEXT NOT NULL,
+    amount REAL NOT NULL,
+    currency TEXT NOT NULL,
+    token_symbol TEXT NOT NULL,
+    network_id TEXT NOT NULL,
+    receiver_address TEXT NOT NULL,
+    sender_address TEXT,
+    status TEXT NOT NULL,
+    qr_code_data TEXT,
+    transaction_hash TEXT,
+    block_number INTEGER,
+    start_block INTEGER,
+    confirmed_at DATETIME,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO payment_sessions (
+    id, payment_id, product_id, product_name, amount, currency, token_symbol, network_id,
+    receiver_address, sender_address, status, qr_code_data, transaction_hash, block_number,
+    start_block, confirmed_at, expires_at, created_at, updated_at
+)
+SELECT
+    id, payment_id, product_id, product_name, CAST(amount AS REAL), currency, token_symbol, network_id,
+    receiver_address, sender_address, status, qr_code_data, transaction_hash, block_number,
+    start_block, confirmed_at, expires_at, created_at, updated_at
+FROM payment_sessions_exact;
+
+DROP TABLE payment_sessions_exact;
+
+CREATE INDEX idx_payment_sessions_payment_id ON payment_sessions(payment_id);
+CREATE INDEX idx_payment_sessions_status ON payment_sessions(status);
+CREATE INDEX idx_payment_sessions_expires_at ON payment_sessions(expires_at);
@@ -0,0 +1,52 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- A token symbol is unique per network, so USDT can be configured on several chains
+ALTER TABLE tokens RENAME TO tokens_legacy;
+
+CREATE TABLE tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol TEXT NOT NULL,
+    name TEXT NOT NULL,
+    contract_address TEXT NOT NULL,
+    decimals INTEGER NOT NULL,
+    network_id TEXT NOT NULL,
+    enabled BOOLEAN DEFAULT TRUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(symbol, network_id)
+);
+
+INSERT INTO tokens (id, symbol, name, contract_address, decimals, network_id, enabled, created_at, updated_at)
+SELECT id, symbol, name, contract_address, decimals, network_id, enabled, created_at, updated_at FROM tokens_legacy;
+
+DROP TABLE tokens_legacy;
+
+CREATE INDEX idx_tokens_symbol ON tokens(symbol);
+CREATE INDEX idx_tokens_network_id ON tokens(network_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE tokens RENAME TO tokens_per_network;
+
+CREATE TABLE tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol TEXT UNIQUE NOT NULL,
+    name TEXT NOT NULL,
+    contract_address TEXT NOT NULL,
+    decimals INTEGER NOT NULL,
+    network_id TEXT NOT NULL,
+    enabled BOOLEAN DEFAULT TRUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Only the first network's row of each symbol survives the rollback
+INSERT OR IGNORE INTO tokens (id, symbol, name, contract_address, decimals, network_id, enabled, created_at, updated_at)
+SELECT id, symbol, name, contract_address, decimals, network_id, enabled, created_at, updated_at FROM tokens_per_network ORDER BY id;
+
+DROP TABLE tokens_per_network;
+
+CREATE INDEX idx_tokens_symbol ON tokens(symbol);
+CREATE INDEX idx_tokens_network_id ON tokens(network_id);
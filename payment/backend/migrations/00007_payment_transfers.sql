@@ -0,0 +1,30 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Total of the transfers credited to a session, in token base units
+ALTER TABLE payment_sessions ADD COLUMN amount_received_base_units TEXT NOT NULL DEFAULT '0';
+
+-- Every on-chain transfer credited to a session
+CREATE TABLE IF NOT EXISTS payment_transfers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    payment_id TEXT NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    sender_address TEXT NOT NULL,
+    amount_base_units TEXT NOT NULL,
+    block_number INTEGER NOT NULL,
+    confirmations INTEGER NOT NULL DEFAULT 0,
+    confirmed BOOLEAN NOT NULL DEFAULT FALSE,
+    removed BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(payment_id, transaction_hash, log_index)
+);
+
+CREATE INDEX idx_payment_transfers_payment_id ON payment_transfers(payment_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS payment_transfers;
+ALTER TABLE payment_sessions DROP COLUMN amount_received_base_units;
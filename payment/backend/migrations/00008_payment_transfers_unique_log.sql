@@ -0,0 +1,74 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- A Transfer log credits at most one session; record its receiver and token contract for audits
+ALTER TABLE payment_transfers RENAME TO payment_transfers_legacy;
+DROP INDEX IF EXISTS idx_payment_transfers_payment_id;
+
+CREATE TABLE payment_transfers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    payment_id TEXT NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    sender_address TEXT NOT NULL,
+    receiver_address TEXT NOT NULL,
+    token_address TEXT NOT NULL,
+    amount_base_units TEXT NOT NULL,
+    block_number INTEGER NOT NULL,
+    confirmations INTEGER NOT NULL DEFAULT 0,
+    confirmed BOOLEAN NOT NULL DEFAULT FALSE,
+    removed BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(transaction_hash, log_index)
+);
+
+INSERT OR IGNORE INTO payment_transfers (
+    id, payment_id, transaction_hash, log_index, sender_address, receiver_address, token_address,
+    amount_base_units, block_number, confirmations, confirmed, removed, created_at, updated_at
+)
+SELECT t.id, t.payment_id, t.transaction_hash, t.log_index, t.sender_address, ps.receiver_address,
+       COALESCE(tk.contract_address, ''), t.amount_base_units, t.block_number, t.confirmations,
+       t.confirmed, t.removed, t.created_at, t.updated_at
+FROM payment_transfers_legacy t
+JOIN payment_sessions ps ON ps.payment_id = t.payment_id
+LEFT JOIN tokens tk ON tk.symbol = ps.token_symbol AND tk.network_id = ps.network_id
+ORDER BY t.id;
+
+DROP TABLE payment_transfers_legacy;
+
+CREATE INDEX idx_payment_transfers_payment_id ON payment_transfers(payment_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE payment_transfers RENAME TO payment_transfers_unique_log;
+DROP INDEX IF EXISTS idx_payment_transfers_payment_id;
+
+CREATE TABLE payment_transfers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    payment_id TEXT NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    sender_address TEXT NOT NULL,
+    amount_base_units TEXT NOT NULL,
+    block_number INTEGER NOT NULL,
+    confirmations INTEGER NOT NULL DEFAULT 0,
+    confirmed BOOLEAN NOT NULL DEFAULT FALSE,
+    removed BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(payment_id, transaction_hash, log_index)
+);
+
+INSERT INTO payment_transfers (
+    id, payment_id, transaction_hash, log_index, sender_address, amount_base_units,
+    block_number, confirmations, confirmed, removed, created_at, updated_at
+)
+SELECT id, payment_id, transaction_hash, log_index, sender_address, amount_base_units,
+       block_number, confirmations, confirmed, removed, created_at, updated_at
+FROM payment_transfers_unique_log;
+
+DROP TABLE payment_transfers_unique_log;
+
+CREATE INDEX idx_payment_transfers_payment_id ON payment_transfers(payment_id);
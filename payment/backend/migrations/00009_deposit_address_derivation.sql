@@ -0,0 +1,18 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Child index of a receiver address derived from the configured extended public key
+ALTER TABLE payment_sessions ADD COLUMN derivation_index INTEGER;
+
+-- Next unused child index per extended public key, so a derived address is never reused
+CREATE TABLE IF NOT EXISTS deposit_key_indexes (
+    xpub TEXT PRIMARY KEY,
+    next_index INTEGER NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS deposit_key_indexes;
+ALTER TABLE payment_sessions DROP COLUMN derivation_index;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Amount plus a unique offset, set when unique amounts are enabled
+ALTER TABLE payment_sessions ADD COLUMN pay_amount_base_units TEXT;
+
+-- No two open sessions for the same receiver, token and network share a pay amount
+CREATE UNIQUE INDEX idx_payment_sessions_open_pay_amount
+ON payment_sessions(lower(receiver_address), token_symbol, network_id, pay_amount_base_units)
+WHERE pay_amount_base_units IS NOT NULL AND status IN ('created', 'pending', 'confirming');
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_payment_sessions_open_pay_amount;
+ALTER TABLE payment_sessions DROP COLUMN pay_amount_base_units;
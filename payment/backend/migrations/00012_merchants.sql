@@ -0,0 +1,30 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- API clients; only a SHA-256 hash of each API key is stored
+CREATE TABLE IF NOT EXISTS merchants (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    merchant_id TEXT UNIQUE NOT NULL,
+    name TEXT NOT NULL,
+    api_key_prefix TEXT NOT NULL,
+    api_key_hash TEXT UNIQUE NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Sessions and webhook endpoints belong to the merchant that created them
+ALTER TABLE payment_sessions ADD COLUMN merchant_id TEXT;
+ALTER TABLE webhook_endpoints ADD COLUMN merchant_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_payment_sessions_merchant_id ON payment_sessions(merchant_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_endpoints_merchant_id ON webhook_endpoints(merchant_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_webhook_endpoints_merchant_id;
+DROP INDEX IF EXISTS idx_payment_sessions_merchant_id;
+ALTER TABLE webhook_endpoints DROP COLUMN merchant_id;
+ALTER TABLE payment_sessions DROP COLUMN merchant_id;
+DROP TABLE IF EXISTS merchants;
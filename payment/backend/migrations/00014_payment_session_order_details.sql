@@ -0,0 +1,21 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Links a session to the merchant's own order and where to send the customer afterwards
+ALTER TABLE payment_sessions ADD COLUMN merchant_order_id TEXT;
+ALTER TABLE payment_sessions ADD COLUMN metadata TEXT;
+ALTER TABLE payment_sessions ADD COLUMN success_url TEXT;
+ALTER TABLE payment_sessions ADD COLUMN cancel_url TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_sessions_merchant_order_id
+ON payment_sessions(merchant_id, merchant_order_id)
+WHERE merchant_order_id IS NOT NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_payment_sessions_merchant_order_id;
+ALTER TABLE payment_sessions DROP COLUMN cancel_url;
+ALTER TABLE payment_sessions DROP COLUMN success_url;
+ALTER TABLE payment_sessions DROP COLUMN metadata;
+ALTER TABLE payment_sessions DROP COLUMN merchant_order_id;
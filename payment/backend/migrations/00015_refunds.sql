@@ -0,0 +1,37 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Funds returned to the payer of a session: requested by the merchant, approved by an operator,
+-- then verified on chain from the transaction the operator submits
+CREATE TABLE IF NOT EXISTS refunds (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    refund_id TEXT UNIQUE NOT NULL,
+    payment_id TEXT NOT NULL,
+    merchant_id TEXT,
+    amount TEXT NOT NULL,
+    amount_base_units TEXT NOT NULL,
+    token_symbol TEXT NOT NULL,
+    network_id TEXT NOT NULL,
+    recipient_address TEXT NOT NULL,
+    reason TEXT,
+    status TEXT NOT NULL,
+    transaction_hash TEXT,
+    block_number INTEGER,
+    failure_reason TEXT,
+    approved_at DATETIME,
+    confirmed_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_payment_id ON refunds(payment_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_status ON refunds(status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refunds_transaction_hash ON refunds(transaction_hash) WHERE transaction_hash IS NOT NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_refunds_transaction_hash;
+DROP INDEX IF EXISTS idx_refunds_status;
+DROP INDEX IF EXISTS idx_refunds_payment_id;
+DROP TABLE IF EXISTS refunds;
@@ -0,0 +1,78 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Session counts per creation hour, merchant, network, token and status, with the total time from creation
+-- to confirmation of the confirmed ones. Payment stats read this rollup instead of scanning payment_sessions.
+CREATE TABLE IF NOT EXISTS payment_stats_hourly (
+    period TEXT NOT NULL,
+    merchant_id TEXT NOT NULL,
+    network_id TEXT NOT NULL,
+    token_symbol TEXT NOT NULL,
+    status TEXT NOT NULL,
+    payments INTEGER NOT NULL DEFAULT 0,
+    confirmed INTEGER NOT NULL DEFAULT 0,
+    processing_seconds REAL NOT NULL DEFAULT 0,
+    PRIMARY KEY (period, merchant_id, network_id, token_symbol, status)
+);
+
+INSERT INTO payment_stats_hourly (period, merchant_id, network_id, token_symbol, status, payments, confirmed, processing_seconds)
+SELECT strftime('%Y-%m-%dT%H:00:00Z', created_at), COALESCE(merchant_id, ''), network_id, token_symbol, status,
+    COUNT(*), COUNT(confirmed_at), COALESCE(SUM((julianday(confirmed_at) - julianday(created_at)) * 86400), 0)
+FROM payment_sessions
+GROUP BY 1, 2, 3, 4, 5;
+
+-- The triggers keep the rollup in step with every insert, update and delete of payment_sessions
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS payment_stats_hourly_insert AFTER INSERT ON payment_sessions
+BEGIN
+    INSERT INTO payment_stats_hourly (period, merchant_id, network_id, token_symbol, status, payments, confirmed, processing_seconds)
+    VALUES (strftime('%Y-%m-%dT%H:00:00Z', NEW.created_at), COALESCE(NEW.merchant_id, ''), NEW.network_id, NEW.token_symbol, NEW.status,
+        1, NEW.confirmed_at IS NOT NULL, COALESCE((julianday(NEW.confirmed_at) - julianday(NEW.created_at)) * 86400, 0))
+    ON CONFLICT (period, merchant_id, network_id, token_symbol, status) DO UPDATE SET
+        payments = payments + excluded.payments,
+        confirmed = confirmed + excluded.confirmed,
+        processing_seconds = processing_seconds + excluded.processing_seconds;
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS payment_stats_hourly_update AFTER UPDATE ON payment_sessions
+WHEN OLD.status IS NOT NEW.status OR OLD.confirmed_at IS NOT NEW.confirmed_at OR OLD.created_at IS NOT NEW.created_at
+    OR OLD.merchant_id IS NOT NEW.merchant_id OR OLD.network_id IS NOT NEW.network_id OR OLD.token_symbol IS NOT NEW.token_symbol
+BEGIN
+    UPDATE payment_stats_hourly SET
+        payments = payments - 1,
+        confirmed = confirmed - (OLD.confirmed_at IS NOT NULL),
+        processing_seconds = processing_seconds - COALESCE((julianday(OLD.confirmed_at) - julianday(OLD.created_at)) * 86400, 0)
+    WHERE period = strftime('%Y-%m-%dT%H:00:00Z', OLD.created_at) AND merchant_id = COALESCE(OLD.merchant_id, '')
+        AND network_id = OLD.network_id AND token_symbol = OLD.token_symbol AND status = OLD.status;
+
+    INSERT INTO payment_stats_hourly (period, merchant_id, network_id, token_symbol, status, payments, confirmed, processing_seconds)
+    VALUES (strftime('%Y-%m-%dT%H:00:00Z', NEW.created_at), COALESCE(NEW.merchant_id, ''), NEW.network_id, NEW.token_symbol, NEW.status,
+        1, NEW.confirmed_at IS NOT NULL, COALESCE((julianday(NEW.confirmed_at) - julianday(NEW.created_at)) * 86400, 0))
+    ON CONFLICT (period, merchant_id, network_id, token_symbol, status) DO UPDATE SET
+        payments = payments + excluded.payments,
+        confirmed = confirmed + excluded.confirmed,
+        processing_seconds = processing_seconds + excluded.processing_seconds;
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS payment_stats_hourly_delete AFTER DELETE ON payment_sessions
+BEGIN
+    UPDATE payment_stats_hourly SET
+        payments = payments - 1,
+        confirmed = confirmed - (OLD.confirmed_at IS NOT NULL),
+        processing_seconds = processing_seconds - COALESCE((julianday(OLD.confirmed_at) - julianday(OLD.created_at)) * 86400, 0)
+    WHERE period = strftime('%Y-%m-%dT%H:00:00Z', OLD.created_at) AND merchant_id = COALESCE(OLD.merchant_id, '')
+        AND network_id = OLD.network_id AND token_symbol = OLD.token_symbol AND status = OLD.status;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TRIGGER IF EXISTS payment_stats_hourly_delete;
+DROP TRIGGER IF EXISTS payment_stats_hourly_update;
+DROP TRIGGER IF EXISTS payment_stats_hourly_insert;
+DROP TABLE IF EXISTS payment_stats_hourly;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Symbol of the coin each chain pays gas in; only sessions in it are validated against a transaction's value
+ALTER TABLE networks ADD COLUMN native_currency TEXT NOT NULL DEFAULT '';
+UPDATE networks SET native_currency = 'BNB' WHERE id = 'BSC';
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE networks DROP COLUMN native_currency;
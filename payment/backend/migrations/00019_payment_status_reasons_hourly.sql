@@ -0,0 +1,74 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Reason recorded with the transition of a session into its current status, kept by the history trigger below
+ALTER TABLE payment_sessions ADD COLUMN status_reason TEXT NOT NULL DEFAULT '';
+
+UPDATE payment_sessions SET status_reason = COALESCE((
+    SELECT reason FROM payment_status_history h
+    WHERE h.payment_id = payment_sessions.payment_id AND h.to_status = payment_sessions.status
+    ORDER BY h.id DESC LIMIT 1
+), '');
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS payment_status_history_reason AFTER INSERT ON payment_status_history
+BEGIN
+    UPDATE payment_sessions SET status_reason = NEW.reason WHERE payment_id = NEW.payment_id;
+END;
+-- +goose StatementEnd
+
+-- Session counts per creation hour, status and status reason. Failure reasons read this rollup instead of
+-- scanning payment_sessions and their history.
+CREATE TABLE IF NOT EXISTS payment_status_reasons_hourly (
+    period TEXT NOT NULL,
+    status TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    payments INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (period, status, reason)
+);
+
+INSERT INTO payment_status_reasons_hourly (period, status, reason, payments)
+SELECT strftime('%Y-%m-%dT%H:00:00Z', created_at), status, status_reason, COUNT(*)
+FROM payment_sessions
+GROUP BY 1, 2, 3;
+
+-- The triggers keep the rollup in step with every insert, update and delete of payment_sessions
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS payment_status_reasons_hourly_insert AFTER INSERT ON payment_sessions
+BEGIN
+    INSERT INTO payment_status_reasons_hourly (period, status, reason, payments)
+    VALUES (strftime('%Y-%m-%dT%H:00:00Z', NEW.created_at), NEW.status, NEW.status_reason, 1)
+    ON CONFLICT (period, status, reason) DO UPDATE SET payments = payments + 1;
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS payment_status_reasons_hourly_update AFTER UPDATE ON payment_sessions
+WHEN OLD.status IS NOT NEW.status OR OLD.status_reason IS NOT NEW.status_reason OR OLD.created_at IS NOT NEW.created_at
+BEGIN
+    UPDATE payment_status_reasons_hourly SET payments = payments - 1
+    WHERE period = strftime('%Y-%m-%dT%H:00:00Z', OLD.created_at) AND status = OLD.status AND reason = OLD.status_reason;
+
+    INSERT INTO payment_status_reasons_hourly (period, status, reason, payments)
+    VALUES (strftime('%Y-%m-%dT%H:00:00Z', NEW.created_at), NEW.status, NEW.status_reason, 1)
+    ON CONFLICT (period, status, reason) DO UPDATE SET payments = payments + 1;
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS payment_status_reasons_hourly_delete AFTER DELETE ON payment_sessions
+BEGIN
+    UPDATE payment_status_reasons_hourly SET payments = payments - 1
+    WHERE period = strftime('%Y-%m-%dT%H:00:00Z', OLD.created_at) AND status = OLD.status AND reason = OLD.status_reason;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TRIGGER IF EXISTS payment_status_reasons_hourly_delete;
+DROP TRIGGER IF EXISTS payment_status_reasons_hourly_update;
+DROP TRIGGER IF EXISTS payment_status_reasons_hourly_insert;
+DROP TABLE IF EXISTS payment_status_reasons_hourly;
+DROP TRIGGER IF EXISTS payment_status_history_reason;
+ALTER TABLE payment_sessions DROP COLUMN status_reason;
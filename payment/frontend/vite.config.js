@@ -11,7 +11,17 @@ export default defineConfig({
       '/api': {
         target: 'http://localhost:8080',
         changeOrigin: true,
-        secure: false
+        secure: false,
+        // The demo storefront has no server of its own, so in development the proxy adds the
+        // API keys the browser must never hold (MERCHANT_API_KEY, and ADMIN_API_KEY for stats)
+        configure: (proxy) => {
+          proxy.on('proxyReq', (proxyReq, req) => {
+            const key = req.url.startsWith('/api/v1/stats') ? process.env.ADMIN_API_KEY : process.env.MERCHANT_API_KEY
+            if (key && !req.headers.authorization) {
+              proxyReq.setHeader('Authorization', `Bearer ${key}`)
+            }
+          })
+        }
       }
     }
   },